@@ -0,0 +1,384 @@
+package asyncwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+	"github.com/ndau/writers/pkg/writers"
+)
+
+// DefaultQueueDepth is the number of lines which can be waiting to be
+// written before the overflow policy kicks in.
+const DefaultQueueDepth = 1024
+
+// ErrClosed is returned by writes to an AsyncWriter which has been closed.
+var ErrClosed = errors.New("asyncwriter: write to closed writer")
+
+// Overflow determines what an AsyncWriter does when its queue is full.
+type Overflow int
+
+const (
+	// Block makes the caller wait until there is room in the queue
+	Block Overflow = iota
+	// DropNewest discards the line being written
+	DropNewest
+	// DropOldest discards the line which has been queued the longest
+	DropOldest
+)
+
+// AsyncWriter wraps an io.Writer and writes to it from a background
+// goroutine, so that slow writes stay off the caller's hot path.
+//
+// Every completed line is copied into a bounded queue; a goroutine owned by
+// the AsyncWriter takes lines from the queue and writes them to the
+// underlying writer in order. When the queue is full, the Overflow policy
+// decides whether the caller blocks or a line is dropped.
+//
+// Because the underlying writes happen later, their errors can't be
+// returned from Write. Instead, they are passed to the error handler, if
+// one is set, along with any lines which are dropped.
+//
+// Flush waits until everything written so far, including any partial line,
+// has reached the underlying writer. Close does the same and then stops the
+// goroutine; the client must call Close, or Shutdown, when done with the
+// writer. Shutdown gives up waiting when its context ends, and discards
+// whatever is still queued. FlushOnIdle queues a partial line by itself
+// once nothing has been written for a while.
+//
+// AsyncWriter is safe for concurrent use.
+type AsyncWriter struct {
+	w        io.Writer
+	overflow Overflow
+	onError  writers.ErrorHandler
+	queue    chan []byte
+	done     chan struct{}
+	dropped  uint64
+	flushes  writers.FlushCounter
+	idle     writers.IdleTimer
+
+	// abandon is closed when Shutdown gives up, to make the goroutine
+	// discard the rest of the queue
+	abandon     chan struct{}
+	abandonOnce sync.Once
+
+	// writeMutex guards the caller side: lines, reason and closed
+	writeMutex sync.Mutex
+	lines      *linebuffer.LineBuffer
+	reason     writers.FlushReason
+	closed     bool
+
+	// queuedMutex guards queued and queuedBytes, the number of lines and
+	// bytes in the queue or being written
+	queuedMutex sync.Mutex
+	drained     *sync.Cond
+	queued      int
+	queuedBytes int
+}
+
+// static assert that AsyncWriter is an io.WriteCloser
+var _ io.WriteCloser = (*AsyncWriter)(nil)
+
+// static assert that AsyncWriter implements Stats
+var _ writers.Stats = (*AsyncWriter)(nil)
+
+// static assert that AsyncWriter implements IdleFlusher and Shutdowner
+var _ writers.IdleFlusher = (*AsyncWriter)(nil)
+var _ writers.Shutdowner = (*AsyncWriter)(nil)
+
+// Option configures an AsyncWriter
+type Option func(*AsyncWriter)
+
+// WithQueueDepth sets the number of lines which can wait to be written
+func WithQueueDepth(n int) Option {
+	return func(a *AsyncWriter) {
+		a.queue = make(chan []byte, n)
+	}
+}
+
+// WithOverflow sets what happens when the queue is full.
+//
+// The default is Block.
+func WithOverflow(o Overflow) Option {
+	return func(a *AsyncWriter) {
+		a.overflow = o
+	}
+}
+
+// WithErrorHandler sets a function to be called with every error returned
+// by the underlying writer. It replaces any handler set by
+// WithWriteErrorHandler.
+//
+// It is called from the AsyncWriter's goroutine.
+//
+// Deprecated: Use WithWriteErrorHandler, which also reports dropped lines,
+// and how much of each line was lost.
+func WithErrorHandler(f func(error)) Option {
+	return WithWriteErrorHandler(func(err *writers.WriteError) {
+		if err.Err != writers.ErrQueueFull && err.Err != writers.ErrAbandoned {
+			f(err.Err)
+		}
+	})
+}
+
+// WithWriteErrorHandler sets a handler to be called with every error
+// returned by the underlying writer, along with the number of bytes of the
+// line which it didn't accept; lines aren't retried, so those bytes are
+// lost. It is called from the AsyncWriter's goroutine.
+//
+// The handler is also called for every line which is dropped: from Write,
+// with writers.ErrQueueFull, when the Overflow policy drops a line, and
+// from the goroutine, with writers.ErrAbandoned, for each line Shutdown
+// discards.
+func WithWriteErrorHandler(h writers.ErrorHandler) Option {
+	return func(a *AsyncWriter) {
+		a.onError = h
+	}
+}
+
+// New creates a new AsyncWriter and starts its goroutine.
+func New(w io.Writer, opts ...Option) *AsyncWriter {
+	a := &AsyncWriter{
+		w:       w,
+		queue:   make(chan []byte, DefaultQueueDepth),
+		done:    make(chan struct{}),
+		abandon: make(chan struct{}),
+		reason:  writers.FlushNewline,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	a.lines = linebuffer.New(a.enqueue)
+	a.drained = sync.NewCond(&a.queuedMutex)
+
+	go a.run()
+	return a
+}
+
+// Write queues every line completed by p.
+//
+// It returns len(p) unless the writer has been closed, even if lines
+// were dropped.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.writeMutex.Lock()
+	defer a.writeMutex.Unlock()
+	if a.closed {
+		return 0, ErrClosed
+	}
+	defer a.idle.Touch()
+	return a.lines.Write(p)
+}
+
+// Flush queues any partial line, and then waits until every queued line
+// has been written to the underlying writer.
+func (a *AsyncWriter) Flush() error {
+	a.writeMutex.Lock()
+	if a.closed {
+		a.writeMutex.Unlock()
+		return ErrClosed
+	}
+	a.flushPartial(writers.FlushExplicit)
+	a.writeMutex.Unlock()
+
+	a.wait()
+	return nil
+}
+
+// Close writes any partial line and waits for the queue to drain, then
+// stops the background goroutine.
+//
+// Further writes return ErrClosed. Close does not close the underlying
+// writer.
+func (a *AsyncWriter) Close() error {
+	if !a.stop() {
+		return nil
+	}
+	<-a.done
+	return nil
+}
+
+// FlushOnIdle queues any partial line once d has passed without a write.
+// Those flushes are recorded as FlushTimer. A d of 0 or less turns idle
+// flushing off, which is the default.
+func (a *AsyncWriter) FlushOnIdle(d time.Duration) {
+	a.idle.Set(d, a.onIdle)
+}
+
+// Shutdown is like Close, but gives up waiting for the queue to drain
+// when ctx ends. It then returns a *writers.ShutdownError with the number
+// of lines and bytes which hadn't been written. Those lines are discarded,
+// and counted by Dropped, except for one which is already being written.
+//
+// Further writes return ErrClosed. Shutdown does not close the underlying
+// writer.
+func (a *AsyncWriter) Shutdown(ctx context.Context) error {
+	a.idle.Stop()
+	stopped := make(chan struct{})
+	go func() {
+		a.stop()
+		<-a.done
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+	}
+	a.abandonOnce.Do(func() { close(a.abandon) })
+
+	a.queuedMutex.Lock()
+	defer a.queuedMutex.Unlock()
+	return &writers.ShutdownError{
+		Lines: a.queued,
+		Bytes: a.queuedBytes,
+		Err:   ctx.Err(),
+	}
+}
+
+// Dropped returns the number of lines dropped because the queue was full,
+// or discarded by Shutdown.
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// FlushStats implements writers.Stats.
+//
+// Each line queued counts as a flush.
+func (a *AsyncWriter) FlushStats() writers.FlushStats {
+	return a.flushes.FlushStats()
+}
+
+// Unwrap returns the underlying writer
+func (a *AsyncWriter) Unwrap() io.Writer {
+	return a.w
+}
+
+// stop queues any partial line and closes the queue, so that the
+// goroutine stops once it's empty. It reports whether the writer was open.
+func (a *AsyncWriter) stop() bool {
+	a.writeMutex.Lock()
+	defer a.writeMutex.Unlock()
+	if a.closed {
+		return false
+	}
+	a.idle.Stop()
+	a.flushPartial(writers.FlushClose)
+	a.closed = true
+	close(a.queue)
+	return true
+}
+
+func (a *AsyncWriter) onIdle() {
+	a.writeMutex.Lock()
+	defer a.writeMutex.Unlock()
+	if !a.closed && a.lines.Buffered() > 0 {
+		a.flushPartial(writers.FlushTimer)
+	}
+}
+
+// flushPartial queues the partial line, if any; it must be called with
+// writeMutex held
+func (a *AsyncWriter) flushPartial(reason writers.FlushReason) {
+	a.reason = reason
+	a.lines.Flush()
+	a.reason = writers.FlushNewline
+}
+
+// enqueue is the LineBuffer handler; it's called with writeMutex held
+func (a *AsyncWriter) enqueue(line []byte) error {
+	a.flushes.Record(a.reason)
+	line = append([]byte(nil), line...)
+	a.adjustQueued(1, len(line))
+
+	switch a.overflow {
+	case DropNewest:
+		select {
+		case a.queue <- line:
+		default:
+			a.drop(line, writers.ErrQueueFull)
+		}
+	case DropOldest:
+		for {
+			select {
+			case a.queue <- line:
+				return nil
+			default:
+			}
+			select {
+			case old := <-a.queue:
+				a.drop(old, writers.ErrQueueFull)
+			default:
+			}
+		}
+	default:
+		a.queue <- line
+	}
+	return nil
+}
+
+func (a *AsyncWriter) drop(line []byte, err error) {
+	atomic.AddUint64(&a.dropped, 1)
+	a.adjustQueued(-1, -len(line))
+	a.report(err, line, line)
+}
+
+func (a *AsyncWriter) adjustQueued(lines, bytes int) {
+	a.queuedMutex.Lock()
+	defer a.queuedMutex.Unlock()
+	a.queued += lines
+	a.queuedBytes += bytes
+	if a.queued == 0 {
+		a.drained.Broadcast()
+	}
+}
+
+// wait blocks until the queue is empty and nothing is being written
+func (a *AsyncWriter) wait() {
+	a.queuedMutex.Lock()
+	defer a.queuedMutex.Unlock()
+	for a.queued > 0 {
+		a.drained.Wait()
+	}
+}
+
+func (a *AsyncWriter) report(err error, lost, line []byte) {
+	if a.onError != nil {
+		a.onError(&writers.WriteError{
+			Sink:      writers.SinkName(a.w),
+			BytesLost: len(lost),
+			LineHash:  writers.LineHash(line),
+			Err:       err,
+		})
+	}
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	for line := range a.queue {
+		select {
+		case <-a.abandon:
+			a.drop(line, writers.ErrAbandoned)
+			continue
+		default:
+		}
+		if n, err := a.w.Write(line); err != nil {
+			a.report(err, line[n:], line)
+		}
+		a.adjustQueued(-1, -len(line))
+	}
+}
@@ -0,0 +1,312 @@
+package asyncwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/asyncwriter"
+	"github.com/ndau/writers/pkg/writers"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedWriter blocks every write until the gate is opened
+type gatedWriter struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+	gate  chan struct{}
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	<-g.gate
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.buf.Write(p)
+}
+
+func (g *gatedWriter) String() string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.buf.String()
+}
+
+func TestAsyncWriterFlushAndClose(t *testing.T) {
+	sink := &gatedWriter{gate: make(chan struct{})}
+	close(sink.gate)
+	writer := asyncwriter.New(sink)
+
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(writer, "line %d\n", i)
+	}
+	fmt.Fprint(writer, "partial")
+	require.NoError(t, writer.Flush())
+	require.Equal(t, 100, strings.Count(sink.String(), "\n"))
+	require.True(t, strings.HasSuffix(sink.String(), "line 99\npartial"))
+
+	fmt.Fprint(writer, "\nlast")
+	require.NoError(t, writer.Close())
+	require.True(t, strings.HasSuffix(sink.String(), "partial\nlast"))
+
+	_, err := writer.Write([]byte("too late\n"))
+	require.Equal(t, asyncwriter.ErrClosed, err)
+	require.Equal(t, asyncwriter.ErrClosed, writer.Flush())
+	require.NoError(t, writer.Close())
+
+	stats := writer.FlushStats()
+	require.Equal(t, uint64(101), stats[writers.FlushNewline])
+	require.Equal(t, uint64(1), stats[writers.FlushExplicit])
+	require.Equal(t, uint64(1), stats[writers.FlushClose])
+}
+
+func TestAsyncWriterDoesNotBlockCaller(t *testing.T) {
+	sink := &gatedWriter{gate: make(chan struct{})}
+	writer := asyncwriter.New(sink, asyncwriter.WithQueueDepth(10))
+
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(writer, "line %d\n", i)
+	}
+	require.Empty(t, sink.String())
+
+	close(sink.gate)
+	require.NoError(t, writer.Close())
+	require.Equal(t, "line 0\nline 1\nline 2\nline 3\nline 4\n", sink.String())
+}
+
+func TestAsyncWriterDropNewest(t *testing.T) {
+	sink := &gatedWriter{gate: make(chan struct{})}
+	writer := asyncwriter.New(
+		sink,
+		asyncwriter.WithQueueDepth(2),
+		asyncwriter.WithOverflow(asyncwriter.DropNewest),
+	)
+
+	// the goroutine may take the first line from the queue before blocking
+	// in the sink, so either 7 or 8 lines are dropped
+	for i := 0; i < 10; i++ {
+		n, err := fmt.Fprintf(writer, "%d\n", i)
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+	}
+	close(sink.gate)
+	require.NoError(t, writer.Close())
+
+	dropped := writer.Dropped()
+	require.Contains(t, []uint64{7, 8}, dropped)
+	require.True(t, strings.HasPrefix(sink.String(), "0\n1\n"))
+	require.Equal(t, 10-int(dropped), strings.Count(sink.String(), "\n"))
+}
+
+func TestAsyncWriterDropOldest(t *testing.T) {
+	sink := &gatedWriter{gate: make(chan struct{})}
+	writer := asyncwriter.New(
+		sink,
+		asyncwriter.WithQueueDepth(2),
+		asyncwriter.WithOverflow(asyncwriter.DropOldest),
+	)
+
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(writer, "%d\n", i)
+	}
+	close(sink.gate)
+	require.NoError(t, writer.Close())
+
+	// the newest lines always survive
+	require.True(t, strings.HasSuffix(sink.String(), "8\n9\n"))
+	require.Equal(t, 10-int(writer.Dropped()), strings.Count(sink.String(), "\n"))
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("sink is broken")
+}
+
+func TestAsyncWriterErrorHandler(t *testing.T) {
+	var mutex sync.Mutex
+	var errs []error
+	writer := asyncwriter.New(failingWriter{}, asyncwriter.WithErrorHandler(func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		errs = append(errs, err)
+	}))
+
+	n, err := writer.Write([]byte("a\nb\n"))
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	require.NoError(t, writer.Close())
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Len(t, errs, 2)
+	require.EqualError(t, errs[0], "sink is broken")
+}
+
+func TestAsyncWriterConcurrentWriters(t *testing.T) {
+	sink := &gatedWriter{gate: make(chan struct{})}
+	close(sink.gate)
+	writer := asyncwriter.New(sink)
+
+	wg := sync.WaitGroup{}
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				fmt.Fprintf(writer, "goroutine %d line %d\n", g, i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	require.NoError(t, writer.Flush())
+	require.Equal(t, 400, strings.Count(sink.String(), "\n"))
+	require.NoError(t, writer.Close())
+}
+
+func TestAsyncWriterFlushOnIdle(t *testing.T) {
+	sink := &gatedWriter{gate: make(chan struct{})}
+	close(sink.gate)
+	writer := asyncwriter.New(sink)
+	defer writer.Close()
+	writer.FlushOnIdle(10 * time.Millisecond)
+
+	fmt.Fprint(writer, "one\ntw")
+	require.Eventually(t, func() bool {
+		return sink.String() == "one\ntw"
+	}, time.Second, time.Millisecond)
+	require.Equal(t, uint64(1), writer.FlushStats()[writers.FlushTimer])
+}
+
+func TestAsyncWriterShutdown(t *testing.T) {
+	sink := &gatedWriter{gate: make(chan struct{})}
+	close(sink.gate)
+	writer := asyncwriter.New(sink)
+
+	fmt.Fprint(writer, "one\ntwo")
+	require.NoError(t, writer.Shutdown(context.Background()))
+	require.Equal(t, "one\ntwo", sink.String())
+	_, err := writer.Write([]byte("three\n"))
+	require.Equal(t, asyncwriter.ErrClosed, err)
+	require.NoError(t, writer.Shutdown(context.Background()))
+}
+
+func TestAsyncWriterShutdownTimeout(t *testing.T) {
+	sink := &gatedWriter{gate: make(chan struct{})}
+	writer := asyncwriter.New(sink)
+
+	fmt.Fprint(writer, "one\ntwo\nthree")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := writer.Shutdown(ctx)
+	var serr *writers.ShutdownError
+	require.True(t, errors.As(err, &serr))
+	require.Equal(t, 3, serr.Lines)
+	require.Equal(t, len("one\ntwo\nthree"), serr.Bytes)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// the line being written when Shutdown gave up gets through; the rest
+	// are discarded
+	close(sink.gate)
+	require.Eventually(t, func() bool {
+		return writer.Dropped() == 2
+	}, time.Second, time.Millisecond)
+	require.Equal(t, "one\n", sink.String())
+}
+
+func TestAsyncWriterWriteErrorHandler(t *testing.T) {
+	var errs []*writers.WriteError
+	writer := asyncwriter.New(failingWriter{},
+		asyncwriter.WithWriteErrorHandler(func(err *writers.WriteError) { errs = append(errs, err) }),
+	)
+	fmt.Fprint(writer, "a\n")
+	require.NoError(t, writer.Close())
+
+	require.Len(t, errs, 1)
+	require.Equal(t, "asyncwriter_test.failingWriter", errs[0].Sink)
+	require.Equal(t, 2, errs[0].BytesLost)
+	require.Equal(t, writers.LineHash([]byte("a\n")), errs[0].LineHash)
+	require.EqualError(t, errs[0].Err, "sink is broken")
+}
+
+// signalWriter is a gatedWriter which signals when a write starts
+type signalWriter struct {
+	gatedWriter
+	entered chan struct{}
+}
+
+func (s *signalWriter) Write(p []byte) (int, error) {
+	select {
+	case s.entered <- struct{}{}:
+	default:
+	}
+	return s.gatedWriter.Write(p)
+}
+
+func TestAsyncWriterReportsDrops(t *testing.T) {
+	sink := &signalWriter{gatedWriter{gate: make(chan struct{})}, make(chan struct{}, 1)}
+	var mutex sync.Mutex
+	var lost []string
+	var plain []error
+	handler := func(err *writers.WriteError) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		lost = append(lost, fmt.Sprintf("%v %d", err.Err, err.BytesLost))
+	}
+	writer := asyncwriter.New(sink,
+		asyncwriter.WithQueueDepth(1),
+		asyncwriter.WithOverflow(asyncwriter.DropOldest),
+		// replaced by the handler below
+		asyncwriter.WithErrorHandler(func(err error) { plain = append(plain, err) }),
+		asyncwriter.WithWriteErrorHandler(handler),
+	)
+	fmt.Fprint(writer, "a\n")
+	// wait for the goroutine to take a from the queue and block on it
+	<-sink.entered
+	fmt.Fprint(writer, "bb\nccc\n")
+	require.Equal(t, uint64(1), writer.Dropped())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Error(t, writer.Shutdown(ctx))
+	close(sink.gate)
+	require.Eventually(t, func() bool {
+		return writer.Dropped() == 2
+	}, time.Second, time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Equal(t, []string{"queue full 3", "abandoned at shutdown 4"}, lost)
+	require.Empty(t, plain)
+}
+
+func TestAsyncWriterDeprecatedErrorHandler(t *testing.T) {
+	sink := &gatedWriter{gate: make(chan struct{})}
+	var plain []error
+	writer := asyncwriter.New(sink,
+		asyncwriter.WithQueueDepth(1),
+		asyncwriter.WithOverflow(asyncwriter.DropNewest),
+		asyncwriter.WithErrorHandler(func(err error) { plain = append(plain, err) }),
+	)
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(writer, "%d\n", i)
+	}
+	close(sink.gate)
+	require.NoError(t, writer.Close())
+	require.NotZero(t, writer.Dropped())
+	// dropped lines aren't errors from the underlying writer
+	require.Empty(t, plain)
+}
@@ -0,0 +1,161 @@
+package atomicwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// ErrClosed is returned by an AtomicWriter which has been closed or
+// aborted.
+var ErrClosed = errors.New("atomicwriter: writer already closed")
+
+// AtomicWriter writes to a temporary file in the same directory as its
+// destination, and renames it over the destination when it's closed.
+// Readers of the destination see either the old contents or the complete
+// new contents, never a partial file.
+//
+// On Close, the temporary file is synced to disk before the rename, and
+// the directory after it, so that the new contents survive a crash once
+// Close returns. If a write fails, or Abort is called, the temporary file
+// is removed and the destination is left alone.
+//
+// The client must call either Close or Abort; a common pattern is to defer
+// Abort, which does nothing after a successful Close. AtomicWriter is not
+// safe for concurrent use.
+type AtomicWriter struct {
+	filename string
+	perm     os.FileMode
+	temp     *os.File
+	err      error
+	done     bool
+}
+
+// static assert that AtomicWriter is an io.WriteCloser
+var _ io.WriteCloser = (*AtomicWriter)(nil)
+
+// Option configures an AtomicWriter
+type Option func(*AtomicWriter)
+
+// WithPerm sets the permissions of the destination. By default, an
+// existing destination keeps its permissions, and a new one gets 0644.
+func WithPerm(perm os.FileMode) Option {
+	return func(a *AtomicWriter) {
+		a.perm = perm
+	}
+}
+
+// New creates a new AtomicWriter which replaces filename, and its
+// temporary file
+func New(filename string, opts ...Option) (*AtomicWriter, error) {
+	a := &AtomicWriter{
+		filename: filename,
+		perm:     0644,
+	}
+	if info, err := os.Stat(filename); err == nil {
+		a.perm = info.Mode().Perm()
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	temp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	a.temp = temp
+	return a, nil
+}
+
+// Write writes p to the temporary file. After a failed write, the
+// destination won't be replaced, and Close returns the error.
+func (a *AtomicWriter) Write(p []byte) (int, error) {
+	if a.done {
+		return 0, ErrClosed
+	}
+	if a.err != nil {
+		return 0, a.err
+	}
+	n, err := a.temp.Write(p)
+	if err != nil {
+		a.err = err
+	}
+	return n, err
+}
+
+// Name returns the name of the temporary file
+func (a *AtomicWriter) Name() string {
+	return a.temp.Name()
+}
+
+// Close syncs the temporary file and renames it over the destination. If
+// anything has gone wrong, it removes the temporary file instead, and
+// returns the error.
+func (a *AtomicWriter) Close() error {
+	if a.done {
+		return ErrClosed
+	}
+	if a.err != nil {
+		a.Abort()
+		return a.err
+	}
+	a.done = true
+
+	err := a.temp.Sync()
+	if cerr := a.temp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(a.temp.Name(), a.perm)
+	}
+	if err == nil {
+		err = os.Rename(a.temp.Name(), a.filename)
+	}
+	if err != nil {
+		os.Remove(a.temp.Name())
+		return err
+	}
+	return syncDir(filepath.Dir(a.filename))
+}
+
+// Abort closes and removes the temporary file, leaving the destination
+// alone. It does nothing if the writer has already been closed or
+// aborted.
+func (a *AtomicWriter) Abort() error {
+	if a.done {
+		return nil
+	}
+	a.done = true
+	a.temp.Close()
+	return os.Remove(a.temp.Name())
+}
+
+// syncDir makes a rename in dir durable. Windows doesn't support syncing
+// directories, and doesn't need to.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,83 @@
+package atomicwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ndau/writers/pkg/atomicwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAtomicWriterReplaces(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "config.json")
+	require.NoError(t, ioutil.WriteFile(name, []byte("old"), 0600))
+
+	a, err := atomicwriter.New(name)
+	require.NoError(t, err)
+	defer a.Abort()
+	require.Equal(t, dir, filepath.Dir(a.Name()))
+	_, err = a.Write([]byte("new contents"))
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(name)
+	require.NoError(t, err)
+	require.Equal(t, "old", string(data), "not replaced until Close")
+
+	require.NoError(t, a.Close())
+	data, err = ioutil.ReadFile(name)
+	require.NoError(t, err)
+	require.Equal(t, "new contents", string(data))
+	info, err := os.Stat(name)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "temporary file is gone")
+
+	require.Equal(t, atomicwriter.ErrClosed, a.Close())
+	_, err = a.Write([]byte("x"))
+	require.Equal(t, atomicwriter.ErrClosed, err)
+}
+
+func TestAtomicWriterAbort(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out.txt")
+	a, err := atomicwriter.New(name, atomicwriter.WithPerm(0640))
+	require.NoError(t, err)
+	a.Write([]byte("partial"))
+	require.NoError(t, a.Abort())
+	require.NoError(t, a.Abort())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestAtomicWriterNewFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out.txt")
+	a, err := atomicwriter.New(name, atomicwriter.WithPerm(0640))
+	require.NoError(t, err)
+	a.Write([]byte("data"))
+	require.NoError(t, a.Close())
+	info, err := os.Stat(name)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	_, err = atomicwriter.New(filepath.Join(dir, "missing", "out.txt"))
+	require.Error(t, err)
+}
@@ -0,0 +1,162 @@
+package base64writer
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"encoding/base64"
+	"io"
+)
+
+// DefaultLineLength is the maximum line length allowed by MIME (RFC 2045)
+const DefaultLineLength = 76
+
+// DefaultLineEnding is the line ending required by MIME (RFC 2045)
+const DefaultLineEnding = "\r\n"
+
+// Base64Writer base64-encodes the data written to it, and wraps the
+// encoded output into lines of a fixed length. Each line is written to the
+// underlying writer as soon as it's complete, so attachments can be
+// streamed into MIME sinks without holding the whole payload in memory.
+//
+// After all data has been written, the client must call Close to encode
+// the final bytes (with padding) and terminate the final line.
+//
+// Base64Writer is not safe for concurrent use.
+type Base64Writer struct {
+	w       io.Writer
+	enc     *base64.Encoding
+	length  int
+	eol     string
+	pending []byte
+	out     []byte
+	closed  bool
+}
+
+// static assert that Base64Writer is an io.WriteCloser
+var _ io.WriteCloser = (*Base64Writer)(nil)
+
+// Option configures a Base64Writer
+type Option func(*Base64Writer)
+
+// WithLineLength sets the length of the encoded lines.
+//
+// Values less than 1 disable wrapping: the encoded output is a single line.
+func WithLineLength(n int) Option {
+	return func(b *Base64Writer) {
+		b.length = n
+	}
+}
+
+// WithLineEnding sets what is written at the end of each encoded line
+func WithLineEnding(eol string) Option {
+	return func(b *Base64Writer) {
+		b.eol = eol
+	}
+}
+
+// WithEncoding sets the base64 alphabet, for example base64.URLEncoding.
+//
+// The default is base64.StdEncoding.
+func WithEncoding(enc *base64.Encoding) Option {
+	return func(b *Base64Writer) {
+		b.enc = enc
+	}
+}
+
+// New creates a new Base64Writer
+func New(w io.Writer, opts ...Option) *Base64Writer {
+	b := &Base64Writer{
+		w:      w,
+		enc:    base64.StdEncoding,
+		length: DefaultLineLength,
+		eol:    DefaultLineEnding,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Write encodes the contents of p, writing every line it completes.
+//
+// It returns len(p) on success. Because the encoded output differs in
+// length from p, a failed write to the underlying writer returns 0.
+func (b *Base64Writer) Write(p []byte) (int, error) {
+	data := append(b.pending, p...)
+	whole := len(data) / 3 * 3
+	b.out = b.encode(b.out, data[:whole])
+	b.pending = append(b.pending[:0], data[whole:]...)
+
+	if err := b.writeLines(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close encodes any remaining bytes, and writes the final line.
+// It does not close the underlying writer.
+func (b *Base64Writer) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	b.out = b.encode(b.out, b.pending)
+	b.pending = nil
+	if err := b.writeLines(); err != nil {
+		return err
+	}
+	if len(b.out) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(b.w, string(b.out)+b.eol)
+	return err
+}
+
+// Unwrap returns the underlying writer
+func (b *Base64Writer) Unwrap() io.Writer {
+	return b.w
+}
+
+func (b *Base64Writer) encode(dst, src []byte) []byte {
+	start := len(dst)
+	size := b.enc.EncodedLen(len(src))
+	if cap(dst)-start < size {
+		grown := make([]byte, start, start+size)
+		copy(grown, dst)
+		dst = grown
+	}
+	dst = dst[:start+size]
+	b.enc.Encode(dst[start:], src)
+	return dst
+}
+
+// writeLines writes every complete line of encoded output
+func (b *Base64Writer) writeLines() error {
+	if b.length < 1 {
+		if len(b.out) == 0 {
+			return nil
+		}
+		_, err := b.w.Write(b.out)
+		b.out = b.out[:0]
+		return err
+	}
+
+	written := 0
+	for len(b.out)-written >= b.length {
+		line := string(b.out[written:written+b.length]) + b.eol
+		if _, err := io.WriteString(b.w, line); err != nil {
+			return err
+		}
+		written += b.length
+	}
+	b.out = append(b.out[:0], b.out[written:]...)
+	return nil
+}
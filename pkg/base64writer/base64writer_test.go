@@ -0,0 +1,79 @@
+package base64writer_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/ndau/writers/pkg/base64writer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBase64WriterWrapsLines(t *testing.T) {
+	data := make([]byte, 200)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	buffer := new(bytes.Buffer)
+	writer := base64writer.New(buffer)
+	// write in awkward chunk sizes
+	for i := 0; i < len(data); i += 7 {
+		end := i + 7
+		if end > len(data) {
+			end = len(data)
+		}
+		n, err := writer.Write(data[i:end])
+		require.NoError(t, err)
+		require.Equal(t, end-i, n)
+	}
+	require.NoError(t, writer.Close())
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\r\n"), "\r\n")
+	require.Len(t, lines, 4)
+	for _, line := range lines[:3] {
+		require.Len(t, line, 76)
+	}
+	require.Equal(t, base64.StdEncoding.EncodeToString(data), strings.Join(lines, ""))
+}
+
+func TestBase64WriterFlushesEachLine(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := base64writer.New(buffer, base64writer.WithLineLength(8), base64writer.WithLineEnding("\n"))
+
+	writer.Write([]byte("hello"))
+	require.Empty(t, buffer.String())
+	writer.Write([]byte(" world"))
+	require.Equal(t, "aGVsbG8g\n", buffer.String())
+	require.NoError(t, writer.Close())
+	require.Equal(t, "aGVsbG8g\nd29ybGQ=\n", buffer.String())
+}
+
+func TestBase64WriterOptions(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := base64writer.New(buffer,
+		base64writer.WithLineLength(0),
+		base64writer.WithEncoding(base64.RawURLEncoding),
+		base64writer.WithLineEnding(""),
+	)
+	writer.Write([]byte{0xfb, 0xff, 0xbf, 0xfe})
+	require.NoError(t, writer.Close())
+	require.Equal(t, "-_-__g", buffer.String())
+}
+
+func TestBase64WriterEmpty(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	require.NoError(t, base64writer.New(buffer).Close())
+	require.Empty(t, buffer.String())
+}
@@ -0,0 +1,145 @@
+package bomwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io"
+)
+
+// Mode determines what a BOMWriter does with byte order marks
+type Mode int
+
+const (
+	// Strip removes a leading byte order mark from the stream
+	Strip Mode = iota
+	// Emit makes sure the stream starts with a UTF-8 byte order mark, for
+	// the benefit of Windows consumers
+	Emit
+)
+
+// BOM identifies a byte order mark
+type BOM int
+
+const (
+	// None means that the stream did not start with a byte order mark
+	None BOM = iota
+	// UTF8 is the UTF-8 byte order mark, EF BB BF
+	UTF8
+	// UTF16BE is the big-endian UTF-16 byte order mark, FE FF
+	UTF16BE
+	// UTF16LE is the little-endian UTF-16 byte order mark, FF FE
+	UTF16LE
+)
+
+var marks = map[BOM][]byte{
+	UTF8:    {0xef, 0xbb, 0xbf},
+	UTF16BE: {0xfe, 0xff},
+	UTF16LE: {0xff, 0xfe},
+}
+
+// BOMWriter wraps an io.Writer and either strips a leading byte order mark
+// from the stream, or emits one, depending on its Mode.
+//
+// The first Write may contain only part of a byte order mark, so the first
+// few bytes of the stream are held back until it's clear whether they are
+// one. If the stream may be shorter than a byte order mark, the client
+// should call Flush after all data has been written.
+//
+// BOMWriter is not safe for concurrent use.
+type BOMWriter struct {
+	w       io.Writer
+	mode    Mode
+	head    []byte
+	decided bool
+	found   BOM
+}
+
+// static assert that BOMWriter is an io.Writer
+var _ io.Writer = (*BOMWriter)(nil)
+
+// New creates a new BOMWriter
+func New(w io.Writer, mode Mode) *BOMWriter {
+	return &BOMWriter{
+		w:    w,
+		mode: mode,
+	}
+}
+
+// Write writes the contents of p.
+//
+// It returns len(p) on success, even while bytes are being held back or
+// when a byte order mark has been stripped.
+func (b *BOMWriter) Write(p []byte) (int, error) {
+	if b.decided {
+		return b.w.Write(p)
+	}
+
+	b.head = append(b.head, p...)
+	for _, mark := range marks {
+		if len(b.head) < len(mark) && bytes.HasPrefix(mark, b.head) {
+			// this could still turn out to be a byte order mark
+			return len(p), nil
+		}
+	}
+	if err := b.decide(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes any bytes being held back while waiting to see whether
+// they are a byte order mark
+func (b *BOMWriter) Flush() error {
+	if b.decided || len(b.head) == 0 {
+		return nil
+	}
+	return b.decide()
+}
+
+// Found returns the byte order mark at the start of the stream, if one
+// has been seen
+func (b *BOMWriter) Found() BOM {
+	return b.found
+}
+
+// Unwrap returns the underlying writer
+func (b *BOMWriter) Unwrap() io.Writer {
+	return b.w
+}
+
+// decide writes out the head of the stream, stripping or emitting a byte
+// order mark as appropriate
+func (b *BOMWriter) decide() error {
+	b.decided = true
+	head := b.head
+	b.head = nil
+
+	// check UTF-8 first: it's the longest
+	for _, bom := range []BOM{UTF8, UTF16BE, UTF16LE} {
+		if bytes.HasPrefix(head, marks[bom]) {
+			b.found = bom
+			break
+		}
+	}
+
+	switch {
+	case b.mode == Strip && b.found != None:
+		head = head[len(marks[b.found]):]
+	case b.mode == Emit && b.found == None:
+		head = append(append([]byte(nil), marks[UTF8]...), head...)
+	}
+	if len(head) == 0 {
+		return nil
+	}
+	_, err := b.w.Write(head)
+	return err
+}
@@ -0,0 +1,84 @@
+package bomwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ndau/writers/pkg/bomwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func write(t *testing.T, mode bomwriter.Mode, chunks ...string) (string, bomwriter.BOM) {
+	buffer := new(bytes.Buffer)
+	writer := bomwriter.New(buffer, mode)
+	for _, chunk := range chunks {
+		n, err := writer.Write([]byte(chunk))
+		require.NoError(t, err)
+		require.Equal(t, len(chunk), n)
+	}
+	require.NoError(t, writer.Flush())
+	return buffer.String(), writer.Found()
+}
+
+func TestBOMWriterStrip(t *testing.T) {
+	out, found := write(t, bomwriter.Strip, "\xef\xbb\xbfhello")
+	require.Equal(t, "hello", out)
+	require.Equal(t, bomwriter.UTF8, found)
+
+	out, found = write(t, bomwriter.Strip, "\xfe\xff\x00h")
+	require.Equal(t, "\x00h", out)
+	require.Equal(t, bomwriter.UTF16BE, found)
+
+	out, found = write(t, bomwriter.Strip, "\xff\xfeh\x00")
+	require.Equal(t, "h\x00", out)
+	require.Equal(t, bomwriter.UTF16LE, found)
+
+	out, found = write(t, bomwriter.Strip, "no bom")
+	require.Equal(t, "no bom", out)
+	require.Equal(t, bomwriter.None, found)
+}
+
+func TestBOMWriterStripSplit(t *testing.T) {
+	// the byte order mark arrives a byte at a time
+	out, found := write(t, bomwriter.Strip, "\xef", "\xbb", "\xbf", "hi", " there")
+	require.Equal(t, "hi there", out)
+	require.Equal(t, bomwriter.UTF8, found)
+
+	// something which starts like a byte order mark but isn't one
+	out, found = write(t, bomwriter.Strip, "\xef\xbb", "x")
+	require.Equal(t, "\xef\xbbx", out)
+	require.Equal(t, bomwriter.None, found)
+}
+
+func TestBOMWriterShortStream(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := bomwriter.New(buffer, bomwriter.Strip)
+	writer.Write([]byte("\xef"))
+	require.Empty(t, buffer.String())
+	require.NoError(t, writer.Flush())
+	require.Equal(t, "\xef", buffer.String())
+}
+
+func TestBOMWriterEmit(t *testing.T) {
+	out, _ := write(t, bomwriter.Emit, "he", "llo")
+	require.Equal(t, "\xef\xbb\xbfhello", out)
+
+	// an existing byte order mark isn't duplicated
+	out, found := write(t, bomwriter.Emit, "\xef\xbb", "\xbfhello")
+	require.Equal(t, "\xef\xbb\xbfhello", out)
+	require.Equal(t, bomwriter.UTF8, found)
+
+	// nothing written, nothing emitted
+	out, _ = write(t, bomwriter.Emit)
+	require.Empty(t, out)
+}
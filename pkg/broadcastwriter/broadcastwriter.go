@@ -0,0 +1,155 @@
+package broadcastwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+)
+
+// ID identifies a subscriber to a BroadcastWriter
+type ID uint64
+
+// BroadcastWriter delivers every completed line written to it to all of
+// its current subscribers.
+//
+// Unlike io.MultiWriter, subscribers can be added and removed at any time,
+// and a failing subscriber doesn't affect the others: it is removed, and
+// the error is passed to the error handler if one is set. Write itself
+// never fails because of a subscriber.
+//
+// Subscribers only ever see whole lines: one added partway through a line
+// receives that line in full once it is completed.
+//
+// BroadcastWriter is safe for concurrent use. Like LineWriter, after all
+// data has been written, the client should call Flush to deliver any
+// trailing partial line.
+type BroadcastWriter struct {
+	onError func(ID, error)
+
+	writeMutex sync.Mutex
+	lines      *linebuffer.LineBuffer
+
+	subsMutex sync.Mutex
+	subs      map[ID]io.Writer
+	next      ID
+}
+
+// static assert that BroadcastWriter is an io.Writer
+var _ io.Writer = (*BroadcastWriter)(nil)
+
+// Option configures a BroadcastWriter
+type Option func(*BroadcastWriter)
+
+// WithErrorHandler sets a function to be called when a subscriber fails
+// and is removed
+func WithErrorHandler(f func(ID, error)) Option {
+	return func(b *BroadcastWriter) {
+		b.onError = f
+	}
+}
+
+// New creates a new BroadcastWriter with no subscribers
+func New(opts ...Option) *BroadcastWriter {
+	b := &BroadcastWriter{
+		subs: make(map[ID]io.Writer),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.lines = linebuffer.New(b.broadcast)
+	return b
+}
+
+// Add subscribes w to all lines completed from now on, and returns an ID
+// which can later be passed to Remove
+func (b *BroadcastWriter) Add(w io.Writer) ID {
+	b.subsMutex.Lock()
+	defer b.subsMutex.Unlock()
+	b.next++
+	b.subs[b.next] = w
+	return b.next
+}
+
+// Remove unsubscribes the writer with the given ID.
+//
+// It returns false if there was no such subscriber.
+func (b *BroadcastWriter) Remove(id ID) bool {
+	b.subsMutex.Lock()
+	defer b.subsMutex.Unlock()
+	_, ok := b.subs[id]
+	delete(b.subs, id)
+	return ok
+}
+
+// Len returns the number of current subscribers
+func (b *BroadcastWriter) Len() int {
+	b.subsMutex.Lock()
+	defer b.subsMutex.Unlock()
+	return len(b.subs)
+}
+
+// Write writes the contents of p, delivering each completed line to
+// every subscriber.
+//
+// It always returns len(p), nil.
+func (b *BroadcastWriter) Write(p []byte) (int, error) {
+	b.writeMutex.Lock()
+	defer b.writeMutex.Unlock()
+	return b.lines.Write(p)
+}
+
+// Flush delivers any trailing partial line to every subscriber
+func (b *BroadcastWriter) Flush() error {
+	b.writeMutex.Lock()
+	defer b.writeMutex.Unlock()
+	return b.lines.Flush()
+}
+
+// Unwrap returns the current subscribers
+func (b *BroadcastWriter) Unwrap() []io.Writer {
+	b.subsMutex.Lock()
+	defer b.subsMutex.Unlock()
+	ws := make([]io.Writer, 0, len(b.subs))
+	for _, w := range b.subs {
+		ws = append(ws, w)
+	}
+	return ws
+}
+
+type subscriber struct {
+	id ID
+	w  io.Writer
+}
+
+// broadcast is the LineBuffer handler. Subscribers are written to without
+// holding subsMutex, so that Add and Remove don't wait on slow subscribers.
+func (b *BroadcastWriter) broadcast(line []byte) error {
+	b.subsMutex.Lock()
+	subs := make([]subscriber, 0, len(b.subs))
+	for id, w := range b.subs {
+		subs = append(subs, subscriber{id, w})
+	}
+	b.subsMutex.Unlock()
+	// deliver in subscription order, so that behavior is repeatable
+	sort.Slice(subs, func(i, j int) bool { return subs[i].id < subs[j].id })
+
+	for _, sub := range subs {
+		_, err := sub.w.Write(line)
+		if err != nil && b.Remove(sub.id) && b.onError != nil {
+			b.onError(sub.id, err)
+		}
+	}
+	return nil
+}
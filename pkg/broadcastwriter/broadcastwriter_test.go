@@ -0,0 +1,67 @@
+package broadcastwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ndau/writers/pkg/broadcastwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcastWriterSubscribers(t *testing.T) {
+	writer := broadcastwriter.New()
+	first := new(bytes.Buffer)
+	second := new(bytes.Buffer)
+
+	id := writer.Add(first)
+	fmt.Fprint(writer, "one\ntw")
+	writer.Add(second)
+	fmt.Fprint(writer, "o\nthree\n")
+	require.True(t, writer.Remove(id))
+	require.False(t, writer.Remove(id))
+	fmt.Fprint(writer, "four\nfive")
+	require.NoError(t, writer.Flush())
+
+	require.Equal(t, "one\ntwo\nthree\n", first.String())
+	require.Equal(t, "two\nthree\nfour\nfive", second.String())
+	require.Equal(t, 1, writer.Len())
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("subscriber went away")
+}
+
+func TestBroadcastWriterIsolatesErrors(t *testing.T) {
+	var failed []broadcastwriter.ID
+	writer := broadcastwriter.New(broadcastwriter.WithErrorHandler(func(id broadcastwriter.ID, err error) {
+		require.EqualError(t, err, "subscriber went away")
+		failed = append(failed, id)
+	}))
+	before := new(bytes.Buffer)
+	after := new(bytes.Buffer)
+	writer.Add(before)
+	bad := writer.Add(failingWriter{})
+	writer.Add(after)
+
+	n, err := fmt.Fprint(writer, "a\nb\n")
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	require.Equal(t, "a\nb\n", before.String())
+	require.Equal(t, "a\nb\n", after.String())
+	require.Equal(t, []broadcastwriter.ID{bad}, failed)
+	require.Equal(t, 2, writer.Len())
+}
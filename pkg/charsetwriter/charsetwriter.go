@@ -0,0 +1,94 @@
+package charsetwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ndau/writers/pkg/linewriter"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+)
+
+// CharsetWriter transcodes a stream from a source encoding to UTF-8 on the
+// fly, and writes the result through a LineWriter, so that the underlying
+// writer receives each line as soon as it's complete.
+//
+// The source encoding is any golang.org/x/text encoding, for example
+// charmap.ISO8859_1, charmap.Windows1252 or japanese.ShiftJIS.
+//
+// A multi-byte character may be split across Write calls; the incomplete
+// part is held back until the rest arrives. After all data has been
+// written, the client should call Close, which converts anything left over
+// and flushes the final line.
+//
+// CharsetWriter is not safe for concurrent use.
+type CharsetWriter struct {
+	w  io.Writer
+	lw *linewriter.LineWriter
+	tw *transform.Writer
+}
+
+// static assert that CharsetWriter is an io.WriteCloser
+var _ io.WriteCloser = (*CharsetWriter)(nil)
+
+// New creates a new CharsetWriter decoding from enc
+func New(w io.Writer, enc encoding.Encoding) *CharsetWriter {
+	lw := linewriter.New(w)
+	return &CharsetWriter{
+		w:  w,
+		lw: lw,
+		tw: transform.NewWriter(lw, enc.NewDecoder()),
+	}
+}
+
+// NewNamed creates a new CharsetWriter decoding from the encoding with the
+// given IANA name, such as "ISO-8859-1", "windows-1252" or "Shift_JIS"
+func NewNamed(w io.Writer, name string) (*CharsetWriter, error) {
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil {
+		return nil, err
+	}
+	if enc == nil {
+		return nil, fmt.Errorf("charsetwriter: unsupported encoding %q", name)
+	}
+	return New(w, enc), nil
+}
+
+// Write transcodes the contents of p.
+//
+// It returns the number of bytes of p consumed.
+func (c *CharsetWriter) Write(p []byte) (int, error) {
+	return c.tw.Write(p)
+}
+
+// Flush writes any buffered, transcoded data to the underlying io.Writer.
+//
+// An incomplete multi-byte character stays buffered until Close.
+func (c *CharsetWriter) Flush() error {
+	return c.lw.Flush()
+}
+
+// Close transcodes anything left over and flushes all buffered data. It
+// does not close the underlying writer.
+func (c *CharsetWriter) Close() error {
+	if err := c.tw.Close(); err != nil {
+		return err
+	}
+	return c.lw.Flush()
+}
+
+// Unwrap returns the underlying writer
+func (c *CharsetWriter) Unwrap() io.Writer {
+	return c.w
+}
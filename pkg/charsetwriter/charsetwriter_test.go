@@ -0,0 +1,67 @@
+package charsetwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ndau/writers/pkg/charsetwriter"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestCharsetWriterLatin1(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := charsetwriter.New(buffer, charmap.ISO8859_1)
+
+	// "café\nna" in Latin-1
+	n, err := writer.Write([]byte("caf\xe9\nna"))
+	require.NoError(t, err)
+	require.Equal(t, 7, n)
+	// the first line is flushed as soon as it's complete
+	require.Equal(t, "café\n", buffer.String())
+
+	_, err = writer.Write([]byte("\xefve"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.Equal(t, "café\nnaïve", buffer.String())
+}
+
+func TestCharsetWriterWindows1252(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer, err := charsetwriter.NewNamed(buffer, "windows-1252")
+	require.NoError(t, err)
+
+	// curly quotes and the euro sign live in 0x80-0x9f
+	_, err = writer.Write([]byte("\x93quoted\x94 \x80\n"))
+	require.NoError(t, err)
+	require.Equal(t, "“quoted” €\n", buffer.String())
+}
+
+func TestCharsetWriterShiftJISSplit(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := charsetwriter.New(buffer, japanese.ShiftJIS)
+
+	// "日本\n" in Shift-JIS, written a byte at a time
+	for _, b := range []byte("\x93\xfa\x96\x7b\n") {
+		_, err := writer.Write([]byte{b})
+		require.NoError(t, err)
+	}
+	require.Equal(t, "日本\n", buffer.String())
+	require.NoError(t, writer.Close())
+}
+
+func TestCharsetWriterUnknownName(t *testing.T) {
+	_, err := charsetwriter.NewNamed(new(bytes.Buffer), "no-such-charset")
+	require.Error(t, err)
+}
@@ -0,0 +1,109 @@
+package checksumwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// ChecksumWriter passes everything written to it through to an underlying
+// writer, and feeds it to a hash as it goes, so that the checksum of an
+// exported file is ready as soon as the file is written, without reading
+// it back.
+//
+// Only what the underlying writer accepts is hashed. Optionally, Close
+// writes the digest to a side writer, in the format of sha256sum and
+// friends.
+//
+// ChecksumWriter is not safe for concurrent use.
+type ChecksumWriter struct {
+	w       io.Writer
+	h       hash.Hash
+	digestw io.Writer
+	name    string
+	closed  bool
+}
+
+// static assert that ChecksumWriter is an io.WriteCloser
+var _ io.WriteCloser = (*ChecksumWriter)(nil)
+
+// Option configures a ChecksumWriter
+type Option func(*ChecksumWriter)
+
+// WithDigest writes the digest to w on Close, as a line of the form
+//
+//	<hex digest>  <name>
+//
+// which can be checked with sha256sum -c and friends. If name is empty,
+// the line holds only the digest.
+func WithDigest(w io.Writer, name string) Option {
+	return func(c *ChecksumWriter) {
+		c.digestw = w
+		c.name = name
+	}
+}
+
+// New creates a new ChecksumWriter, which hashes with h; for example,
+// New(w, sha256.New())
+func New(w io.Writer, h hash.Hash, opts ...Option) *ChecksumWriter {
+	c := &ChecksumWriter{
+		w: w,
+		h: h,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Write writes p to the underlying writer, and hashes what was written
+func (c *ChecksumWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.h.Write(p[:n])
+	return n, err
+}
+
+// Sum returns the digest of everything written so far
+func (c *ChecksumWriter) Sum() []byte {
+	return c.h.Sum(nil)
+}
+
+// Hex returns the digest of everything written so far, in hexadecimal
+func (c *ChecksumWriter) Hex() string {
+	return hex.EncodeToString(c.Sum())
+}
+
+// Close writes the digest to the side writer, if there is one. It does not
+// close the underlying writer, and the digest remains available.
+func (c *ChecksumWriter) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.digestw == nil {
+		return nil
+	}
+	var err error
+	if c.name == "" {
+		_, err = fmt.Fprintln(c.digestw, c.Hex())
+	} else {
+		_, err = fmt.Fprintf(c.digestw, "%s  %s\n", c.Hex(), c.name)
+	}
+	return err
+}
+
+// Unwrap returns the underlying writer
+func (c *ChecksumWriter) Unwrap() io.Writer {
+	return c.w
+}
@@ -0,0 +1,69 @@
+package checksumwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/ndau/writers/pkg/checksumwriter"
+	"github.com/stretchr/testify/require"
+)
+
+const helloSHA256 = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+
+type shortWriter struct{}
+
+func (shortWriter) Write(p []byte) (int, error) {
+	return 5, errors.New("short write")
+}
+
+func TestChecksumWriter(t *testing.T) {
+	var buf bytes.Buffer
+	c := checksumwriter.New(&buf, sha256.New())
+	c.Write([]byte("hello "))
+	c.Write([]byte("world"))
+	require.Equal(t, "hello world", buf.String())
+	require.Equal(t, helloSHA256, c.Hex())
+
+	sum := sha256.Sum256([]byte("hello world"))
+	require.Equal(t, sum[:], c.Sum())
+	require.NoError(t, c.Close())
+}
+
+func TestChecksumWriterDigest(t *testing.T) {
+	var buf, digest bytes.Buffer
+	c := checksumwriter.New(&buf, sha256.New(), checksumwriter.WithDigest(&digest, "export.csv"))
+	c.Write([]byte("hello world"))
+	require.Zero(t, digest.Len())
+	require.NoError(t, c.Close())
+	require.Equal(t, helloSHA256+"  export.csv\n", digest.String())
+	require.NoError(t, c.Close())
+	require.Equal(t, helloSHA256+"  export.csv\n", digest.String())
+
+	digest.Reset()
+	c = checksumwriter.New(&buf, md5.New(), checksumwriter.WithDigest(&digest, ""))
+	require.NoError(t, c.Close())
+	require.Equal(t, "d41d8cd98f00b204e9800998ecf8427e\n", digest.String())
+}
+
+func TestChecksumWriterShortWrite(t *testing.T) {
+	c := checksumwriter.New(shortWriter{}, sha256.New())
+	n, err := c.Write([]byte("hello world"))
+	require.Error(t, err)
+	require.Equal(t, 5, n)
+
+	sum := sha256.Sum256([]byte("hello"))
+	require.Equal(t, sum[:], c.Sum())
+}
@@ -0,0 +1,152 @@
+package columnwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+)
+
+// DefaultPadding is the default number of spaces between columns
+const DefaultPadding = 2
+
+// ColumnWriter aligns tab-separated columns, like text/tabwriter, but
+// writes each row as soon as it's complete instead of buffering the whole
+// table.
+//
+// Since later rows aren't known, each column is as wide as the widest cell
+// seen in it so far; when a wider cell arrives, that row and those after it
+// are laid out with the new width. Fixed widths can be given for columns
+// whose sizes are known in advance, so that they never shift. Widths are
+// measured in runes.
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush method to write any partial row.
+//
+// ColumnWriter is not safe for concurrent use.
+type ColumnWriter struct {
+	w        io.Writer
+	lines    *linebuffer.LineBuffer
+	padding  int
+	minWidth int
+	fixed    []int
+	widths   []int
+	out      []byte
+}
+
+// static assert that ColumnWriter is an io.Writer
+var _ io.Writer = (*ColumnWriter)(nil)
+
+// Option configures a ColumnWriter
+type Option func(*ColumnWriter)
+
+// WithPadding sets the number of spaces between columns
+func WithPadding(n int) Option {
+	return func(c *ColumnWriter) {
+		c.padding = n
+	}
+}
+
+// WithMinWidth sets the minimum width of every column
+func WithMinWidth(n int) Option {
+	return func(c *ColumnWriter) {
+		c.minWidth = n
+	}
+}
+
+// WithWidths fixes the widths of the leading columns. A fixed width never
+// changes; a cell wider than its column pushes the rest of its row to the
+// right. A width less than 1 leaves that column to be learned.
+func WithWidths(widths ...int) Option {
+	return func(c *ColumnWriter) {
+		c.fixed = widths
+	}
+}
+
+// New creates a new ColumnWriter
+func New(w io.Writer, opts ...Option) *ColumnWriter {
+	c := &ColumnWriter{
+		w:       w,
+		padding: DefaultPadding,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.lines = linebuffer.New(c.writeRow)
+	return c
+}
+
+// Write writes the contents of p, writing every row completed by it
+func (c *ColumnWriter) Write(p []byte) (int, error) {
+	return c.lines.Write(p)
+}
+
+// Flush writes any partial row
+func (c *ColumnWriter) Flush() error {
+	return c.lines.Flush()
+}
+
+// Widths returns the current width of each column, not counting padding
+func (c *ColumnWriter) Widths() []int {
+	return append([]int(nil), c.widths...)
+}
+
+// Unwrap returns the underlying writer
+func (c *ColumnWriter) Unwrap() io.Writer {
+	return c.w
+}
+
+// writeRow is the LineBuffer handler
+func (c *ColumnWriter) writeRow(line []byte) error {
+	var eol []byte
+	if bytes.HasSuffix(line, []byte{'\n'}) {
+		eol = []byte{'\n'}
+		line = line[:len(line)-1]
+	}
+	cells := bytes.Split(line, []byte{'\t'})
+
+	// the last cell isn't padded, so it doesn't affect the width
+	for i, cell := range cells[:len(cells)-1] {
+		if i == len(c.widths) {
+			width := c.minWidth
+			if i < len(c.fixed) && c.fixed[i] > 0 {
+				width = c.fixed[i]
+			}
+			c.widths = append(c.widths, width)
+		}
+		if i < len(c.fixed) && c.fixed[i] > 0 {
+			continue
+		}
+		if n := utf8.RuneCount(cell); n > c.widths[i] {
+			c.widths[i] = n
+		}
+	}
+
+	c.out = c.out[:0]
+	for i, cell := range cells {
+		c.out = append(c.out, cell...)
+		if i < len(cells)-1 {
+			pad := c.widths[i] - utf8.RuneCount(cell)
+			if pad < 0 {
+				pad = 0
+			}
+			for j := 0; j < pad+c.padding; j++ {
+				c.out = append(c.out, ' ')
+			}
+		}
+	}
+	c.out = append(c.out, eol...)
+	_, err := c.w.Write(c.out)
+	return err
+}
@@ -0,0 +1,54 @@
+package columnwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ndau/writers/pkg/columnwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnWriterLearnsWidths(t *testing.T) {
+	var sb strings.Builder
+	c := columnwriter.New(&sb)
+	c.Write([]byte("id\tname\tstatus\n"))
+	require.Equal(t, "id  name  status\n", sb.String())
+	c.Write([]byte("1\tfrobnicator\tok\n2\tx\tfailed\n"))
+	c.Write([]byte("345\tünïcödé\tok"))
+	require.NoError(t, c.Flush())
+	require.Equal(t, ""+
+		"id  name  status\n"+
+		"1   frobnicator  ok\n"+
+		"2   x            failed\n"+
+		"345  ünïcödé      ok",
+		sb.String())
+	require.Equal(t, []int{3, 11}, c.Widths())
+}
+
+func TestColumnWriterFixedWidths(t *testing.T) {
+	var sb strings.Builder
+	c := columnwriter.New(&sb, columnwriter.WithWidths(4, 0), columnwriter.WithPadding(1), columnwriter.WithMinWidth(3))
+	c.Write([]byte("a\tb\tc\nlonger\tbb\tc\nd\te\tf\n"))
+	require.Equal(t, ""+
+		"a    b   c\n"+
+		"longer bb  c\n"+
+		"d    e   f\n",
+		sb.String())
+}
+
+func TestColumnWriterNoTabs(t *testing.T) {
+	var sb strings.Builder
+	c := columnwriter.New(&sb)
+	c.Write([]byte("plain line\n\n"))
+	require.Equal(t, "plain line\n\n", sb.String())
+}
@@ -0,0 +1,111 @@
+package compresswriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+)
+
+const newline = 0x0a
+
+// Compressor is implemented by compressing writers which can flush their
+// pending output, such as gzip.Writer, zlib.Writer and flate.Writer. Other
+// algorithms, like zstd, can be plugged in by wrapping them to fit.
+type Compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// static assert that the standard library compressors are Compressors
+var _ Compressor = (*gzip.Writer)(nil)
+var _ Compressor = (*zlib.Writer)(nil)
+
+// CompressWriter wraps a Compressor, and flushes it after every newline,
+// so that the receiving end can decompress the stream line by line in
+// real time. On its own, a gzip.Writer buffers far too aggressively for
+// live log shipping.
+//
+// Each flush costs a few bytes of compressed output, so this trades some
+// compression ratio for latency.
+//
+// After all data has been written, the client must call Close to finish
+// the compressed stream.
+//
+// CompressWriter is not safe for concurrent use.
+type CompressWriter struct {
+	c Compressor
+}
+
+// static assert that CompressWriter is an io.WriteCloser
+var _ io.WriteCloser = (*CompressWriter)(nil)
+
+// New creates a new CompressWriter
+func New(c Compressor) *CompressWriter {
+	return &CompressWriter{
+		c: c,
+	}
+}
+
+// NewGzip creates a new CompressWriter which writes gzip to w
+func NewGzip(w io.Writer) *CompressWriter {
+	return New(gzip.NewWriter(w))
+}
+
+// NewZlib creates a new CompressWriter which writes zlib to w
+func NewZlib(w io.Writer) *CompressWriter {
+	return New(zlib.NewWriter(w))
+}
+
+// Write compresses the contents of p, flushing the compressor after
+// every newline.
+//
+// It returns the number of bytes of p consumed.
+func (cw *CompressWriter) Write(p []byte) (n int, err error) {
+	for n < len(p) {
+		end := len(p)
+		idx := bytes.IndexByte(p[n:], newline)
+		if idx >= 0 {
+			end = n + idx + 1
+		}
+
+		written, err := cw.c.Write(p[n:end])
+		n += written
+		if err != nil {
+			return n, err
+		}
+		if idx >= 0 {
+			if err = cw.c.Flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Flush flushes the compressor, so that everything written so far can be
+// decompressed by the receiving end
+func (cw *CompressWriter) Flush() error {
+	return cw.c.Flush()
+}
+
+// Close closes the compressor, finishing the compressed stream. It does
+// not close the underlying writer.
+func (cw *CompressWriter) Close() error {
+	return cw.c.Close()
+}
+
+// Unwrap returns the Compressor
+func (cw *CompressWriter) Unwrap() io.Writer {
+	return cw.c
+}
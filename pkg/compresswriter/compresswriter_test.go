@@ -0,0 +1,65 @@
+package compresswriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ndau/writers/pkg/compresswriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressWriterGzipLineByLine(t *testing.T) {
+	compressed := new(bytes.Buffer)
+	writer := compresswriter.NewGzip(compressed)
+
+	_, err := writer.Write([]byte("first line\nsecond "))
+	require.NoError(t, err)
+
+	// the first line can be decompressed before the stream is finished
+	reader, err := gzip.NewReader(bytes.NewReader(compressed.Bytes()))
+	require.NoError(t, err)
+	line := make([]byte, len("first line\n"))
+	_, err = io.ReadFull(reader, line)
+	require.NoError(t, err)
+	require.Equal(t, "first line\n", string(line))
+
+	_, err = writer.Write([]byte("line\n"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	reader, err = gzip.NewReader(bytes.NewReader(compressed.Bytes()))
+	require.NoError(t, err)
+	all, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "first line\nsecond line\n", string(all))
+}
+
+func TestCompressWriterZlib(t *testing.T) {
+	compressed := new(bytes.Buffer)
+	writer := compresswriter.NewZlib(compressed)
+	_, err := writer.Write([]byte("no newline yet"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Flush())
+
+	reader, err := zlib.NewReader(bytes.NewReader(compressed.Bytes()))
+	require.NoError(t, err)
+	text := make([]byte, len("no newline yet"))
+	_, err = io.ReadFull(reader, text)
+	require.NoError(t, err)
+	require.Equal(t, "no newline yet", string(text))
+	require.NoError(t, writer.Close())
+}
@@ -0,0 +1,82 @@
+package countingwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+)
+
+// CountingWriter passes everything written to it through to an underlying
+// writer, counting the bytes, the lines and the calls to Write as it goes.
+//
+// Only what the underlying writer accepts is counted: after a short write,
+// the bytes and newlines beyond it are not. A trailing partial line isn't
+// counted as a line until its newline arrives.
+//
+// The counters can be read concurrently with writes, for example to
+// enforce a quota from another goroutine. Writes themselves are as safe
+// for concurrent use as the underlying writer.
+type CountingWriter struct {
+	w      io.Writer
+	bytes  uint64
+	lines  uint64
+	writes uint64
+}
+
+// static assert that CountingWriter is an io.Writer
+var _ io.Writer = (*CountingWriter)(nil)
+
+// New creates a new CountingWriter
+func New(w io.Writer) *CountingWriter {
+	return &CountingWriter{w: w}
+}
+
+// Write writes p to the underlying writer, and counts what was written
+func (c *CountingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddUint64(&c.writes, 1)
+	if n > 0 {
+		atomic.AddUint64(&c.bytes, uint64(n))
+		if lines := bytes.Count(p[:n], []byte{'\n'}); lines > 0 {
+			atomic.AddUint64(&c.lines, uint64(lines))
+		}
+	}
+	return n, err
+}
+
+// Bytes returns the number of bytes written
+func (c *CountingWriter) Bytes() uint64 {
+	return atomic.LoadUint64(&c.bytes)
+}
+
+// Lines returns the number of newlines written
+func (c *CountingWriter) Lines() uint64 {
+	return atomic.LoadUint64(&c.lines)
+}
+
+// Writes returns the number of calls to Write, including failed ones
+func (c *CountingWriter) Writes() uint64 {
+	return atomic.LoadUint64(&c.writes)
+}
+
+// Reset sets all the counters to zero
+func (c *CountingWriter) Reset() {
+	atomic.StoreUint64(&c.bytes, 0)
+	atomic.StoreUint64(&c.lines, 0)
+	atomic.StoreUint64(&c.writes, 0)
+}
+
+// Unwrap returns the underlying writer
+func (c *CountingWriter) Unwrap() io.Writer {
+	return c.w
+}
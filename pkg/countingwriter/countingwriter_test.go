@@ -0,0 +1,80 @@
+package countingwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/ndau/writers/pkg/countingwriter"
+	"github.com/stretchr/testify/require"
+)
+
+type shortWriter struct {
+	max int
+}
+
+func (s shortWriter) Write(p []byte) (int, error) {
+	if len(p) > s.max {
+		return s.max, errors.New("short write")
+	}
+	return len(p), nil
+}
+
+func TestCountingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	c := countingwriter.New(&buf)
+	c.Write([]byte("one\ntwo\nthr"))
+	c.Write([]byte("ee\n"))
+	c.Write(nil)
+
+	require.Equal(t, "one\ntwo\nthree\n", buf.String())
+	require.Equal(t, uint64(14), c.Bytes())
+	require.Equal(t, uint64(3), c.Lines())
+	require.Equal(t, uint64(3), c.Writes())
+
+	c.Reset()
+	require.Zero(t, c.Bytes())
+	require.Zero(t, c.Lines())
+	require.Zero(t, c.Writes())
+}
+
+func TestCountingWriterShortWrite(t *testing.T) {
+	c := countingwriter.New(shortWriter{max: 4})
+	n, err := c.Write([]byte("abc\ndef\n"))
+	require.Error(t, err)
+	require.Equal(t, 4, n)
+	require.Equal(t, uint64(4), c.Bytes())
+	require.Equal(t, uint64(1), c.Lines())
+	require.Equal(t, uint64(1), c.Writes())
+}
+
+func TestCountingWriterConcurrent(t *testing.T) {
+	c := countingwriter.New(ioutil.Discard)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Write([]byte("line\n"))
+				c.Lines()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, uint64(5000), c.Bytes())
+	require.Equal(t, uint64(1000), c.Lines())
+	require.Equal(t, uint64(1000), c.Writes())
+}
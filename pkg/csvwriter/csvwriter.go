@@ -0,0 +1,178 @@
+package csvwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+)
+
+// ErrFieldCount is wrapped by a RecordError when a record has the wrong
+// number of fields
+var ErrFieldCount = errors.New("wrong number of fields")
+
+// RecordError describes a line which isn't a valid record
+type RecordError struct {
+	// Line is the 1-based number of the line
+	Line int
+	Err  error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("csvwriter: line %d: %s", e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// CSVWriter treats each completed line written to it as a CSV record. It
+// parses the record, checks its number of fields, and writes it out again
+// with consistent quoting, optionally with a different delimiter.
+//
+// A line which can't be parsed, or has the wrong number of fields, is
+// discarded, and Write returns a *RecordError. Blank lines are skipped.
+// Quoted fields can't span lines.
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush method to write any partial record.
+//
+// CSVWriter is not safe for concurrent use.
+type CSVWriter struct {
+	w          io.Writer
+	lines      *linebuffer.LineBuffer
+	out        *csv.Writer
+	comma      rune
+	lazyQuotes bool
+	fields     int
+	line       int
+}
+
+// static assert that CSVWriter is an io.Writer
+var _ io.Writer = (*CSVWriter)(nil)
+
+// Option configures a CSVWriter
+type Option func(*CSVWriter)
+
+// WithInputComma sets the field delimiter of the input; the default is ','
+func WithInputComma(r rune) Option {
+	return func(c *CSVWriter) {
+		c.comma = r
+	}
+}
+
+// WithOutputComma sets the field delimiter of the output; the default is ','
+func WithOutputComma(r rune) Option {
+	return func(c *CSVWriter) {
+		c.out.Comma = r
+	}
+}
+
+// WithFieldCount sets the number of fields each record must have. If n is
+// 0, which is the default, it's taken from the first record; if n is
+// negative, records may have any number of fields.
+func WithFieldCount(n int) Option {
+	return func(c *CSVWriter) {
+		c.fields = n
+	}
+}
+
+// WithCRLF ends output records with \r\n instead of \n
+func WithCRLF() Option {
+	return func(c *CSVWriter) {
+		c.out.UseCRLF = true
+	}
+}
+
+// WithLazyQuotes accepts quotes in unquoted fields and unescaped quotes in
+// quoted fields, as for csv.Reader
+func WithLazyQuotes() Option {
+	return func(c *CSVWriter) {
+		c.lazyQuotes = true
+	}
+}
+
+// New creates a new CSVWriter
+func New(w io.Writer, opts ...Option) *CSVWriter {
+	c := &CSVWriter{
+		w:     w,
+		out:   csv.NewWriter(w),
+		comma: ',',
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.lines = linebuffer.New(c.writeRecord)
+	return c
+}
+
+// Write writes the contents of p, writing every record completed by it
+func (c *CSVWriter) Write(p []byte) (int, error) {
+	return c.lines.Write(p)
+}
+
+// Flush writes any partial record
+func (c *CSVWriter) Flush() error {
+	return c.lines.Flush()
+}
+
+// Unwrap returns the underlying writer
+func (c *CSVWriter) Unwrap() io.Writer {
+	return c.w
+}
+
+// writeRecord is the LineBuffer handler
+func (c *CSVWriter) writeRecord(line []byte) error {
+	c.line++
+	if len(bytes.TrimRight(line, "\r\n")) == 0 {
+		return nil
+	}
+
+	r := csv.NewReader(bytes.NewReader(line))
+	r.Comma = c.comma
+	r.LazyQuotes = c.lazyQuotes
+	r.FieldsPerRecord = -1
+	record, err := r.Read()
+	if err == nil {
+		// anything left over means a quoted field ran past the line
+		if _, err = r.Read(); err == io.EOF {
+			err = nil
+		} else if err == nil {
+			err = csv.ErrQuote
+		}
+	}
+	if err != nil {
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			err = perr.Err
+		}
+		return &RecordError{Line: c.line, Err: err}
+	}
+
+	if c.fields == 0 {
+		c.fields = len(record)
+	}
+	if c.fields > 0 && len(record) != c.fields {
+		return &RecordError{
+			Line: c.line,
+			Err:  fmt.Errorf("%w: got %d, want %d", ErrFieldCount, len(record), c.fields),
+		}
+	}
+
+	c.out.Write(record)
+	c.out.Flush()
+	return c.out.Error()
+}
@@ -0,0 +1,79 @@
+package csvwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"encoding/csv"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ndau/writers/pkg/csvwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVWriterNormalizes(t *testing.T) {
+	var sb strings.Builder
+	c := csvwriter.New(&sb)
+	_, err := c.Write([]byte("name,comment\r\n\"smith, j\",\"said \"\"hi\"\"\"\n\nx,  y "))
+	require.NoError(t, err)
+	require.NoError(t, c.Flush())
+	require.Equal(t, "name,comment\n\"smith, j\",\"said \"\"hi\"\"\"\nx,\"  y \"\n", sb.String())
+}
+
+func TestCSVWriterConvertsDelimiters(t *testing.T) {
+	var sb strings.Builder
+	c := csvwriter.New(&sb,
+		csvwriter.WithInputComma('\t'),
+		csvwriter.WithOutputComma(','),
+		csvwriter.WithCRLF(),
+	)
+	c.Write([]byte("a\tb,c\nd\te\n"))
+	require.Equal(t, "a,\"b,c\"\r\nd,e\r\n", sb.String())
+}
+
+func TestCSVWriterFieldCount(t *testing.T) {
+	var sb strings.Builder
+	c := csvwriter.New(&sb)
+	n, err := c.Write([]byte("a,b\nc\nd,e\n"))
+	require.Equal(t, 4, n)
+	var rerr *csvwriter.RecordError
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, 2, rerr.Line)
+	require.True(t, errors.Is(err, csvwriter.ErrFieldCount))
+	require.Equal(t, "csvwriter: line 2: wrong number of fields: got 1, want 2", err.Error())
+
+	_, err = c.Write([]byte("d,e\n"))
+	require.NoError(t, err)
+	require.Equal(t, "a,b\nd,e\n", sb.String())
+
+	sb.Reset()
+	c = csvwriter.New(&sb, csvwriter.WithFieldCount(-1))
+	_, err = c.Write([]byte("a,b\nc\n"))
+	require.NoError(t, err)
+	require.Equal(t, "a,b\nc\n", sb.String())
+}
+
+func TestCSVWriterMalformed(t *testing.T) {
+	var sb strings.Builder
+	c := csvwriter.New(&sb)
+	_, err := c.Write([]byte("a,\"b\n"))
+	require.True(t, errors.Is(err, csv.ErrQuote))
+
+	_, err = c.Write([]byte("a,b\"c\n"))
+	require.True(t, errors.Is(err, csv.ErrBareQuote))
+	require.Empty(t, sb.String())
+
+	c = csvwriter.New(&sb, csvwriter.WithLazyQuotes())
+	_, err = c.Write([]byte("a,b\"c\n"))
+	require.NoError(t, err)
+	require.Equal(t, "a,\"b\"\"c\"\n", sb.String())
+}
@@ -0,0 +1,116 @@
+package ctxwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// aLongTimeAgo is a deadline which has certainly passed
+var aLongTimeAgo = time.Unix(1, 0)
+
+// deadliner is implemented by writers whose blocking writes can be
+// interrupted, such as net.Conn and pipes from os.Pipe
+type deadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// CtxWriter ties an io.Writer to the lifecycle of a context.Context.
+//
+// Once the context is done, Write returns ctx.Err() without touching the
+// underlying writer. A write which is blocked when the context is cancelled
+// is aborted: see WriteContext for how.
+//
+// CtxWriter is as safe for concurrent use as its underlying writer.
+type CtxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+// static assert that CtxWriter is an io.Writer
+var _ io.Writer = (*CtxWriter)(nil)
+
+// New creates a new CtxWriter
+func New(ctx context.Context, w io.Writer) *CtxWriter {
+	return &CtxWriter{
+		ctx: ctx,
+		w:   w,
+	}
+}
+
+// Write writes p to the underlying writer, unless the context is done.
+func (c *CtxWriter) Write(p []byte) (int, error) {
+	return WriteContext(c.ctx, c.w, p)
+}
+
+// Unwrap returns the underlying writer
+func (c *CtxWriter) Unwrap() io.Writer {
+	return c.w
+}
+
+// WriteContext writes p to w, giving up if ctx is done first.
+//
+// If w has a SetWriteDeadline method which works (net.Conn does, as do
+// pipes), cancelling ctx sets a deadline in the past, which interrupts the
+// blocked write; the deadline is cleared again afterwards.
+//
+// Otherwise, the write happens on a separate goroutine, and WriteContext
+// stops waiting for it when ctx is done. In that case the abandoned write
+// may still complete later, using a copy of p; nothing else should be
+// written to w until it has.
+func WriteContext(ctx context.Context, w io.Writer, p []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if ctx.Done() == nil {
+		// this context can never be cancelled
+		return w.Write(p)
+	}
+
+	if d, ok := w.(deadliner); ok && d.SetWriteDeadline(time.Time{}) == nil {
+		expired := make(chan struct{})
+		stop := context.AfterFunc(ctx, func() {
+			d.SetWriteDeadline(aLongTimeAgo)
+			close(expired)
+		})
+		n, err := w.Write(p)
+		if !stop() {
+			// the context was done while we were writing; wait until the
+			// deadline has been set before clearing it, or it would stick
+			<-expired
+			d.SetWriteDeadline(time.Time{})
+			if err != nil {
+				err = ctx.Err()
+			}
+		}
+		return n, err
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+	results := make(chan result, 1)
+	data := append([]byte(nil), p...)
+	go func() {
+		n, err := w.Write(data)
+		results <- result{n, err}
+	}()
+
+	select {
+	case r := <-results:
+		return r.n, r.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
@@ -0,0 +1,138 @@
+package ctxwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/ctxwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCtxWriterCancelled(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	ctx, cancel := context.WithCancel(context.Background())
+	writer := ctxwriter.New(ctx, buffer)
+
+	n, err := writer.Write([]byte("before"))
+	require.NoError(t, err)
+	require.Equal(t, 6, n)
+
+	cancel()
+	n, err = writer.Write([]byte("after"))
+	require.Equal(t, context.Canceled, err)
+	require.Zero(t, n)
+	require.Equal(t, "before", buffer.String())
+}
+
+// blockingWriter never returns until released
+type blockingWriter struct {
+	release chan struct{}
+}
+
+func (b *blockingWriter) Write(p []byte) (int, error) {
+	<-b.release
+	return len(p), nil
+}
+
+func TestCtxWriterAbortsBlockedWrite(t *testing.T) {
+	sink := &blockingWriter{release: make(chan struct{})}
+	defer close(sink.release)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := ctxwriter.New(ctx, sink).Write([]byte("stuck"))
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestCtxWriterInterruptsConn(t *testing.T) {
+	// nobody reads from the other end, so writes block once the pipe's
+	// buffer is full; net.Pipe has no buffer at all
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	writer := ctxwriter.New(ctx, client)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	_, err := writer.Write([]byte("nobody is listening"))
+	require.Equal(t, context.Canceled, err)
+
+	// the deadline was cleared, so the conn is still usable without the context
+	go func() {
+		buf := make([]byte, 2)
+		server.Read(buf)
+	}()
+	n, err := client.Write([]byte("ok"))
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+}
+
+func TestCtxWriterBackground(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := ctxwriter.New(context.Background(), buffer)
+	_, err := writer.Write([]byte("fine"))
+	require.NoError(t, err)
+	require.Equal(t, "fine", buffer.String())
+}
+
+// slowDeadliner blocks writes until a deadline in the past is set, and
+// takes a while to finish setting it, like a busy callback goroutine
+type slowDeadliner struct {
+	mutex    sync.Mutex
+	deadline time.Time
+	expired  chan struct{}
+	once     sync.Once
+}
+
+func (s *slowDeadliner) Write(p []byte) (int, error) {
+	<-s.expired
+	return 0, errors.New("i/o timeout")
+}
+
+func (s *slowDeadliner) SetWriteDeadline(t time.Time) error {
+	if !t.IsZero() {
+		s.once.Do(func() { close(s.expired) })
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.deadline = t
+	return nil
+}
+
+func TestCtxWriterClearsDeadlineAfterCancel(t *testing.T) {
+	sink := &slowDeadliner{expired: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+	}()
+	_, err := ctxwriter.WriteContext(ctx, sink, []byte("x"))
+	require.Equal(t, context.Canceled, err)
+
+	// give a callback which is still running time to finish
+	time.Sleep(30 * time.Millisecond)
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	require.True(t, sink.deadline.IsZero(), "the deadline must not be left in the past")
+}
@@ -0,0 +1,109 @@
+package demuxwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+)
+
+// Route sends lines matching Pattern to W
+type Route struct {
+	Pattern *regexp.Regexp
+	W       io.Writer
+}
+
+// DemuxWriter splits a stream of lines between several writers.
+//
+// It is configured with an ordered list of Routes, and a default writer.
+// Each completed line is forwarded to the writer of the first Route whose
+// pattern matches it, or to the default writer if none match. Patterns are
+// matched against the line without its trailing newline.
+//
+// For example, to split a combined subprocess stream into per-severity
+// files:
+//
+//	demux := demuxwriter.New(infoFile,
+//		demuxwriter.Route{Pattern: regexp.MustCompile(`^ERROR`), W: errorFile},
+//		demuxwriter.Route{Pattern: regexp.MustCompile(`^WARN`), W: warnFile},
+//	)
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush method to route any trailing partial line. DemuxWriter is not
+// safe for concurrent use.
+type DemuxWriter struct {
+	Routes  []Route
+	Default io.Writer
+	lines   *linebuffer.LineBuffer
+}
+
+// static assert that DemuxWriter is an io.Writer
+var _ io.Writer = (*DemuxWriter)(nil)
+
+// New creates a new DemuxWriter.
+//
+// If def is nil, lines which don't match any route are discarded.
+func New(def io.Writer, routes ...Route) *DemuxWriter {
+	d := &DemuxWriter{
+		Routes:  routes,
+		Default: def,
+	}
+	d.lines = linebuffer.New(d.route)
+	return d
+}
+
+// Write writes the contents of p, routing every line it completes.
+//
+// It returns the first error from a destination writer.
+func (d *DemuxWriter) Write(p []byte) (int, error) {
+	return d.lines.Write(p)
+}
+
+// Flush routes any buffered partial line
+func (d *DemuxWriter) Flush() error {
+	return d.lines.Flush()
+}
+
+// Destination returns the writer a line would be routed to
+func (d *DemuxWriter) Destination(line []byte) io.Writer {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	for _, route := range d.Routes {
+		if route.Pattern.Match(line) {
+			return route.W
+		}
+	}
+	return d.Default
+}
+
+// Unwrap returns the destination writers of the routes, followed by the
+// default writer
+func (d *DemuxWriter) Unwrap() []io.Writer {
+	ws := make([]io.Writer, 0, len(d.Routes)+1)
+	for _, route := range d.Routes {
+		ws = append(ws, route.W)
+	}
+	if d.Default != nil {
+		ws = append(ws, d.Default)
+	}
+	return ws
+}
+
+func (d *DemuxWriter) route(line []byte) error {
+	w := d.Destination(line)
+	if w == nil {
+		return nil
+	}
+	_, err := w.Write(line)
+	return err
+}
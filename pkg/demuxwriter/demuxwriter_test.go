@@ -0,0 +1,52 @@
+package demuxwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/ndau/writers/pkg/demuxwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDemuxWriterRoutes(t *testing.T) {
+	errs := new(bytes.Buffer)
+	warns := new(bytes.Buffer)
+	rest := new(bytes.Buffer)
+	writer := demuxwriter.New(rest,
+		demuxwriter.Route{Pattern: regexp.MustCompile(`^ERROR`), W: errs},
+		demuxwriter.Route{Pattern: regexp.MustCompile(`^(WARN|ERROR)`), W: warns},
+	)
+
+	_, err := writer.Write([]byte("INFO starting\nWARN low disk\nERR"))
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("OR disk full\nINFO stopping"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Flush())
+
+	// the first matching route wins
+	require.Equal(t, "ERROR disk full\n", errs.String())
+	require.Equal(t, "WARN low disk\n", warns.String())
+	require.Equal(t, "INFO starting\nINFO stopping", rest.String())
+}
+
+func TestDemuxWriterNoDefault(t *testing.T) {
+	errs := new(bytes.Buffer)
+	writer := demuxwriter.New(nil,
+		demuxwriter.Route{Pattern: regexp.MustCompile(`error$`), W: errs},
+	)
+
+	_, err := writer.Write([]byte("an error\nnot this\nanother error\n"))
+	require.NoError(t, err)
+	require.Equal(t, "an error\nanother error\n", errs.String())
+}
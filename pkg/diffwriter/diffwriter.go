@@ -0,0 +1,165 @@
+package diffwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+)
+
+// Mismatch describes the first line at which the data written to a
+// DiffWriter diverges from the expected data
+type Mismatch struct {
+	// Line is the number of the line, counting from 1
+	Line int
+	// Expected and Actual are the lines, including any newline
+	Expected string
+	Actual   string
+	// ExpectedEOF is set if the expected data ended before this line
+	ExpectedEOF bool
+	// ActualEOF is set if the data written ended before this line
+	ActualEOF bool
+}
+
+func (m *Mismatch) Error() string {
+	switch {
+	case m.ExpectedEOF:
+		return fmt.Sprintf("diffwriter: line %d: expected end of data, got %q", m.Line, m.Actual)
+	case m.ActualEOF:
+		return fmt.Sprintf("diffwriter: line %d: expected %q, got end of data", m.Line, m.Expected)
+	}
+	return fmt.Sprintf("diffwriter: line %d: expected %q, got %q", m.Line, m.Expected, m.Actual)
+}
+
+// DiffWriter compares the data written to it, line by line, with the data
+// read from an expected io.Reader, and reports the first line at which they
+// diverge. Only one line of each is held in memory at a time, so it can
+// verify outputs far too large to compare as a whole.
+//
+// By default, the Write which completes the first mismatched line returns
+// a *Mismatch, and so do all further writes. With WithMismatchHandler, the
+// mismatch is passed to the handler instead, and further data is accepted
+// and ignored.
+//
+// After all data has been written, the client must call Close, which
+// compares any partial final line and checks that the expected data has
+// ended too. DiffWriter is not safe for concurrent use.
+type DiffWriter struct {
+	expected   *bufio.Reader
+	onMismatch func(*Mismatch)
+	lines      *linebuffer.LineBuffer
+	line       int
+	mismatch   *Mismatch
+}
+
+// static assert that DiffWriter is an io.WriteCloser
+var _ io.WriteCloser = (*DiffWriter)(nil)
+
+// Option configures a DiffWriter
+type Option func(*DiffWriter)
+
+// WithMismatchHandler passes the first mismatch to f, rather than
+// returning it from Write and Close
+func WithMismatchHandler(f func(*Mismatch)) Option {
+	return func(d *DiffWriter) {
+		d.onMismatch = f
+	}
+}
+
+// New creates a new DiffWriter which compares with the data read from
+// expected
+func New(expected io.Reader, opts ...Option) *DiffWriter {
+	d := &DiffWriter{
+		expected: bufio.NewReader(expected),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.lines = linebuffer.New(d.compare)
+	return d
+}
+
+// Write compares every line completed by p with the expected data.
+//
+// It returns an error if reading the expected data fails, or if there has
+// been a mismatch and there's no mismatch handler.
+func (d *DiffWriter) Write(p []byte) (int, error) {
+	if err := d.err(); err != nil {
+		return 0, err
+	}
+	return d.lines.Write(p)
+}
+
+// Close compares any partial final line, then checks that there is no more
+// expected data. It returns the same errors as Write.
+func (d *DiffWriter) Close() error {
+	if err := d.lines.Flush(); err != nil {
+		return err
+	}
+	if d.mismatch == nil {
+		expected, err := d.expected.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if expected != "" {
+			d.report(&Mismatch{Line: d.line + 1, Expected: expected, ActualEOF: true})
+		}
+	}
+	return d.err()
+}
+
+// Mismatch returns the first mismatch, or nil if there hasn't been one
+func (d *DiffWriter) Mismatch() *Mismatch {
+	return d.mismatch
+}
+
+// Lines returns the number of lines compared so far
+func (d *DiffWriter) Lines() int {
+	return d.line
+}
+
+// compare is the LineBuffer handler
+func (d *DiffWriter) compare(line []byte) error {
+	if d.mismatch != nil {
+		return nil
+	}
+	d.line++
+	expected, err := d.expected.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	switch {
+	case expected == "" && err == io.EOF:
+		d.report(&Mismatch{Line: d.line, Actual: string(line), ExpectedEOF: true})
+	case expected != string(line):
+		d.report(&Mismatch{Line: d.line, Expected: expected, Actual: string(line)})
+	}
+	return d.err()
+}
+
+func (d *DiffWriter) report(m *Mismatch) {
+	d.mismatch = m
+	if d.onMismatch != nil {
+		d.onMismatch(m)
+	}
+}
+
+// err returns the mismatch as an error, unless it's handled by the
+// mismatch handler
+func (d *DiffWriter) err() error {
+	if d.mismatch == nil || d.onMismatch != nil {
+		return nil
+	}
+	return d.mismatch
+}
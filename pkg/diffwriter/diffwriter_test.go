@@ -0,0 +1,91 @@
+package diffwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ndau/writers/pkg/diffwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffWriterMatch(t *testing.T) {
+	d := diffwriter.New(strings.NewReader("one\ntwo\nthree"))
+	_, err := d.Write([]byte("one\ntw"))
+	require.NoError(t, err)
+	_, err = d.Write([]byte("o\nthree"))
+	require.NoError(t, err)
+	require.NoError(t, d.Close())
+	require.Equal(t, 3, d.Lines())
+	require.Nil(t, d.Mismatch())
+}
+
+func TestDiffWriterMismatch(t *testing.T) {
+	d := diffwriter.New(strings.NewReader("one\ntwo\nthree\n"))
+	_, err := d.Write([]byte("one\n"))
+	require.NoError(t, err)
+	_, err = d.Write([]byte("TWO\nthree\n"))
+	var m *diffwriter.Mismatch
+	require.True(t, errors.As(err, &m))
+	require.Equal(t, &diffwriter.Mismatch{Line: 2, Expected: "two\n", Actual: "TWO\n"}, m)
+	require.Equal(t, `diffwriter: line 2: expected "two\n", got "TWO\n"`, m.Error())
+
+	_, err = d.Write([]byte("more\n"))
+	require.Equal(t, m, err)
+	require.Equal(t, m, d.Close())
+}
+
+func TestDiffWriterLengths(t *testing.T) {
+	d := diffwriter.New(strings.NewReader("one\n"))
+	_, err := d.Write([]byte("one\ntwo\n"))
+	require.EqualError(t, err, `diffwriter: line 2: expected end of data, got "two\n"`)
+
+	d = diffwriter.New(strings.NewReader("one\ntwo\n"))
+	_, err = d.Write([]byte("one\n"))
+	require.NoError(t, err)
+	require.EqualError(t, d.Close(), `diffwriter: line 2: expected "two\n", got end of data`)
+
+	// a missing final newline is a difference
+	d = diffwriter.New(strings.NewReader("one\n"))
+	d.Write([]byte("one"))
+	require.Error(t, d.Close())
+}
+
+func TestDiffWriterHandler(t *testing.T) {
+	var mismatches []*diffwriter.Mismatch
+	expected := strings.NewReader("a\nb\nc\n")
+	d := diffwriter.New(expected, diffwriter.WithMismatchHandler(func(m *diffwriter.Mismatch) {
+		mismatches = append(mismatches, m)
+	}))
+	for _, line := range []string{"a", "x", "y"} {
+		_, err := fmt.Fprintln(d, line)
+		require.NoError(t, err)
+	}
+	require.NoError(t, d.Close())
+	require.Len(t, mismatches, 1)
+	require.Equal(t, 2, mismatches[0].Line)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestDiffWriterReadError(t *testing.T) {
+	d := diffwriter.New(failingReader{})
+	_, err := d.Write([]byte("a\n"))
+	require.Equal(t, io.ErrClosedPipe, err)
+}
@@ -0,0 +1,111 @@
+package eolwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"io"
+)
+
+const (
+	cr = 0x0d
+	lf = 0x0a
+)
+
+// Mode determines the line ending an EOLWriter produces
+type Mode int
+
+const (
+	// ToLF produces Unix line endings (\n)
+	ToLF Mode = iota
+	// ToCRLF produces Windows line endings (\r\n)
+	ToCRLF
+)
+
+// EOLWriter wraps an io.Writer and normalizes the line endings written to
+// it. CRLF, lone CR and lone LF are all recognized as line endings, and
+// converted to the ending chosen by its Mode.
+//
+// A CR at the end of one Write may be followed by an LF at the start of
+// the next, so a trailing CR is held back until the next Write shows
+// whether it was a lone CR or part of a CRLF. After all data has been
+// written, the client should call Flush so that a final CR isn't lost.
+//
+// EOLWriter is not safe for concurrent use.
+type EOLWriter struct {
+	w         io.Writer
+	eol       []byte
+	pendingCR bool
+	out       []byte
+}
+
+// static assert that EOLWriter is an io.Writer
+var _ io.Writer = (*EOLWriter)(nil)
+
+// New creates a new EOLWriter
+func New(w io.Writer, mode Mode) *EOLWriter {
+	eol := []byte{lf}
+	if mode == ToCRLF {
+		eol = []byte{cr, lf}
+	}
+	return &EOLWriter{
+		w:   w,
+		eol: eol,
+	}
+}
+
+// Write writes the contents of p with its line endings converted.
+//
+// It returns len(p) on success. Because the converted output differs in
+// length from p, a failed write to the underlying writer returns 0.
+func (e *EOLWriter) Write(p []byte) (int, error) {
+	e.out = e.out[:0]
+	for _, b := range p {
+		if e.pendingCR {
+			e.pendingCR = false
+			e.out = append(e.out, e.eol...)
+			if b == lf {
+				// the second half of a CRLF
+				continue
+			}
+		}
+		switch b {
+		case cr:
+			e.pendingCR = true
+		case lf:
+			e.out = append(e.out, e.eol...)
+		default:
+			e.out = append(e.out, b)
+		}
+	}
+
+	if len(e.out) == 0 {
+		return len(p), nil
+	}
+	if _, err := e.w.Write(e.out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes a line ending for a trailing CR, if one is being held back
+func (e *EOLWriter) Flush() error {
+	if !e.pendingCR {
+		return nil
+	}
+	e.pendingCR = false
+	_, err := e.w.Write(e.eol)
+	return err
+}
+
+// Unwrap returns the underlying writer
+func (e *EOLWriter) Unwrap() io.Writer {
+	return e.w
+}
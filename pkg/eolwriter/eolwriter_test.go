@@ -0,0 +1,57 @@
+package eolwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ndau/writers/pkg/eolwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func write(t *testing.T, mode eolwriter.Mode, chunks ...string) string {
+	buffer := new(bytes.Buffer)
+	writer := eolwriter.New(buffer, mode)
+	for _, chunk := range chunks {
+		n, err := writer.Write([]byte(chunk))
+		require.NoError(t, err)
+		require.Equal(t, len(chunk), n)
+	}
+	require.NoError(t, writer.Flush())
+	return buffer.String()
+}
+
+func TestEOLWriterToLF(t *testing.T) {
+	require.Equal(t, "a\nb\nc\nd", write(t, eolwriter.ToLF, "a\r\nb\rc\nd"))
+	require.Equal(t, "\n\n\n", write(t, eolwriter.ToLF, "\r\r\n\n"))
+}
+
+func TestEOLWriterToCRLF(t *testing.T) {
+	require.Equal(t, "a\r\nb\r\nc\r\nd", write(t, eolwriter.ToCRLF, "a\r\nb\rc\nd"))
+}
+
+func TestEOLWriterSplitCRLF(t *testing.T) {
+	// the CR and LF arrive in different writes
+	require.Equal(t, "one\ntwo\n", write(t, eolwriter.ToLF, "one\r", "\ntwo\r", "\n"))
+	require.Equal(t, "one\r\ntwo", write(t, eolwriter.ToCRLF, "one\r", "", "\ntwo"))
+	// a lone CR at the end is only written by Flush
+	require.Equal(t, "end\n", write(t, eolwriter.ToLF, "end\r"))
+}
+
+func TestEOLWriterHoldsTrailingCR(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := eolwriter.New(buffer, eolwriter.ToLF)
+	writer.Write([]byte("line\r"))
+	require.Equal(t, "line", buffer.String())
+	writer.Write([]byte("next"))
+	require.Equal(t, "line\nnext", buffer.String())
+}
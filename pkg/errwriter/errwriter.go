@@ -0,0 +1,170 @@
+package errwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// ErrInjected is the error injected when no other is given
+var ErrInjected = errors.New("errwriter: injected error")
+
+// ErrWriter is a test helper which passes writes through to an underlying
+// writer, except when a scripted fault says otherwise. It makes testing
+// how code handles a failing io.Writer a matter of a line or two:
+//
+//	w := errwriter.New(&buf,
+//		errwriter.WithFailWrite(3, syscall.ENOSPC),
+//		errwriter.WithShortWrite(5, 2),
+//	)
+//
+// fails the third write with ENOSPC, and writes only 2 bytes of the fifth.
+// Writes are numbered from 1.
+//
+// ErrWriter is safe for concurrent use.
+type ErrWriter struct {
+	w         io.Writer
+	fails     map[int]error
+	failFrom  int
+	fromErr   error
+	shorts    map[int]int
+	failAfter int64
+	afterErr  error
+
+	mutex  sync.Mutex
+	writes int
+	bytes  int64
+}
+
+// static assert that ErrWriter is an io.Writer
+var _ io.Writer = (*ErrWriter)(nil)
+
+// Option configures an ErrWriter
+type Option func(*ErrWriter)
+
+// WithFailWrite fails the nth write with err, or ErrInjected if err is
+// nil, without writing anything
+func WithFailWrite(n int, err error) Option {
+	return func(e *ErrWriter) {
+		e.fails[n] = orInjected(err)
+	}
+}
+
+// WithFailFrom fails the nth write and every write after it with err, or
+// ErrInjected if err is nil, without writing anything
+func WithFailFrom(n int, err error) Option {
+	return func(e *ErrWriter) {
+		e.failFrom = n
+		e.fromErr = orInjected(err)
+	}
+}
+
+// WithShortWrite writes at most max bytes of the nth write, and returns
+// io.ErrShortWrite if that's less than all of it
+func WithShortWrite(n, max int) Option {
+	return func(e *ErrWriter) {
+		e.shorts[n] = max
+	}
+}
+
+// WithFailAfter lets k bytes through in total, then fails with err, or
+// ErrInjected if err is nil. The write which reaches the limit writes as
+// much as fits before failing.
+func WithFailAfter(k int64, err error) Option {
+	return func(e *ErrWriter) {
+		e.failAfter = k
+		e.afterErr = orInjected(err)
+	}
+}
+
+// New creates a new ErrWriter. If w is nil, successful writes are
+// discarded.
+func New(w io.Writer, opts ...Option) *ErrWriter {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	e := &ErrWriter{
+		w:         w,
+		fails:     make(map[int]error),
+		shorts:    make(map[int]int),
+		failAfter: -1,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Write writes p to the underlying writer, unless a fault applies
+func (e *ErrWriter) Write(p []byte) (int, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.writes++
+
+	if err, ok := e.fails[e.writes]; ok {
+		return 0, err
+	}
+	if e.failFrom > 0 && e.writes >= e.failFrom {
+		return 0, e.fromErr
+	}
+
+	var fault error
+	if max, ok := e.shorts[e.writes]; ok && max < len(p) {
+		p = p[:max]
+		fault = io.ErrShortWrite
+	}
+	if e.failAfter >= 0 {
+		remaining := e.failAfter - e.bytes
+		if remaining <= 0 {
+			return 0, e.afterErr
+		}
+		if int64(len(p)) > remaining {
+			p = p[:remaining]
+			fault = e.afterErr
+		}
+	}
+
+	n, err := e.w.Write(p)
+	e.bytes += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, fault
+}
+
+// Writes returns the number of calls to Write so far
+func (e *ErrWriter) Writes() int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.writes
+}
+
+// Bytes returns the number of bytes passed to the underlying writer so far
+func (e *ErrWriter) Bytes() int64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.bytes
+}
+
+// Unwrap returns the underlying writer
+func (e *ErrWriter) Unwrap() io.Writer {
+	return e.w
+}
+
+func orInjected(err error) error {
+	if err == nil {
+		return ErrInjected
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package errwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ndau/writers/pkg/errwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrWriterPassthrough(t *testing.T) {
+	var buf bytes.Buffer
+	e := errwriter.New(&buf)
+	n, err := e.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+	require.Equal(t, "hello", buf.String())
+	require.Equal(t, 1, e.Writes())
+	require.Equal(t, int64(5), e.Bytes())
+}
+
+func TestErrWriterFailWrite(t *testing.T) {
+	boom := errors.New("boom")
+	var buf bytes.Buffer
+	e := errwriter.New(&buf, errwriter.WithFailWrite(2, boom), errwriter.WithFailWrite(3, nil))
+	_, err := e.Write([]byte("a"))
+	require.NoError(t, err)
+	n, err := e.Write([]byte("b"))
+	require.Equal(t, boom, err)
+	require.Zero(t, n)
+	_, err = e.Write([]byte("c"))
+	require.Equal(t, errwriter.ErrInjected, err)
+	_, err = e.Write([]byte("d"))
+	require.NoError(t, err)
+	require.Equal(t, "ad", buf.String())
+}
+
+func TestErrWriterFailFrom(t *testing.T) {
+	e := errwriter.New(nil, errwriter.WithFailFrom(2, nil))
+	_, err := e.Write([]byte("a"))
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = e.Write([]byte("b"))
+		require.Equal(t, errwriter.ErrInjected, err)
+	}
+	require.Equal(t, int64(1), e.Bytes())
+}
+
+func TestErrWriterShortWrite(t *testing.T) {
+	var buf bytes.Buffer
+	e := errwriter.New(&buf, errwriter.WithShortWrite(1, 2), errwriter.WithShortWrite(2, 10))
+	n, err := e.Write([]byte("abcd"))
+	require.Equal(t, io.ErrShortWrite, err)
+	require.Equal(t, 2, n)
+	n, err = e.Write([]byte("efgh"))
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	require.Equal(t, "abefgh", buf.String())
+}
+
+func TestErrWriterFailAfter(t *testing.T) {
+	full := errors.New("disk full")
+	var buf bytes.Buffer
+	e := errwriter.New(&buf, errwriter.WithFailAfter(5, full))
+	_, err := e.Write([]byte("abc"))
+	require.NoError(t, err)
+	n, err := e.Write([]byte("defg"))
+	require.Equal(t, full, err)
+	require.Equal(t, 2, n)
+	n, err = e.Write([]byte("h"))
+	require.Equal(t, full, err)
+	require.Zero(t, n)
+	require.Equal(t, "abcde", buf.String())
+}
@@ -0,0 +1,209 @@
+package fallbackwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+	"github.com/ndau/writers/pkg/writers"
+)
+
+// FallbackWriter writes to a primary sink, and fails over to a list of
+// fallback sinks when it errors: for example, "write to the remote
+// collector, but fall back to a local file".
+//
+// Complete lines are the unit of work. A line which fails on the active
+// sink is written whole to the next sink in the list, which becomes the
+// active sink. Delivery is at least once: if a sink writes part of a line
+// before failing, that part stays there, and the whole line is written
+// again to the next sink. Optionally, the primary is probed for recovery at an
+// interval: the first line written after the interval has passed is tried
+// on the primary first, and if that works, the primary becomes active again.
+//
+// FallbackWriter keeps count of the lines written to each sink, and can
+// report which sink took each line, every switch between sinks, and every
+// failed write, to handlers.
+//
+// FallbackWriter is safe for concurrent use. Like LineWriter, after all
+// data has been written, the client should call the Flush method to write
+// any trailing partial line.
+type FallbackWriter struct {
+	sinks    []io.Writer
+	probe    time.Duration
+	onSwitch func(from, to int, err error)
+	onError  writers.ErrorHandler
+	onLine   func(sink int, line []byte)
+	now      func() time.Time
+
+	mutex    sync.Mutex
+	lines    *linebuffer.LineBuffer
+	active   int
+	switched time.Time
+	counts   []uint64
+}
+
+// static assert that FallbackWriter is an io.Writer
+var _ io.Writer = (*FallbackWriter)(nil)
+
+// Option configures a FallbackWriter
+type Option func(*FallbackWriter)
+
+// WithProbeInterval makes the FallbackWriter try the primary again once d
+// has passed since it last failed
+func WithProbeInterval(d time.Duration) Option {
+	return func(f *FallbackWriter) {
+		f.probe = d
+	}
+}
+
+// WithSwitchHandler sets a function to be called whenever the active sink
+// changes. Sinks are numbered from 0, the primary. When failing over, err
+// is the error from the sink being abandoned; when the primary recovers,
+// it is nil.
+func WithSwitchHandler(h func(from, to int, err error)) Option {
+	return func(f *FallbackWriter) {
+		f.onSwitch = h
+	}
+}
+
+// WithLineHandler sets a function to be called after each line is
+// written, with the sink which took it, numbered from 0, the primary. The
+// line includes its newline, if it has one, and is only valid for the
+// duration of the call.
+func WithLineHandler(h func(sink int, line []byte)) Option {
+	return func(f *FallbackWriter) {
+		f.onLine = h
+	}
+}
+
+// WithWriteErrorHandler sets a handler to be called with every error from
+// a sink, including failed probes of the primary. BytesLost is 0 unless
+// the line failed on the last sink, and so wasn't written anywhere; then
+// it's the part of the line which that sink didn't write.
+func WithWriteErrorHandler(h writers.ErrorHandler) Option {
+	return func(f *FallbackWriter) {
+		f.onError = h
+	}
+}
+
+// New creates a new FallbackWriter which writes to primary, falling back
+// to each of the fallbacks in turn
+func New(primary io.Writer, fallbacks []io.Writer, opts ...Option) *FallbackWriter {
+	f := &FallbackWriter{
+		sinks: append([]io.Writer{primary}, fallbacks...),
+		now:   time.Now,
+	}
+	f.counts = make([]uint64, len(f.sinks))
+	for _, opt := range opts {
+		opt(f)
+	}
+	f.lines = linebuffer.New(f.writeLine)
+	return f
+}
+
+// Write writes the contents of p.
+//
+// It only returns an error if a line could not be written to any sink.
+func (f *FallbackWriter) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.lines.Write(p)
+}
+
+// Flush writes any buffered partial line
+func (f *FallbackWriter) Flush() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.lines.Flush()
+}
+
+// Active returns the index of the sink currently being written to; 0 is
+// the primary
+func (f *FallbackWriter) Active() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.active
+}
+
+// Counts returns the number of lines written to each sink, starting with
+// the primary
+func (f *FallbackWriter) Counts() []uint64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]uint64(nil), f.counts...)
+}
+
+// Unwrap returns the sinks, primary first
+func (f *FallbackWriter) Unwrap() []io.Writer {
+	return append([]io.Writer(nil), f.sinks...)
+}
+
+// writeLine is the LineBuffer handler; it's called with the lock held
+func (f *FallbackWriter) writeLine(line []byte) error {
+	if f.active > 0 && f.probe > 0 && f.now().Sub(f.switched) >= f.probe {
+		_, err := f.sinks[0].Write(line)
+		if err == nil {
+			f.switchTo(0, nil)
+			f.wrote(0, line)
+			return nil
+		}
+		f.report(0, err, 0, line)
+		// still down; wait another interval before probing again
+		f.switched = f.now()
+	}
+
+	var err error
+	for i := f.active; i < len(f.sinks); i++ {
+		var n int
+		if n, err = f.sinks[i].Write(line); err == nil {
+			f.wrote(i, line)
+			return nil
+		}
+		if i+1 < len(f.sinks) {
+			f.report(i, err, 0, line)
+			f.switchTo(i+1, err)
+		} else {
+			f.report(i, err, len(line)-n, line)
+		}
+	}
+	return err
+}
+
+// wrote records that line was written to sink
+func (f *FallbackWriter) wrote(sink int, line []byte) {
+	f.counts[sink]++
+	if f.onLine != nil {
+		f.onLine(sink, line)
+	}
+}
+
+func (f *FallbackWriter) report(sink int, err error, lost int, line []byte) {
+	if f.onError != nil {
+		f.onError(&writers.WriteError{
+			Sink:      writers.SinkName(f.sinks[sink]),
+			BytesLost: lost,
+			LineHash:  writers.LineHash(line),
+			Err:       err,
+		})
+	}
+}
+
+func (f *FallbackWriter) switchTo(sink int, err error) {
+	from := f.active
+	f.active = sink
+	f.switched = f.now()
+	if f.onSwitch != nil {
+		f.onSwitch(from, sink, err)
+	}
+}
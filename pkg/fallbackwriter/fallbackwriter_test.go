@@ -0,0 +1,175 @@
+package fallbackwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/writers"
+	"github.com/stretchr/testify/require"
+)
+
+var errDown = errors.New("collector is down")
+
+// switchableWriter fails while down is set
+type switchableWriter struct {
+	bytes.Buffer
+	down bool
+}
+
+func (s *switchableWriter) Write(p []byte) (int, error) {
+	if s.down {
+		return 0, errDown
+	}
+	return s.Buffer.Write(p)
+}
+
+type switchEvent struct {
+	from, to int
+	err      error
+}
+
+func TestFallbackWriterFailover(t *testing.T) {
+	remote := &switchableWriter{}
+	local := &switchableWriter{}
+	var events []switchEvent
+	writer := New(remote, []io.Writer{local}, WithSwitchHandler(func(from, to int, err error) {
+		events = append(events, switchEvent{from, to, err})
+	}))
+
+	fmt.Fprint(writer, "one\n")
+	remote.down = true
+	fmt.Fprint(writer, "two\n")
+	// without probing, the writer stays on the fallback
+	remote.down = false
+	fmt.Fprint(writer, "three\n")
+
+	require.Equal(t, "one\n", remote.String())
+	require.Equal(t, "two\nthree\n", local.String())
+	require.Equal(t, 1, writer.Active())
+	require.Equal(t, []uint64{1, 2}, writer.Counts())
+	require.Equal(t, []switchEvent{{0, 1, errDown}}, events)
+}
+
+func TestFallbackWriterAllDown(t *testing.T) {
+	first := &switchableWriter{down: true}
+	second := &switchableWriter{down: true}
+	writer := New(first, []io.Writer{second})
+
+	n, err := fmt.Fprint(writer, "lost\n")
+	require.Equal(t, errDown, err)
+	require.Zero(t, n)
+	require.Equal(t, 1, writer.Active())
+}
+
+func TestFallbackWriterProbesPrimary(t *testing.T) {
+	remote := &switchableWriter{down: true}
+	local := &switchableWriter{}
+	var events []switchEvent
+	writer := New(remote, []io.Writer{local},
+		WithProbeInterval(time.Minute),
+		WithSwitchHandler(func(from, to int, err error) {
+			events = append(events, switchEvent{from, to, err})
+		}),
+	)
+	now := time.Unix(1000, 0)
+	writer.now = func() time.Time { return now }
+
+	fmt.Fprint(writer, "a\n")
+	now = now.Add(time.Minute)
+	// the probe fails, so this goes to the fallback too
+	fmt.Fprint(writer, "b\n")
+	remote.down = false
+	now = now.Add(30 * time.Second)
+	// too soon to probe again
+	fmt.Fprint(writer, "c\n")
+	now = now.Add(30 * time.Second)
+	fmt.Fprint(writer, "d\n")
+
+	require.Equal(t, "d\n", remote.String())
+	require.Equal(t, "a\nb\nc\n", local.String())
+	require.Equal(t, 0, writer.Active())
+	require.Equal(t, []switchEvent{{0, 1, errDown}, {1, 0, nil}}, events)
+}
+
+func TestFallbackWriterErrorHandler(t *testing.T) {
+	first := &switchableWriter{down: true}
+	second := &switchableWriter{}
+	var errs []*writers.WriteError
+	writer := New(first, []io.Writer{second}, WithWriteErrorHandler(func(err *writers.WriteError) {
+		errs = append(errs, err)
+	}))
+
+	fmt.Fprint(writer, "one\n")
+	second.down = true
+	fmt.Fprint(writer, "two\n")
+
+	require.Len(t, errs, 2)
+	require.Equal(t, "*fallbackwriter.switchableWriter", errs[0].Sink)
+	require.Zero(t, errs[0].BytesLost)
+	require.Equal(t, writers.LineHash([]byte("one\n")), errs[0].LineHash)
+	require.Equal(t, 4, errs[1].BytesLost)
+	require.Equal(t, writers.LineHash([]byte("two\n")), errs[1].LineHash)
+	require.EqualError(t, errs[1], "write to *fallbackwriter.switchableWriter: collector is down (4 bytes lost)")
+}
+
+type lineEvent struct {
+	sink int
+	line string
+}
+
+func TestFallbackWriterLineHandler(t *testing.T) {
+	remote := &switchableWriter{}
+	local := &switchableWriter{}
+	var got []lineEvent
+	writer := New(remote, []io.Writer{local}, WithLineHandler(func(sink int, line []byte) {
+		got = append(got, lineEvent{sink, string(line)})
+	}))
+
+	fmt.Fprint(writer, "one\n")
+	remote.down = true
+	fmt.Fprint(writer, "two\nthree")
+	require.NoError(t, writer.Flush())
+	require.Equal(t, []lineEvent{{0, "one\n"}, {1, "two\n"}, {1, "three"}}, got)
+}
+
+// shortWriter writes the first half of every write, then fails
+type shortWriter struct {
+	bytes.Buffer
+}
+
+func (s *shortWriter) Write(p []byte) (int, error) {
+	n, _ := s.Buffer.Write(p[:len(p)/2])
+	return n, errDown
+}
+
+func TestFallbackWriterShortWrite(t *testing.T) {
+	first := &shortWriter{}
+	second := &shortWriter{}
+	var errs []*writers.WriteError
+	writer := New(first, []io.Writer{second}, WithWriteErrorHandler(func(err *writers.WriteError) {
+		errs = append(errs, err)
+	}))
+
+	_, err := fmt.Fprint(writer, "abcdef\n")
+	require.Equal(t, errDown, err)
+	// the whole line is tried again on the next sink
+	require.Equal(t, "abc", first.String())
+	require.Equal(t, "abc", second.String())
+	require.Len(t, errs, 2)
+	require.Zero(t, errs[0].BytesLost)
+	require.Equal(t, 4, errs[1].BytesLost, "only the part which wasn't written is lost")
+}
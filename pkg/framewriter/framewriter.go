@@ -0,0 +1,212 @@
+package framewriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+)
+
+// DefaultMaxFrameSize is the largest frame a Reader accepts unless
+// configured otherwise
+const DefaultMaxFrameSize = 16 << 20
+
+// ErrFrameTooLarge is returned when a frame is larger than the maximum
+// allowed
+var ErrFrameTooLarge = errors.New("framewriter: frame too large")
+
+// Prefix determines how the length of a frame is encoded
+type Prefix int
+
+const (
+	// Uvarint encodes the length as in binary.PutUvarint
+	Uvarint Prefix = iota
+	// Fixed32 encodes the length as 4 bytes, big-endian
+	Fixed32
+)
+
+// FrameWriter writes each completed line written to it, without its
+// newline, as a frame: the length of the line, then the line. With
+// WithPerWrite, each Write becomes a frame instead, whatever it contains.
+//
+// Each frame is passed to the underlying writer in a single Write. Reader
+// splits a stream of frames up again.
+//
+// In line mode, like LineWriter, after all data has been written, the
+// client should call the Flush method to frame any partial line.
+//
+// FrameWriter is not safe for concurrent use.
+type FrameWriter struct {
+	w           io.Writer
+	prefix      Prefix
+	perWrite    bool
+	keepNewline bool
+	lines       *linebuffer.LineBuffer
+	frame       []byte
+}
+
+// static assert that FrameWriter is an io.Writer
+var _ io.Writer = (*FrameWriter)(nil)
+
+// Option configures a FrameWriter
+type Option func(*FrameWriter)
+
+// WithPrefix sets how frame lengths are encoded; the default is Uvarint
+func WithPrefix(p Prefix) Option {
+	return func(f *FrameWriter) {
+		f.prefix = p
+	}
+}
+
+// WithPerWrite makes each Write a frame, rather than each line
+func WithPerWrite() Option {
+	return func(f *FrameWriter) {
+		f.perWrite = true
+	}
+}
+
+// WithNewline keeps the newline at the end of each line in its frame
+func WithNewline() Option {
+	return func(f *FrameWriter) {
+		f.keepNewline = true
+	}
+}
+
+// New creates a new FrameWriter
+func New(w io.Writer, opts ...Option) *FrameWriter {
+	f := &FrameWriter{w: w}
+	for _, opt := range opts {
+		opt(f)
+	}
+	f.lines = linebuffer.New(f.line)
+	return f
+}
+
+// Write frames the contents of p: every line it completes, or all of it
+// in per-write mode
+func (f *FrameWriter) Write(p []byte) (int, error) {
+	if !f.perWrite {
+		return f.lines.Write(p)
+	}
+	if err := f.writeFrame(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush frames any partial line. It does nothing in per-write mode.
+func (f *FrameWriter) Flush() error {
+	return f.lines.Flush()
+}
+
+// Unwrap returns the underlying writer
+func (f *FrameWriter) Unwrap() io.Writer {
+	return f.w
+}
+
+// line is the LineBuffer handler
+func (f *FrameWriter) line(line []byte) error {
+	if !f.keepNewline {
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+	}
+	return f.writeFrame(line)
+}
+
+func (f *FrameWriter) writeFrame(payload []byte) error {
+	f.frame = AppendFrame(f.frame[:0], f.prefix, payload)
+	_, err := f.w.Write(f.frame)
+	return err
+}
+
+// AppendFrame appends payload to dst as a frame
+func AppendFrame(dst []byte, prefix Prefix, payload []byte) []byte {
+	if prefix == Fixed32 {
+		dst = binary.BigEndian.AppendUint32(dst, uint32(len(payload)))
+	} else {
+		dst = binary.AppendUvarint(dst, uint64(len(payload)))
+	}
+	return append(dst, payload...)
+}
+
+// Reader reads the frames written by a FrameWriter
+type Reader struct {
+	r       *bufio.Reader
+	prefix  Prefix
+	maxSize int
+}
+
+// NewReader creates a new Reader for frames whose lengths are encoded as
+// prefix. Frames larger than maxSize are rejected; if maxSize is 0,
+// DefaultMaxFrameSize is used.
+func NewReader(r io.Reader, prefix Prefix, maxSize int) *Reader {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+	return &Reader{
+		r:       bufio.NewReader(r),
+		prefix:  prefix,
+		maxSize: maxSize,
+	}
+}
+
+// ReadFrame returns the payload of the next frame.
+//
+// At the end of the stream, it returns io.EOF; if the stream ends in the
+// middle of a frame, it returns io.ErrUnexpectedEOF. A frame larger than
+// the maximum size returns ErrFrameTooLarge, after which the stream can't
+// be read any further.
+func (fr *Reader) ReadFrame() ([]byte, error) {
+	var size uint64
+	if fr.prefix == Fixed32 {
+		var buf [4]byte
+		if _, err := io.ReadFull(fr.r, buf[:]); err != nil {
+			return nil, err
+		}
+		size = uint64(binary.BigEndian.Uint32(buf[:]))
+	} else {
+		var err error
+		if size, err = fr.readUvarint(); err != nil {
+			return nil, err
+		}
+	}
+
+	if size > uint64(fr.maxSize) || size > math.MaxInt32 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(fr.r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return payload, nil
+}
+
+// readUvarint is binary.ReadUvarint, except that a stream which ends
+// partway through the length is unexpected
+func (fr *Reader) readUvarint() (uint64, error) {
+	if _, err := fr.r.Peek(1); err != nil {
+		return 0, err
+	}
+	size, err := binary.ReadUvarint(fr.r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return size, err
+}
@@ -0,0 +1,91 @@
+package framewriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ndau/writers/pkg/framewriter"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, r *framewriter.Reader) []string {
+	var frames []string
+	for {
+		frame, err := r.ReadFrame()
+		if err == io.EOF {
+			return frames
+		}
+		require.NoError(t, err)
+		frames = append(frames, string(frame))
+	}
+}
+
+func TestFrameWriterLines(t *testing.T) {
+	var buf bytes.Buffer
+	f := framewriter.New(&buf)
+	_, err := f.Write([]byte("one\ntw"))
+	require.NoError(t, err)
+	f.Write([]byte("o\n\nthree"))
+	require.Equal(t, "\x03one\x03two\x00", buf.String())
+	require.NoError(t, f.Flush())
+
+	r := framewriter.NewReader(&buf, framewriter.Uvarint, 0)
+	require.Equal(t, []string{"one", "two", "", "three"}, readAll(t, r))
+}
+
+func TestFrameWriterFixed32(t *testing.T) {
+	var buf bytes.Buffer
+	f := framewriter.New(&buf, framewriter.WithPrefix(framewriter.Fixed32), framewriter.WithNewline())
+	f.Write([]byte("hi\n"))
+	require.Equal(t, "\x00\x00\x00\x03hi\n", buf.String())
+
+	long := strings.Repeat("x", 300)
+	f.Write([]byte(long + "\n"))
+	r := framewriter.NewReader(&buf, framewriter.Fixed32, 0)
+	require.Equal(t, []string{"hi\n", long + "\n"}, readAll(t, r))
+}
+
+func TestFrameWriterPerWrite(t *testing.T) {
+	var buf bytes.Buffer
+	f := framewriter.New(&buf, framewriter.WithPerWrite())
+	n, err := f.Write([]byte("a\nb"))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	f.Write([]byte(strings.Repeat("y", 200)))
+	require.NoError(t, f.Flush())
+
+	r := framewriter.NewReader(&buf, framewriter.Uvarint, 0)
+	require.Equal(t, []string{"a\nb", strings.Repeat("y", 200)}, readAll(t, r))
+}
+
+func TestReaderErrors(t *testing.T) {
+	r := framewriter.NewReader(strings.NewReader("\x05abc"), framewriter.Uvarint, 0)
+	_, err := r.ReadFrame()
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	r = framewriter.NewReader(strings.NewReader("\x80"), framewriter.Uvarint, 0)
+	_, err = r.ReadFrame()
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	r = framewriter.NewReader(strings.NewReader("\x00\x00"), framewriter.Fixed32, 0)
+	_, err = r.ReadFrame()
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	frame := framewriter.AppendFrame(nil, framewriter.Fixed32, []byte("too long"))
+	r = framewriter.NewReader(bytes.NewReader(frame), framewriter.Fixed32, 4)
+	_, err = r.ReadFrame()
+	require.True(t, errors.Is(err, framewriter.ErrFrameTooLarge))
+}
@@ -0,0 +1,236 @@
+package goldenwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Update, if set, decides whether Close writes the golden files instead of
+// comparing against them. If it's nil, which is the default, Close uses
+// the -update flag, if the test binary defines one:
+//
+//	var update = flag.Bool("update", false, "update golden files")
+//
+// goldenwriter doesn't define the flag itself, because many test binaries
+// already do, and defining it twice panics.
+var Update *bool
+
+// maxDiffCells limits the size of the table used to compute a diff; larger
+// outputs only report their first difference
+const maxDiffCells = 10000000
+
+// unsafeName matches the characters of a test name which are replaced in
+// file names
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// GoldenWriter collects everything written to it during a test, and on
+// Close compares it with the contents of a golden file, failing the test
+// with a line-by-line diff if they differ:
+//
+//	func TestReport(t *testing.T) {
+//		g := goldenwriter.New(t, "")
+//		generateReport(g)
+//		g.Close()
+//	}
+//
+// Running the tests with -update writes the golden files instead, after
+// which the changes can be reviewed with git diff.
+//
+// If the test doesn't call Close, it's called when the test ends.
+// GoldenWriter is safe for concurrent use.
+type GoldenWriter struct {
+	t    testing.TB
+	path string
+
+	mutex  sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+}
+
+// static assert that GoldenWriter is an io.WriteCloser
+var _ io.WriteCloser = (*GoldenWriter)(nil)
+
+// New creates a new GoldenWriter which compares against the file at path.
+// If path is empty, it's Path(t).
+func New(t testing.TB, path string) *GoldenWriter {
+	if path == "" {
+		path = Path(t)
+	}
+	g := &GoldenWriter{t: t, path: path}
+	t.Cleanup(func() { g.Close() })
+	return g
+}
+
+// Path returns the conventional path of the golden file for a test:
+// testdata/<test name>.golden, with characters other than letters,
+// digits, '.', '_' and '-' in the name replaced by '_'
+func Path(t testing.TB) string {
+	return filepath.Join("testdata", unsafeName.ReplaceAllString(t.Name(), "_")+".golden")
+}
+
+// Write collects p for comparison
+func (g *GoldenWriter) Write(p []byte) (int, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.buf.Write(p)
+}
+
+// Close compares everything written with the golden file, or writes the
+// golden file if Update is set.
+//
+// Differences are reported with t.Error; the error returned is for
+// failures to read or write the golden file, which are also reported.
+func (g *GoldenWriter) Close() error {
+	g.t.Helper()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+
+	got := g.buf.Bytes()
+	if updating() {
+		err := os.MkdirAll(filepath.Dir(g.path), 0o755)
+		if err == nil {
+			err = os.WriteFile(g.path, got, 0o644)
+		}
+		if err != nil {
+			g.t.Errorf("goldenwriter: %s", err)
+			return err
+		}
+		g.t.Logf("goldenwriter: updated %s", g.path)
+		return nil
+	}
+
+	want, err := os.ReadFile(g.path)
+	if os.IsNotExist(err) {
+		g.t.Errorf("goldenwriter: %s does not exist; run the test with -update to create it", g.path)
+		return err
+	}
+	if err != nil {
+		g.t.Errorf("goldenwriter: %s", err)
+		return err
+	}
+	if !bytes.Equal(want, got) {
+		g.t.Errorf("goldenwriter: output differs from %s (-want +got):\n%s", g.path, Diff(string(want), string(got)))
+	}
+	return nil
+}
+
+// updating reports whether the golden files should be written, according
+// to Update or the -update flag
+func updating() bool {
+	if Update != nil {
+		return *Update
+	}
+	f := flag.Lookup("update")
+	if f == nil {
+		return false
+	}
+	if getter, ok := f.Value.(flag.Getter); ok {
+		update, _ := getter.Get().(bool)
+		return update
+	}
+	return false
+}
+
+// Diff returns a line-by-line diff of want and got, in which lines only in
+// want start with "-", lines only in got start with "+", and lines in
+// both start with " ". Very large inputs are reported by their first
+// difference alone.
+func Diff(want, got string) string {
+	a, b := splitLines(want), splitLines(got)
+	if len(a)*len(b) > maxDiffCells {
+		return firstDifference(a, b)
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			fmt.Fprintf(&out, " %s\n", a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&out, "-%s\n", a[i])
+			i++
+		default:
+			fmt.Fprintf(&out, "+%s\n", b[j])
+			j++
+		}
+	}
+	return out.String()
+}
+
+func firstDifference(a, b []string) string {
+	for i := 0; ; i++ {
+		switch {
+		case i >= len(a) && i >= len(b):
+			return ""
+		case i >= len(a):
+			return fmt.Sprintf("line %d: unexpected +%s\n", i+1, b[i])
+		case i >= len(b):
+			return fmt.Sprintf("line %d: missing -%s\n", i+1, a[i])
+		case a[i] != b[i]:
+			return fmt.Sprintf("line %d:\n-%s\n+%s\n", i+1, a[i], b[i])
+		}
+	}
+}
+
+// splitLines splits s into lines. A final line without a newline is marked
+// as such, so that a missing newline shows up in the diff.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, line := range lines {
+		if strings.HasSuffix(line, "\n") {
+			lines[i] = line[:len(line)-1]
+		} else {
+			lines[i] = line + " (no newline at end)"
+		}
+	}
+	return lines
+}
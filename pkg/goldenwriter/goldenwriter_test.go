@@ -0,0 +1,97 @@
+package goldenwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// the test binary defines -update itself, as golden tests commonly do
+var update = flag.Bool("update", false, "update golden files")
+
+// failureTB records failures instead of reporting them
+type failureTB struct {
+	testing.TB
+	errors []string
+}
+
+func (f *failureTB) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestPath(t *testing.T) {
+	require.Equal(t, filepath.Join("testdata", "TestPath.golden"), Path(t))
+	t.Run("a/b c", func(t *testing.T) {
+		require.Equal(t, filepath.Join("testdata", "TestPath_a_b_c.golden"), Path(t))
+	})
+}
+
+func TestGoldenWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "report.golden")
+
+	// a missing golden file fails
+	tb := &failureTB{TB: t}
+	g := New(tb, path)
+	fmt.Fprintln(g, "one")
+	require.Error(t, g.Close())
+	require.Len(t, tb.errors, 1)
+	require.Contains(t, tb.errors[0], "-update")
+
+	// -update writes it
+	*update = true
+	g = New(t, path)
+	fmt.Fprint(g, "one\ntwo\nthree\n")
+	require.NoError(t, g.Close())
+	*update = false
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "one\ntwo\nthree\n", string(data))
+
+	// matching output passes
+	g = New(t, path)
+	fmt.Fprint(g, "one\ntwo\nthree\n")
+	require.NoError(t, g.Close())
+
+	// different output fails with a diff
+	tb = &failureTB{TB: t}
+	g = New(tb, path)
+	fmt.Fprint(g, "one\n2\nthree\nfour")
+	require.NoError(t, g.Close())
+	require.NoError(t, g.Close())
+	require.Len(t, tb.errors, 1)
+	require.Contains(t, tb.errors[0], " one\n-two\n+2\n three\n+four (no newline at end)\n")
+
+	// Update overrides the flag
+	*update = true
+	defer func() { *update = false }()
+	no := false
+	Update = &no
+	defer func() { Update = nil }()
+	tb = &failureTB{TB: t}
+	g = New(tb, path)
+	fmt.Fprint(g, "changed\n")
+	require.NoError(t, g.Close())
+	require.Len(t, tb.errors, 1)
+}
+
+func TestDiff(t *testing.T) {
+	require.Equal(t, " a\n-b\n c\n+d\n", Diff("a\nb\nc\n", "a\nc\nd\n"))
+	require.Equal(t, "+a\n", Diff("", "a\n"))
+	require.Equal(t, "line 2:\n-b\n+x\n", firstDifference([]string{"a", "b"}, []string{"a", "x"}))
+	require.Equal(t, "line 2: unexpected +x\n", firstDifference([]string{"a"}, []string{"a", "x"}))
+	require.Empty(t, firstDifference([]string{"a"}, []string{"a"}))
+}
@@ -0,0 +1,125 @@
+package hexwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"fmt"
+	"io"
+)
+
+// BytesPerLine is the number of bytes shown on each line of the dump
+const BytesPerLine = 16
+
+const hexDigits = "0123456789abcdef"
+
+// HexWriter writes a hex dump of the data written to it, in the format of
+// `hexdump -C`: an offset, sixteen bytes in hex, and an ASCII gutter.
+//
+//	00000000  48 65 6c 6c 6f 2c 20 77  6f 72 6c 64 21 0a        |Hello, world!.|
+//	0000000e
+//
+// Unlike encoding/hex.Dumper, each line of the dump is written to the
+// underlying writer as soon as its sixteen bytes are available, which
+// makes it useful for watching binary protocols live. Unlike hexdump,
+// repeated lines are not collapsed into a '*'.
+//
+// After all data has been written, the client should call Close to dump
+// the final partial line and the total length.
+//
+// HexWriter is not safe for concurrent use.
+type HexWriter struct {
+	w      io.Writer
+	offset int64
+	buf    [BytesPerLine]byte
+	used   int
+	line   []byte
+	closed bool
+}
+
+// static assert that HexWriter is an io.WriteCloser
+var _ io.WriteCloser = (*HexWriter)(nil)
+
+// New creates a new HexWriter
+func New(w io.Writer) *HexWriter {
+	return &HexWriter{
+		w: w,
+	}
+}
+
+// Write dumps the contents of p, writing every line it completes.
+//
+// It returns the number of bytes of p consumed.
+func (h *HexWriter) Write(p []byte) (n int, err error) {
+	for n < len(p) {
+		copied := copy(h.buf[h.used:], p[n:])
+		h.used += copied
+		n += copied
+		if h.used == BytesPerLine {
+			if err = h.dumpLine(); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Close dumps the final partial line, if any, followed by the total
+// number of bytes written. It does not close the underlying writer.
+func (h *HexWriter) Close() error {
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	if h.used > 0 {
+		if err := h.dumpLine(); err != nil {
+			return err
+		}
+	}
+	if h.offset == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(h.w, "%08x\n", h.offset)
+	return err
+}
+
+// Unwrap returns the underlying writer
+func (h *HexWriter) Unwrap() io.Writer {
+	return h.w
+}
+
+// dumpLine writes the buffered bytes as a single line of the dump
+func (h *HexWriter) dumpLine() error {
+	data := h.buf[:h.used]
+	h.line = append(h.line[:0], fmt.Sprintf("%08x  ", h.offset)...)
+	for i := 0; i < BytesPerLine; i++ {
+		if i < len(data) {
+			h.line = append(h.line, hexDigits[data[i]>>4], hexDigits[data[i]&0x0f], ' ')
+		} else {
+			h.line = append(h.line, "   "...)
+		}
+		if i == BytesPerLine/2-1 {
+			h.line = append(h.line, ' ')
+		}
+	}
+	h.line = append(h.line, " |"...)
+	for _, b := range data {
+		if b < 32 || b > 126 {
+			b = '.'
+		}
+		h.line = append(h.line, b)
+	}
+	h.line = append(h.line, "|\n"...)
+
+	h.offset += int64(h.used)
+	h.used = 0
+	_, err := h.w.Write(h.line)
+	return err
+}
@@ -0,0 +1,69 @@
+package hexwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/ndau/writers/pkg/hexwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHexWriterFormat(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := hexwriter.New(buffer)
+	_, err := writer.Write([]byte("Hello, world!\n"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.Equal(t,
+		"00000000  48 65 6c 6c 6f 2c 20 77  6f 72 6c 64 21 0a        |Hello, world!.|\n"+
+			"0000000e\n",
+		buffer.String(),
+	)
+}
+
+func TestHexWriterMatchesEncodingHex(t *testing.T) {
+	// encoding/hex.Dump uses the same format, without the final offset
+	for _, size := range []int{1, 7, 8, 9, 15, 16, 17, 100} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i * 37)
+		}
+		buffer := new(bytes.Buffer)
+		writer := hexwriter.New(buffer)
+		writer.Write(data)
+		require.NoError(t, writer.Close())
+		require.Equal(t, hex.Dump(data)+fmt.Sprintf("%08x\n", size), buffer.String(), "size %d", size)
+	}
+}
+
+func TestHexWriterFlushesEachLine(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := hexwriter.New(buffer)
+
+	writer.Write([]byte("0123456789"))
+	require.Empty(t, buffer.String())
+	writer.Write([]byte("abcdefXYZ"))
+	require.Equal(t, "00000000  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|\n", buffer.String())
+
+	require.NoError(t, writer.Close())
+	require.Contains(t, buffer.String(), "00000010  58 59 5a")
+	require.True(t, bytes.HasSuffix(buffer.Bytes(), []byte("|XYZ|\n00000013\n")))
+}
+
+func TestHexWriterEmpty(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	require.NoError(t, hexwriter.New(buffer).Close())
+	require.Empty(t, buffer.String())
+}
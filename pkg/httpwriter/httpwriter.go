@@ -0,0 +1,417 @@
+package httpwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+	"github.com/ndau/writers/pkg/writers"
+)
+
+// Defaults for the options of an HTTPWriter
+const (
+	DefaultMaxLines   = 500
+	DefaultMaxBytes   = 1 << 20
+	DefaultInterval   = 5 * time.Second
+	DefaultAttempts   = 3
+	DefaultRetryDelay = time.Second
+)
+
+// ErrClosed is returned by writes to an HTTPWriter which has been closed.
+var ErrClosed = errors.New("httpwriter: write to closed writer")
+
+// Format determines how a batch of lines is encoded in the request body
+type Format int
+
+const (
+	// NDJSON sends one JSON value per line. Lines which are already valid
+	// JSON are sent as they are; other lines are wrapped as {"msg": line}.
+	NDJSON Format = iota
+	// PlainText sends the lines as they are
+	PlainText
+)
+
+var contentTypes = map[Format]string{
+	NDJSON:    "application/x-ndjson",
+	PlainText: "text/plain; charset=utf-8",
+}
+
+// StatusError is returned when the server responds with an error status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("httpwriter: server responded %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// HTTPWriter accumulates the lines written to it into batches, and POSTs
+// each batch to a URL. This turns anything which writes to an io.Writer
+// into a log shipper.
+//
+// A batch is sent when it reaches a maximum number of lines or bytes, when
+// a time interval has passed since its first line was written, or when
+// Flush or Close is called. Failed requests are retried, on network errors
+// and on 429 and 5xx responses. Because sending happens in the background
+// or as a side effect of writing, errors are passed to the error handler
+// rather than returned from Write.
+//
+// A batch which is sent because it's full is sent synchronously, during the
+// Write which filled it. To keep slow requests entirely off the caller's
+// path, wrap the HTTPWriter in an AsyncWriter. Requests are made without
+// holding the lock, so while one is in progress, other writes can carry on
+// filling the next batch; batches are still sent one at a time, in order.
+//
+// After all data has been written, the client must call Close to send the
+// final batch and stop the timer. HTTPWriter is safe for concurrent use.
+type HTTPWriter struct {
+	url        string
+	client     *http.Client
+	format     Format
+	gzip       bool
+	header     http.Header
+	maxLines   int
+	maxBytes   int
+	interval   time.Duration
+	attempts   int
+	retryDelay time.Duration
+	onError    func(error)
+	flushes    writers.FlushCounter
+
+	mutex  sync.Mutex
+	lines  *linebuffer.LineBuffer
+	batch  []byte
+	count  int
+	timer  *time.Timer
+	closed bool
+	// ready holds the batches which have been cut, but not yet taken by
+	// the caller which cut them to be sent
+	ready []batch
+	// next is the number of the next batch to be cut
+	next uint64
+
+	// sendMutex guards turn, the number of the next batch to be sent, and
+	// is held while a batch is being sent
+	sendMutex sync.Mutex
+	turned    *sync.Cond
+	turn      uint64
+}
+
+// batch is a batch of lines to send, numbered in order
+type batch struct {
+	lines  []byte
+	number uint64
+}
+
+// static assert that HTTPWriter is an io.WriteCloser
+var _ io.WriteCloser = (*HTTPWriter)(nil)
+
+// static assert that HTTPWriter implements Stats
+var _ writers.Stats = (*HTTPWriter)(nil)
+
+// Option configures an HTTPWriter
+type Option func(*HTTPWriter)
+
+// WithClient sets the http.Client used to send requests
+func WithClient(c *http.Client) Option {
+	return func(h *HTTPWriter) {
+		h.client = c
+	}
+}
+
+// WithFormat sets how batches are encoded; the default is NDJSON
+func WithFormat(f Format) Option {
+	return func(h *HTTPWriter) {
+		h.format = f
+	}
+}
+
+// WithGzip compresses request bodies with gzip
+func WithGzip() Option {
+	return func(h *HTTPWriter) {
+		h.gzip = true
+	}
+}
+
+// WithHeader adds a header to every request, for example for authorization
+func WithHeader(key, value string) Option {
+	return func(h *HTTPWriter) {
+		h.header.Add(key, value)
+	}
+}
+
+// WithBatchSize sets the maximum number of lines and bytes in a batch;
+// values less than 1 leave that limit unchanged
+func WithBatchSize(lines, bytes int) Option {
+	return func(h *HTTPWriter) {
+		if lines > 0 {
+			h.maxLines = lines
+		}
+		if bytes > 0 {
+			h.maxBytes = bytes
+		}
+	}
+}
+
+// WithInterval sets the longest time a line waits in a batch before the
+// batch is sent
+func WithInterval(d time.Duration) Option {
+	return func(h *HTTPWriter) {
+		h.interval = d
+	}
+}
+
+// WithRetries sets the number of attempts to send each batch, including
+// the first, and the delay between attempts
+func WithRetries(attempts int, delay time.Duration) Option {
+	return func(h *HTTPWriter) {
+		h.attempts = attempts
+		h.retryDelay = delay
+	}
+}
+
+// WithErrorHandler sets a function to be called when a batch can't be
+// sent. The batch is discarded.
+func WithErrorHandler(f func(error)) Option {
+	return func(h *HTTPWriter) {
+		h.onError = f
+	}
+}
+
+// New creates a new HTTPWriter which POSTs to url
+func New(url string, opts ...Option) *HTTPWriter {
+	h := &HTTPWriter{
+		url:        url,
+		client:     http.DefaultClient,
+		header:     make(http.Header),
+		maxLines:   DefaultMaxLines,
+		maxBytes:   DefaultMaxBytes,
+		interval:   DefaultInterval,
+		attempts:   DefaultAttempts,
+		retryDelay: DefaultRetryDelay,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.lines = linebuffer.New(h.add)
+	h.turned = sync.NewCond(&h.sendMutex)
+	return h
+}
+
+// Write adds every line completed by p to the current batch.
+func (h *HTTPWriter) Write(p []byte) (int, error) {
+	h.mutex.Lock()
+	if h.closed {
+		h.mutex.Unlock()
+		return 0, ErrClosed
+	}
+	n, err := h.lines.Write(p)
+	ready := h.takeReady()
+	h.mutex.Unlock()
+
+	h.send(ready)
+	return n, err
+}
+
+// Flush sends the current batch, including any partial line, and waits
+// for the request to complete.
+func (h *HTTPWriter) Flush() error {
+	h.mutex.Lock()
+	if h.closed {
+		h.mutex.Unlock()
+		return ErrClosed
+	}
+	ready := h.flush(writers.FlushExplicit)
+	h.mutex.Unlock()
+
+	return h.send(ready)
+}
+
+// Close sends the final batch, including any partial line, and stops the
+// timer. Further writes return ErrClosed.
+func (h *HTTPWriter) Close() error {
+	h.mutex.Lock()
+	if h.closed {
+		h.mutex.Unlock()
+		return nil
+	}
+	h.closed = true
+	ready := h.flush(writers.FlushClose)
+	h.mutex.Unlock()
+
+	return h.send(ready)
+}
+
+// FlushStats implements writers.Stats.
+//
+// Each batch sent counts as a flush: one sent because it was full is
+// recorded as FlushBufferFull.
+func (h *HTTPWriter) FlushStats() writers.FlushStats {
+	return h.flushes.FlushStats()
+}
+
+// add is the LineBuffer handler; it's called with the lock held
+func (h *HTTPWriter) add(line []byte) error {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	if h.format == NDJSON && !json.Valid(line) {
+		line, _ = json.Marshal(map[string]string{"msg": string(line)})
+	}
+
+	if h.count > 0 && len(h.batch)+len(line)+1 > h.maxBytes {
+		h.cut(writers.FlushBufferFull)
+	}
+	h.batch = append(h.batch, line...)
+	h.batch = append(h.batch, '\n')
+	h.count++
+
+	if h.count >= h.maxLines || len(h.batch) >= h.maxBytes {
+		h.cut(writers.FlushBufferFull)
+	} else if h.timer == nil && h.interval > 0 {
+		h.timer = time.AfterFunc(h.interval, h.onTimer)
+	}
+	return nil
+}
+
+func (h *HTTPWriter) onTimer() {
+	h.mutex.Lock()
+	h.timer = nil
+	if !h.closed {
+		h.cut(writers.FlushTimer)
+	}
+	ready := h.takeReady()
+	h.mutex.Unlock()
+
+	h.send(ready)
+}
+
+// flush cuts the partial line and the batch, and returns the batches to
+// send; it's called with the lock held
+func (h *HTTPWriter) flush(reason writers.FlushReason) []batch {
+	h.lines.Flush()
+	h.cut(reason)
+	return h.takeReady()
+}
+
+// cut ends the current batch, if there is one, and makes it ready to
+// send; it's called with the lock held
+func (h *HTTPWriter) cut(reason writers.FlushReason) {
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	if h.count == 0 {
+		return
+	}
+	h.ready = append(h.ready, batch{lines: h.batch, number: h.next})
+	h.next++
+	h.batch = nil
+	h.count = 0
+	h.flushes.Record(reason)
+}
+
+// takeReady returns the batches which are ready to send. It's called with
+// the lock held, by whoever took the lock to cut them.
+func (h *HTTPWriter) takeReady() []batch {
+	ready := h.ready
+	h.ready = nil
+	return ready
+}
+
+// send posts each batch, when its turn comes, and returns the first
+// error; it's called without the lock held
+func (h *HTTPWriter) send(batches []batch) (first error) {
+	for _, b := range batches {
+		if err := h.sendBatch(b); err != nil && first == nil {
+			first = err
+		}
+	}
+	return
+}
+
+func (h *HTTPWriter) sendBatch(b batch) error {
+	h.sendMutex.Lock()
+	defer h.sendMutex.Unlock()
+	for h.turn != b.number {
+		h.turned.Wait()
+	}
+	defer func() {
+		h.turn++
+		h.turned.Broadcast()
+	}()
+
+	body, err := h.encode(b.lines)
+	if err == nil {
+		for attempt := 1; ; attempt++ {
+			var retry bool
+			retry, err = h.post(body)
+			if err == nil || !retry || attempt >= h.attempts {
+				break
+			}
+			time.Sleep(h.retryDelay)
+		}
+	}
+	if err != nil && h.onError != nil {
+		h.onError(err)
+	}
+	return err
+}
+
+func (h *HTTPWriter) encode(batch []byte) ([]byte, error) {
+	if !h.gzip {
+		return batch, nil
+	}
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	if _, err := gz.Write(batch); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// post sends a single request, and reports whether it's worth retrying
+func (h *HTTPWriter) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for key, values := range h.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", contentTypes[h.format])
+	if h.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, &StatusError{StatusCode: resp.StatusCode}
+}
@@ -0,0 +1,185 @@
+package httpwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/httpwriter"
+	"github.com/ndau/writers/pkg/writers"
+	"github.com/stretchr/testify/require"
+)
+
+type request struct {
+	contentType string
+	body        string
+}
+
+// collector is a test server which records the requests it receives,
+// failing the first failures of them
+type collector struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests []request
+	failures int
+}
+
+func newCollector(t *testing.T) *collector {
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if c.failures > 0 {
+			c.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			body = gz
+		}
+		data, err := ioutil.ReadAll(body)
+		require.NoError(t, err)
+		c.requests = append(c.requests, request{r.Header.Get("Content-Type"), string(data)})
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *collector) received() []request {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]request(nil), c.requests...)
+}
+
+func TestHTTPWriterNDJSONBatches(t *testing.T) {
+	server := newCollector(t)
+	writer := httpwriter.New(server.URL, httpwriter.WithBatchSize(2, 0), httpwriter.WithInterval(0))
+
+	fmt.Fprint(writer, `{"level":"info"}`+"\nplain text\n")
+	fmt.Fprint(writer, "third")
+	require.Len(t, server.received(), 1)
+	require.NoError(t, writer.Close())
+
+	requests := server.received()
+	require.Len(t, requests, 2)
+	require.Equal(t, "application/x-ndjson", requests[0].contentType)
+	require.Equal(t, `{"level":"info"}`+"\n"+`{"msg":"plain text"}`+"\n", requests[0].body)
+	require.Equal(t, `{"msg":"third"}`+"\n", requests[1].body)
+
+	stats := writer.FlushStats()
+	require.Equal(t, uint64(1), stats[writers.FlushBufferFull])
+	require.Equal(t, uint64(1), stats[writers.FlushClose])
+
+	_, err := writer.Write([]byte("late\n"))
+	require.Equal(t, httpwriter.ErrClosed, err)
+}
+
+func TestHTTPWriterPlainGzip(t *testing.T) {
+	server := newCollector(t)
+	writer := httpwriter.New(server.URL,
+		httpwriter.WithFormat(httpwriter.PlainText),
+		httpwriter.WithGzip(),
+	)
+	fmt.Fprint(writer, "one\ntwo\n")
+	require.NoError(t, writer.Flush())
+
+	requests := server.received()
+	require.Len(t, requests, 1)
+	require.Equal(t, "text/plain; charset=utf-8", requests[0].contentType)
+	require.Equal(t, "one\ntwo\n", requests[0].body)
+	require.NoError(t, writer.Close())
+	require.Len(t, server.received(), 1)
+}
+
+func TestHTTPWriterInterval(t *testing.T) {
+	server := newCollector(t)
+	writer := httpwriter.New(server.URL, httpwriter.WithInterval(20*time.Millisecond))
+	defer writer.Close()
+
+	fmt.Fprint(writer, "eventually\n")
+	require.Eventually(t, func() bool { return len(server.received()) == 1 }, time.Second, 5*time.Millisecond)
+	require.Equal(t, uint64(1), writer.FlushStats()[writers.FlushTimer])
+}
+
+func TestHTTPWriterRetries(t *testing.T) {
+	server := newCollector(t)
+	server.failures = 2
+	writer := httpwriter.New(server.URL, httpwriter.WithRetries(3, time.Millisecond))
+	fmt.Fprint(writer, "persistent\n")
+	require.NoError(t, writer.Close())
+	require.Len(t, server.received(), 1)
+}
+
+func TestHTTPWriterErrorHandler(t *testing.T) {
+	server := newCollector(t)
+	server.failures = 5
+	var errs []error
+	writer := httpwriter.New(server.URL,
+		httpwriter.WithRetries(2, time.Millisecond),
+		httpwriter.WithErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+	fmt.Fprint(writer, "doomed\n")
+	err := writer.Close()
+	require.Equal(t, &httpwriter.StatusError{StatusCode: http.StatusServiceUnavailable}, err)
+	require.Equal(t, []error{err}, errs)
+	require.Empty(t, server.received())
+}
+
+func TestHTTPWriterSlowServerDoesNotBlockWrites(t *testing.T) {
+	gate := make(chan struct{})
+	entered := make(chan struct{}, 10)
+	var mutex sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-gate
+		data, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		bodies = append(bodies, string(data))
+	}))
+	defer server.Close()
+	writer := httpwriter.New(server.URL,
+		httpwriter.WithFormat(httpwriter.PlainText),
+		httpwriter.WithInterval(5*time.Millisecond),
+	)
+
+	fmt.Fprint(writer, "first\n")
+	// the timer is now sending the first batch, which the server holds up
+	<-entered
+
+	written := make(chan struct{})
+	go func() {
+		fmt.Fprint(writer, "second\n")
+		close(written)
+	}()
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		t.Fatal("Write blocked behind a slow request")
+	}
+
+	close(gate)
+	require.NoError(t, writer.Close())
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Equal(t, []string{"first\n", "second\n"}, bodies)
+}
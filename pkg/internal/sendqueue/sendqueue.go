@@ -0,0 +1,267 @@
+package sendqueue
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ndau/writers/pkg/writers"
+)
+
+// Conn is a connection which messages can be sent over
+type Conn interface {
+	Send(msg []byte) error
+	Close() error
+}
+
+// Config configures a Queue
+type Config struct {
+	// Dial opens a new connection
+	Dial func() (Conn, error)
+	// Size is the number of messages which can wait to be sent
+	Size int
+	// DropNewest discards the message being put when the queue is full,
+	// instead of the oldest one
+	DropNewest bool
+	// Backoff is the delay after the first failure to dial or send, which
+	// doubles after each consecutive failure up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// OnState, if set, is called whenever the connection goes up or down;
+	// when it goes down, err explains why
+	OnState func(connected bool, err error)
+	// OnError, if set, is called whenever a message can't be sent, with
+	// the number of bytes given up on, which is 0 if msg will be retried,
+	// and whenever Put drops a message, with writers.ErrQueueFull
+	OnError func(err error, lost int, msg []byte)
+}
+
+// Queue holds messages waiting to be sent, and a goroutine which sends
+// them in order, dialling the connection when needed and reconnecting,
+// with exponential backoff, when it breaks. The backoff only resets once
+// a message has been sent, so a peer which accepts connections but fails
+// every send doesn't cause a busy reconnect loop.
+//
+// A message whose send fails is sent again in full on the next connection.
+// Once the Queue is stopped, it doesn't wait for a broken connection to
+// recover: if it can't dial, or a message fails a second time, whatever is
+// left is dropped.
+//
+// NetWriter and WSWriter are built on a Queue. It's safe for concurrent
+// use.
+type Queue struct {
+	Config
+	dropped uint64
+
+	mutex   sync.Mutex
+	queue   [][]byte
+	stopped bool
+	notify  chan struct{}
+	closing chan struct{}
+	done    chan struct{}
+}
+
+// New creates a new Queue and starts its goroutine
+func New(cfg Config) *Queue {
+	q := &Queue{
+		Config:  cfg,
+		notify:  make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Put queues msg, which the Queue then owns. If the queue is full, a
+// message is dropped according to DropNewest.
+func (q *Queue) Put(msg []byte) {
+	if dropped := q.put(msg); dropped != nil {
+		q.report(writers.ErrQueueFull, len(dropped), dropped)
+	}
+}
+
+// put queues msg, and returns the message it dropped, if any
+func (q *Queue) put(msg []byte) (dropped []byte) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.queue) >= q.Size {
+		atomic.AddUint64(&q.dropped, 1)
+		if q.DropNewest {
+			return msg
+		}
+		dropped = q.queue[0]
+		q.queue[0] = nil
+		q.queue = q.queue[1:]
+	}
+	q.queue = append(q.queue, msg)
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return
+}
+
+// Stop tells the goroutine to stop once it has sent or dropped everything
+// queued. It reports whether the Queue was running.
+func (q *Queue) Stop() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.stopped {
+		return false
+	}
+	q.stopped = true
+	close(q.closing)
+	return true
+}
+
+// Stopped reports whether Stop has been called
+func (q *Queue) Stopped() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.stopped
+}
+
+// Wait waits for the goroutine to finish after Stop
+func (q *Queue) Wait() {
+	<-q.done
+}
+
+// Dropped returns the number of messages discarded so far
+func (q *Queue) Dropped() uint64 {
+	return atomic.LoadUint64(&q.dropped)
+}
+
+// take waits for the next message to send. It returns false once the
+// Queue is stopped and empty.
+func (q *Queue) take() ([]byte, bool) {
+	for {
+		q.mutex.Lock()
+		if len(q.queue) > 0 {
+			msg := q.queue[0]
+			q.queue[0] = nil
+			q.queue = q.queue[1:]
+			q.mutex.Unlock()
+			return msg, true
+		}
+		stopped := q.stopped
+		q.mutex.Unlock()
+		if stopped {
+			return nil, false
+		}
+
+		select {
+		case <-q.notify:
+		case <-q.closing:
+		}
+	}
+}
+
+// drain drops msg and everything left in the queue, and reports their
+// total size in bytes as lost
+func (q *Queue) drain(err error, msg []byte) {
+	q.mutex.Lock()
+	lost := len(msg)
+	for _, m := range q.queue {
+		lost += len(m)
+	}
+	atomic.AddUint64(&q.dropped, uint64(len(q.queue)+1))
+	q.queue = nil
+	q.mutex.Unlock()
+	q.report(err, lost, msg)
+}
+
+func (q *Queue) state(connected bool, err error) {
+	if q.OnState != nil {
+		q.OnState(connected, err)
+	}
+}
+
+func (q *Queue) report(err error, lost int, msg []byte) {
+	if q.OnError != nil {
+		q.OnError(err, lost, msg)
+	}
+}
+
+// pause waits for delay, or until the Queue is stopped, and returns the
+// next delay
+func (q *Queue) pause(delay time.Duration) time.Duration {
+	select {
+	case <-time.After(delay):
+	case <-q.closing:
+	}
+	delay *= 2
+	if delay > q.MaxBackoff {
+		delay = q.MaxBackoff
+	}
+	return delay
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	var conn Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	var msg []byte
+	// failed is set when msg has already failed to send once
+	var failed bool
+	delay := q.Backoff
+	for {
+		if msg == nil {
+			var ok bool
+			if msg, ok = q.take(); !ok {
+				return
+			}
+		}
+
+		if conn == nil {
+			var err error
+			if conn, err = q.Dial(); err != nil {
+				conn = nil
+				if q.Stopped() {
+					// don't wait around for a broken connection to recover
+					q.drain(err, msg)
+					return
+				}
+				q.report(err, 0, msg)
+				delay = q.pause(delay)
+				continue
+			}
+			q.state(true, nil)
+		}
+
+		if err := conn.Send(msg); err != nil {
+			conn.Close()
+			conn = nil
+			q.state(false, err)
+			if failed && q.Stopped() {
+				// the message gets one more try on a new connection, but
+				// a stopped Queue doesn't wait for the peer to recover
+				q.drain(err, msg)
+				return
+			}
+			q.report(err, 0, msg)
+			failed = true
+			delay = q.pause(delay)
+			continue
+		}
+		msg = nil
+		failed = false
+		delay = q.Backoff
+	}
+}
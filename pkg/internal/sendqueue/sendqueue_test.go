@@ -0,0 +1,134 @@
+package sendqueue_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/internal/sendqueue"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyConn fails its first failures sends
+type flakyConn struct {
+	lock     *sync.Mutex
+	failures *int
+	sent     *[]string
+}
+
+func (c flakyConn) Send(msg []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if *c.failures > 0 {
+		*c.failures--
+		return errors.New("connection reset")
+	}
+	*c.sent = append(*c.sent, string(msg))
+	return nil
+}
+
+func (c flakyConn) Close() error {
+	return nil
+}
+
+type report struct {
+	lost int
+	msg  string
+}
+
+func TestQueueRetriesWithBackoff(t *testing.T) {
+	var lock sync.Mutex
+	failures := 2
+	var sent []string
+	var reports []report
+	var delays []time.Duration
+	last := time.Now()
+	q := sendqueue.New(sendqueue.Config{
+		Dial: func() (sendqueue.Conn, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			now := time.Now()
+			delays = append(delays, now.Sub(last))
+			last = now
+			return flakyConn{&lock, &failures, &sent}, nil
+		},
+		Size:       10,
+		Backoff:    5 * time.Millisecond,
+		MaxBackoff: time.Second,
+		OnError: func(err error, lost int, msg []byte) {
+			reports = append(reports, report{lost, string(msg)})
+		},
+	})
+	q.Put([]byte("a"))
+	q.Put([]byte("b"))
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(sent) == 2
+	}, time.Second, time.Millisecond)
+	q.Stop()
+	q.Wait()
+
+	require.Equal(t, []string{"a", "b"}, sent)
+	require.Equal(t, []report{{0, "a"}, {0, "a"}}, reports)
+	require.Len(t, delays, 3)
+	// the delay doubles after each failed send
+	require.GreaterOrEqual(t, int64(delays[1]), int64(5*time.Millisecond))
+	require.GreaterOrEqual(t, int64(delays[2]), int64(10*time.Millisecond))
+}
+
+func TestQueueStopDropsAfterSecondFailure(t *testing.T) {
+	var lock sync.Mutex
+	failures := 100
+	var sent []string
+	var reports []report
+	q := sendqueue.New(sendqueue.Config{
+		Dial: func() (sendqueue.Conn, error) {
+			return flakyConn{&lock, &failures, &sent}, nil
+		},
+		Size:       10,
+		Backoff:    time.Hour,
+		MaxBackoff: time.Hour,
+		OnError: func(err error, lost int, msg []byte) {
+			reports = append(reports, report{lost, string(msg)})
+		},
+	})
+	q.Put([]byte("aa"))
+	q.Put([]byte("bbb"))
+	require.True(t, q.Stop())
+	require.False(t, q.Stop())
+	q.Wait()
+
+	require.Empty(t, sent)
+	require.Equal(t, uint64(2), q.Dropped())
+	require.Equal(t, report{5, "aa"}, reports[len(reports)-1])
+}
+
+func TestQueueDropNewest(t *testing.T) {
+	q := sendqueue.New(sendqueue.Config{
+		Dial: func() (sendqueue.Conn, error) {
+			return nil, errors.New("connection refused")
+		},
+		Size:       1,
+		DropNewest: true,
+		Backoff:    time.Hour,
+		MaxBackoff: time.Hour,
+	})
+	q.Put([]byte("a"))
+	q.Put([]byte("b"))
+	q.Put([]byte("c"))
+	q.Stop()
+	q.Wait()
+	require.Equal(t, uint64(3), q.Dropped())
+}
@@ -0,0 +1,207 @@
+package jsonbuffer
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"io"
+)
+
+// DefaultMaxValueSize is the default size after which a value which hasn't
+// closed is given up on and passed to the handler as text
+const DefaultMaxValueSize = 1 << 20
+
+type state int
+
+const (
+	lineStart  state = iota // only whitespace so far on this line
+	text                    // a line which isn't JSON
+	value                   // inside a JSON object or array
+	afterValue              // after a value, before the end of its line
+)
+
+// JSONBuffer is an io.Writer which splits the data written to it into
+// segments which are either complete top-level JSON values or lines of
+// text, and passes each segment to a handler function.
+//
+// A JSON value is an object or array which starts a line, possibly after
+// whitespace. It may span many lines, as pretty-printed JSON does; the
+// buffer tracks nesting, strings and escapes across Write calls to find
+// where it ends. Only structure is checked, so handlers which care should
+// validate the value with json.Valid. Everything else is passed on a line
+// at a time.
+//
+// The segments cover the input exactly: a JSON segment includes any
+// whitespace around the value, and the newline ending its line if nothing
+// else follows it. If something else does, that's the start of the next
+// segment. The slice passed to the handler is only valid for the duration
+// of the call.
+//
+// A value which is still open after MaxValueSize bytes is passed to the
+// handler as text, along with the rest of the line it's on.
+//
+// After all data has been written, the client should call Flush to pass
+// any incomplete segment to the handler. JSONBuffer is the building block
+// for the JSON-oriented writers in this repository. It is not safe for
+// concurrent use.
+type JSONBuffer struct {
+	handler func(segment []byte, isJSON bool) error
+	// MaxValueSize is the length after which an unclosed value is treated
+	// as text
+	MaxValueSize int
+
+	buf      []byte
+	state    state
+	depth    int
+	inString bool
+	escape   bool
+}
+
+// static assert that JSONBuffer is an io.Writer
+var _ io.Writer = (*JSONBuffer)(nil)
+
+// New creates a new JSONBuffer which calls handler for every segment
+func New(handler func(segment []byte, isJSON bool) error) *JSONBuffer {
+	return &JSONBuffer{
+		handler:      handler,
+		MaxValueSize: DefaultMaxValueSize,
+	}
+}
+
+// Write writes the contents of p, calling the handler for every segment
+// completed by it.
+//
+// If the handler returns an error, the segment it was handling is
+// discarded and Write returns immediately. In that case, n is the number
+// of bytes of p which were consumed before the failed segment started.
+func (b *JSONBuffer) Write(p []byte) (n int, err error) {
+	// fromP counts the bytes of buf which came from p
+	fromP := 0
+	for i, c := range p {
+		b.buf = append(b.buf, c)
+		fromP++
+
+		end, isJSON := b.step(c)
+		if end == 0 {
+			continue
+		}
+		rest := len(b.buf) - end
+		if err = b.emit(end, isJSON); err != nil {
+			n = i + 1 - fromP
+			if n < 0 {
+				n = 0
+			}
+			return
+		}
+		fromP = rest
+		if rest > 0 {
+			// the byte which ended the segment starts the next one
+			b.step(c)
+		}
+	}
+	return len(p), nil
+}
+
+// step advances the state machine over c, which is the last byte of buf.
+// If c completes a segment, it returns the segment's length.
+func (b *JSONBuffer) step(c byte) (end int, isJSON bool) {
+	switch b.state {
+	case lineStart:
+		switch c {
+		case ' ', '\t', '\r':
+		case '\n':
+			return len(b.buf), false
+		case '{', '[':
+			b.state = value
+			b.depth = 1
+		default:
+			b.state = text
+		}
+
+	case text:
+		if c == '\n' {
+			return len(b.buf), false
+		}
+
+	case value:
+		switch {
+		case b.escape:
+			b.escape = false
+		case b.inString:
+			switch c {
+			case '\\':
+				b.escape = true
+			case '"':
+				b.inString = false
+			}
+		case c == '"':
+			b.inString = true
+		case c == '{' || c == '[':
+			b.depth++
+		case c == '}' || c == ']':
+			b.depth--
+			if b.depth == 0 {
+				b.state = afterValue
+			}
+		}
+		if b.state == value && len(b.buf) > b.MaxValueSize {
+			b.state = text
+			b.inString = false
+			b.escape = false
+			if c == '\n' {
+				return len(b.buf), false
+			}
+		}
+
+	case afterValue:
+		switch c {
+		case ' ', '\t', '\r':
+		case '\n':
+			return len(b.buf), true
+		default:
+			return len(b.buf) - 1, true
+		}
+	}
+	return 0, false
+}
+
+// emit passes the first end bytes of buf to the handler, and keeps the rest
+func (b *JSONBuffer) emit(end int, isJSON bool) error {
+	err := b.handler(b.buf[:end], isJSON)
+	rest := copy(b.buf, b.buf[end:])
+	b.buf = b.buf[:rest]
+	b.state = lineStart
+	b.depth = 0
+	return err
+}
+
+// Flush passes any buffered segment to the handler: a value which has
+// closed is passed as JSON, and anything else as text.
+//
+// It is a no-op if nothing is buffered.
+func (b *JSONBuffer) Flush() error {
+	if len(b.buf) == 0 {
+		return nil
+	}
+	isJSON := b.state == afterValue
+	b.inString = false
+	b.escape = false
+	return b.emit(len(b.buf), isJSON)
+}
+
+// Buffered returns the number of bytes waiting for the end of a segment.
+func (b *JSONBuffer) Buffered() int {
+	return len(b.buf)
+}
+
+// InValue reports whether a JSON value has started but not yet closed
+func (b *JSONBuffer) InValue() bool {
+	return b.state == value
+}
@@ -0,0 +1,124 @@
+package jsonbuffer_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ndau/writers/pkg/jsonbuffer"
+	"github.com/stretchr/testify/require"
+)
+
+type segment struct {
+	text   string
+	isJSON bool
+}
+
+func collect() (*[]segment, func([]byte, bool) error) {
+	segments := []segment{}
+	return &segments, func(seg []byte, isJSON bool) error {
+		segments = append(segments, segment{string(seg), isJSON})
+		return nil
+	}
+}
+
+func TestJSONBufferSegments(t *testing.T) {
+	input := "" +
+		"starting up\n" +
+		"{\n  \"a\": \"}\\\"{\",\n  \"b\": [1, {\"c\": 2}]\n}\n" +
+		"\n" +
+		"  [1,2]  \n" +
+		"{\"x\":1}{\"y\":2} trailing\n" +
+		"done"
+	// every split of the input gives the same segments
+	for size := 1; size <= len(input); size++ {
+		segments, handler := collect()
+		buffer := jsonbuffer.New(handler)
+		for i := 0; i < len(input); i += size {
+			end := i + size
+			if end > len(input) {
+				end = len(input)
+			}
+			n, err := buffer.Write([]byte(input[i:end]))
+			require.NoError(t, err)
+			require.Equal(t, end-i, n)
+		}
+		require.Equal(t, 4, buffer.Buffered())
+		require.NoError(t, buffer.Flush())
+		require.Equal(t, []segment{
+			{"starting up\n", false},
+			{"{\n  \"a\": \"}\\\"{\",\n  \"b\": [1, {\"c\": 2}]\n}\n", true},
+			{"\n", false},
+			{"  [1,2]  \n", true},
+			{"{\"x\":1}", true},
+			{"{\"y\":2} ", true},
+			{"trailing\n", false},
+			{"done", false},
+		}, *segments, "size %d", size)
+
+		var sb strings.Builder
+		for _, seg := range *segments {
+			sb.WriteString(seg.text)
+		}
+		require.Equal(t, input, sb.String())
+	}
+}
+
+func TestJSONBufferFlush(t *testing.T) {
+	segments, handler := collect()
+	buffer := jsonbuffer.New(handler)
+	buffer.Write([]byte(`{"a":1}`))
+	require.False(t, buffer.InValue())
+	require.NoError(t, buffer.Flush())
+	buffer.Write([]byte(`{"a":`))
+	require.True(t, buffer.InValue())
+	require.NoError(t, buffer.Flush())
+	require.False(t, buffer.InValue())
+	buffer.Write([]byte("[]\n"))
+	require.Equal(t, []segment{
+		{`{"a":1}`, true},
+		{`{"a":`, false},
+		{"[]\n", true},
+	}, *segments)
+}
+
+func TestJSONBufferMaxValueSize(t *testing.T) {
+	segments, handler := collect()
+	buffer := jsonbuffer.New(handler)
+	buffer.MaxValueSize = 10
+	buffer.Write([]byte("{not json at all\n{\"ok\":true}\n"))
+	require.Equal(t, []segment{
+		{"{not json at all\n", false},
+		{"{\"ok\":true}\n", true},
+	}, *segments)
+}
+
+func TestJSONBufferHandlerError(t *testing.T) {
+	failure := errors.New("failure")
+	buffer := jsonbuffer.New(func(seg []byte, isJSON bool) error {
+		if isJSON {
+			return failure
+		}
+		return nil
+	})
+	n, err := buffer.Write([]byte("text\n{}\nmore\n"))
+	require.Equal(t, failure, err)
+	require.Equal(t, 5, n)
+	require.Zero(t, buffer.Buffered())
+
+	buffer.Write([]byte("{}"))
+	n, err = buffer.Write([]byte(" x\n"))
+	require.Equal(t, failure, err)
+	require.Equal(t, 0, n)
+	require.Equal(t, 1, buffer.Buffered())
+}
@@ -0,0 +1,121 @@
+package jsonfmtwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/ndau/writers/pkg/jsonbuffer"
+)
+
+// DefaultIndent is the indentation used by Indent mode unless another is
+// configured with WithIndent
+const DefaultIndent = "  "
+
+// Mode determines how a JSONFmtWriter reformats JSON
+type Mode int
+
+const (
+	// Indent pretty-prints each value over several lines
+	Indent Mode = iota
+	// Compact writes each value on a single line, producing NDJSON
+	Compact
+)
+
+// JSONFmtWriter detects the JSON objects and arrays in the stream written
+// to it, including pretty-printed ones spanning several lines, and
+// re-emits them pretty-printed or compacted, each followed by a newline.
+// Lines which aren't JSON, and values which turn out to be invalid, are
+// passed through unchanged.
+//
+// This is handy for making NDJSON service logs readable on a terminal, or
+// squeezing pretty-printed output back into NDJSON. Values are detected as
+// for a JSONBuffer.
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush method to write anything still buffered.
+//
+// JSONFmtWriter is not safe for concurrent use.
+type JSONFmtWriter struct {
+	w      io.Writer
+	mode   Mode
+	prefix string
+	indent string
+	values *jsonbuffer.JSONBuffer
+	out    bytes.Buffer
+}
+
+// static assert that JSONFmtWriter is an io.Writer
+var _ io.Writer = (*JSONFmtWriter)(nil)
+
+// Option configures a JSONFmtWriter
+type Option func(*JSONFmtWriter)
+
+// WithIndent sets the prefix and indentation used in Indent mode, as for
+// json.Indent
+func WithIndent(prefix, indent string) Option {
+	return func(j *JSONFmtWriter) {
+		j.prefix = prefix
+		j.indent = indent
+	}
+}
+
+// New creates a new JSONFmtWriter
+func New(w io.Writer, mode Mode, opts ...Option) *JSONFmtWriter {
+	j := &JSONFmtWriter{
+		w:      w,
+		mode:   mode,
+		indent: DefaultIndent,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	j.values = jsonbuffer.New(j.format)
+	return j
+}
+
+// Write writes the contents of p, reformatting every JSON value completed
+// by it
+func (j *JSONFmtWriter) Write(p []byte) (int, error) {
+	return j.values.Write(p)
+}
+
+// Flush writes anything still buffered, reformatting it if it's a
+// complete value
+func (j *JSONFmtWriter) Flush() error {
+	return j.values.Flush()
+}
+
+// Unwrap returns the underlying writer
+func (j *JSONFmtWriter) Unwrap() io.Writer {
+	return j.w
+}
+
+// format is the JSONBuffer handler
+func (j *JSONFmtWriter) format(segment []byte, isJSON bool) error {
+	value := bytes.TrimSpace(segment)
+	if !isJSON || !json.Valid(value) {
+		_, err := j.w.Write(segment)
+		return err
+	}
+
+	j.out.Reset()
+	if j.mode == Compact {
+		json.Compact(&j.out, value)
+	} else {
+		json.Indent(&j.out, value, j.prefix, j.indent)
+	}
+	j.out.WriteByte('\n')
+	_, err := j.w.Write(j.out.Bytes())
+	return err
+}
@@ -0,0 +1,48 @@
+package jsonfmtwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ndau/writers/pkg/jsonfmtwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONFmtWriterIndent(t *testing.T) {
+	var sb strings.Builder
+	j := jsonfmtwriter.New(&sb, jsonfmtwriter.Indent)
+	j.Write([]byte(`starting` + "\n" + `{"level":"info","tags":["a","b"]}` + "\n"))
+	j.Write([]byte(`{"broken": }` + "\n" + `[1,`))
+	j.Write([]byte(`2]`))
+	require.NoError(t, j.Flush())
+	require.Equal(t, ""+
+		"starting\n"+
+		"{\n  \"level\": \"info\",\n  \"tags\": [\n    \"a\",\n    \"b\"\n  ]\n}\n"+
+		"{\"broken\": }\n"+
+		"[\n  1,\n  2\n]\n",
+		sb.String())
+}
+
+func TestJSONFmtWriterCompact(t *testing.T) {
+	var sb strings.Builder
+	j := jsonfmtwriter.New(&sb, jsonfmtwriter.Compact)
+	j.Write([]byte("{\n  \"a\": 1,\n  \"b\": \"x y\"\n}\nplain text\n"))
+	require.Equal(t, "{\"a\":1,\"b\":\"x y\"}\nplain text\n", sb.String())
+}
+
+func TestJSONFmtWriterWithIndent(t *testing.T) {
+	var sb strings.Builder
+	j := jsonfmtwriter.New(&sb, jsonfmtwriter.Indent, jsonfmtwriter.WithIndent("> ", "\t"))
+	j.Write([]byte(`{"a":1}` + "\n"))
+	require.Equal(t, "{\n> \t\"a\": 1\n> }\n", sb.String())
+}
@@ -0,0 +1,164 @@
+package jsonlwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+)
+
+// DefaultTimeLayout is the layout of the ts field unless another is
+// configured with WithTimeLayout
+const DefaultTimeLayout = time.RFC3339Nano
+
+// JSONLWriter wraps each completed line written to it in a JSON object,
+// and writes it as a line of NDJSON:
+//
+//	{"ts":"2020-03-04T05:06:07.89Z","stream":"stdout","msg":"the line"}
+//
+// The stream field is only present when configured. It and any static
+// fields come between ts and msg, in the order their options are given.
+// Invalid UTF-8 in a line is replaced with U+FFFD, so the output is always
+// valid JSON. This is the bridge between the output of a subprocess and a
+// structured log collector.
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush method to wrap any partial line.
+//
+// JSONLWriter is not safe for concurrent use.
+type JSONLWriter struct {
+	w      io.Writer
+	lines  *linebuffer.LineBuffer
+	layout string
+	utc    bool
+	fields []field
+	now    func() time.Time
+	out    []byte
+}
+
+type field struct {
+	key   string
+	value json.RawMessage
+}
+
+// static assert that JSONLWriter is an io.Writer
+var _ io.Writer = (*JSONLWriter)(nil)
+
+// Option configures a JSONLWriter
+type Option func(*JSONLWriter)
+
+// WithStream sets the stream field, typically "stdout" or "stderr"
+func WithStream(name string) Option {
+	return WithField("stream", name)
+}
+
+// WithField adds a static field to every object. Fields appear in the
+// order they're added. A value which can't be marshaled to JSON is written
+// as a string, formatted with fmt.Sprint.
+func WithField(key string, value interface{}) Option {
+	return func(j *JSONLWriter) {
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		j.fields = append(j.fields, field{key, v})
+	}
+}
+
+// WithTimeLayout sets the layout of the ts field, as for time.Format. An
+// empty layout leaves out the ts field.
+func WithTimeLayout(layout string) Option {
+	return func(j *JSONLWriter) {
+		j.layout = layout
+	}
+}
+
+// WithUTC writes timestamps in UTC rather than local time
+func WithUTC() Option {
+	return func(j *JSONLWriter) {
+		j.utc = true
+	}
+}
+
+// New creates a new JSONLWriter
+func New(w io.Writer, opts ...Option) *JSONLWriter {
+	j := &JSONLWriter{
+		w:      w,
+		layout: DefaultTimeLayout,
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	j.lines = linebuffer.New(j.wrap)
+	return j
+}
+
+// Write writes the contents of p, writing an object for every line
+// completed by it
+func (j *JSONLWriter) Write(p []byte) (int, error) {
+	return j.lines.Write(p)
+}
+
+// Flush wraps any partial line
+func (j *JSONLWriter) Flush() error {
+	return j.lines.Flush()
+}
+
+// Unwrap returns the underlying writer
+func (j *JSONLWriter) Unwrap() io.Writer {
+	return j.w
+}
+
+// wrap is the LineBuffer handler
+func (j *JSONLWriter) wrap(line []byte) error {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+
+	j.out = append(j.out[:0], '{')
+	if j.layout != "" {
+		now := j.now()
+		if j.utc {
+			now = now.UTC()
+		}
+		j.out = appendKey(j.out, "ts")
+		ts, _ := json.Marshal(now.Format(j.layout))
+		j.out = append(j.out, ts...)
+	}
+	for _, f := range j.fields {
+		j.out = appendKey(j.out, f.key)
+		j.out = append(j.out, f.value...)
+	}
+	j.out = appendKey(j.out, "msg")
+	// strings are always marshaled successfully
+	msg, _ := json.Marshal(string(line))
+	j.out = append(j.out, msg...)
+	j.out = append(j.out, '}', '\n')
+
+	_, err := j.w.Write(j.out)
+	return err
+}
+
+// appendKey appends a key and colon, preceded by a comma unless it's the
+// first key in the object
+func appendKey(dst []byte, key string) []byte {
+	if len(dst) > 0 && dst[len(dst)-1] != '{' {
+		dst = append(dst, ',')
+	}
+	k, _ := json.Marshal(key)
+	dst = append(dst, k...)
+	return append(dst, ':')
+}
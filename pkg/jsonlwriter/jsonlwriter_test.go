@@ -0,0 +1,56 @@
+package jsonlwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testTime = time.Date(2020, 3, 4, 5, 6, 7, 890000000, time.FixedZone("X", 3600))
+
+func TestJSONLWriter(t *testing.T) {
+	var sb strings.Builder
+	j := New(&sb, WithStream("stdout"), WithField("host", "web1"), WithField("pid", 42))
+	j.now = func() time.Time { return testTime }
+	_, err := j.Write([]byte("hello \"world\"\r\nbad \xff utf8\npartial"))
+	require.NoError(t, err)
+	require.NoError(t, j.Flush())
+	require.Equal(t, ""+
+		`{"ts":"2020-03-04T05:06:07.89+01:00","stream":"stdout","host":"web1","pid":42,"msg":"hello \"world\""}`+"\n"+
+		`{"ts":"2020-03-04T05:06:07.89+01:00","stream":"stdout","host":"web1","pid":42,"msg":"bad � utf8"}`+"\n"+
+		`{"ts":"2020-03-04T05:06:07.89+01:00","stream":"stdout","host":"web1","pid":42,"msg":"partial"}`+"\n",
+		sb.String())
+
+	scanner := bufio.NewScanner(strings.NewReader(sb.String()))
+	for scanner.Scan() {
+		require.True(t, json.Valid(scanner.Bytes()))
+	}
+}
+
+func TestJSONLWriterTimeLayout(t *testing.T) {
+	var sb strings.Builder
+	j := New(&sb, WithTimeLayout(time.Kitchen), WithUTC())
+	j.now = func() time.Time { return testTime }
+	j.Write([]byte("x\n"))
+	require.Equal(t, `{"ts":"4:06AM","msg":"x"}`+"\n", sb.String())
+
+	sb.Reset()
+	j = New(&sb, WithTimeLayout(""), WithField("bad", func() {}))
+	j.Write([]byte("x\n"))
+	require.True(t, strings.HasPrefix(sb.String(), `{"bad":"0x`))
+	require.True(t, strings.HasSuffix(sb.String(), `","msg":"x"}`+"\n"))
+}
@@ -0,0 +1,94 @@
+package jsonwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"io"
+
+	"github.com/ndau/writers/pkg/jsonbuffer"
+)
+
+// JSONWriter wraps an io.Writer and buffers output to it, like LineWriter,
+// but flushes at the end of each complete top-level JSON value rather than
+// at every newline.
+//
+// This keeps pretty-printed JSON, with its embedded newlines, together in
+// a single write to the underlying writer. Nesting, strings and escapes are
+// tracked across Write calls, as described for JSONBuffer. Text which isn't
+// part of a JSON value is flushed a line at a time, as LineWriter would.
+//
+// A value is flushed at the end of the line it closes on, along with that
+// newline, or when something else starts on the same line. Like LineWriter,
+// after all data has been written, the client should call the Flush method
+// to guarantee that all data has been forwarded to the underlying
+// io.Writer.
+//
+// JSONWriter is not safe for concurrent use.
+type JSONWriter struct {
+	w      io.Writer
+	values *jsonbuffer.JSONBuffer
+}
+
+// static assert that JSONWriter is an io.Writer
+var _ io.Writer = (*JSONWriter)(nil)
+
+// Option configures a JSONWriter
+type Option func(*JSONWriter)
+
+// WithMaxValueSize sets the size after which a value which hasn't closed
+// is flushed anyway, and the rest of it treated as text. The default is
+// jsonbuffer.DefaultMaxValueSize.
+func WithMaxValueSize(n int) Option {
+	return func(j *JSONWriter) {
+		j.values.MaxValueSize = n
+	}
+}
+
+// New creates a new JSONWriter
+func New(w io.Writer, opts ...Option) *JSONWriter {
+	j := &JSONWriter{w: w}
+	j.values = jsonbuffer.New(j.forward)
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+// Write writes the contents of p, flushing every value or line of text
+// completed by it.
+//
+// It returns the number of bytes written. If n < len(p), it also returns
+// an error explaining why the write is short.
+func (j *JSONWriter) Write(p []byte) (int, error) {
+	return j.values.Write(p)
+}
+
+// Flush writes any buffered data to the underlying io.Writer, even if it's
+// an incomplete value.
+func (j *JSONWriter) Flush() error {
+	return j.values.Flush()
+}
+
+// Buffered returns the number of bytes waiting to be flushed
+func (j *JSONWriter) Buffered() int {
+	return j.values.Buffered()
+}
+
+// Unwrap returns the underlying writer
+func (j *JSONWriter) Unwrap() io.Writer {
+	return j.w
+}
+
+// forward is the JSONBuffer handler
+func (j *JSONWriter) forward(segment []byte, isJSON bool) error {
+	_, err := j.w.Write(segment)
+	return err
+}
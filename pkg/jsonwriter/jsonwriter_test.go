@@ -0,0 +1,57 @@
+package jsonwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"testing"
+
+	"github.com/ndau/writers/pkg/jsonwriter"
+	"github.com/stretchr/testify/require"
+)
+
+// chunks records each write it receives
+type chunks struct {
+	writes []string
+}
+
+func (c *chunks) Write(p []byte) (int, error) {
+	c.writes = append(c.writes, string(p))
+	return len(p), nil
+}
+
+func TestJSONWriterFlushesValues(t *testing.T) {
+	var c chunks
+	j := jsonwriter.New(&c)
+	pretty := "{\n  \"msg\": \"line one\\nline two {\",\n  \"n\": [\n    1\n  ]\n}\n"
+	for i := 0; i < len(pretty); i += 5 {
+		end := i + 5
+		if end > len(pretty) {
+			end = len(pretty)
+		}
+		n, err := j.Write([]byte(pretty[i:end]))
+		require.NoError(t, err)
+		require.Equal(t, end-i, n)
+	}
+	require.Equal(t, []string{pretty}, c.writes)
+
+	j.Write([]byte("plain\ntext\n[1,"))
+	require.Equal(t, []string{pretty, "plain\n", "text\n"}, c.writes)
+	require.Equal(t, 3, j.Buffered())
+	require.NoError(t, j.Flush())
+	require.Equal(t, []string{pretty, "plain\n", "text\n", "[1,"}, c.writes)
+}
+
+func TestJSONWriterMaxValueSize(t *testing.T) {
+	var c chunks
+	j := jsonwriter.New(&c, jsonwriter.WithMaxValueSize(4))
+	j.Write([]byte("{\"abc\":1,\n\"d\":2}\n"))
+	require.Equal(t, []string{"{\"abc\":1,\n", "\"d\":2}\n"}, c.writes)
+}
@@ -0,0 +1,197 @@
+package limitwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+// DefaultMarker is written by the Truncate policy, unless configured
+// otherwise
+const DefaultMarker = "[output truncated]\n"
+
+// ErrLimit is returned by the Error policy when the limit is reached
+var ErrLimit = errors.New("limitwriter: output limit reached")
+
+// Policy determines what happens to data beyond the limit
+type Policy int
+
+const (
+	// Error writes up to the limit, then returns ErrLimit
+	Error Policy = iota
+	// Discard writes up to the limit, then silently discards everything
+	// else
+	Discard
+	// Truncate writes up to the limit and then a marker, on a line of its
+	// own, then silently discards everything else
+	Truncate
+)
+
+// LimitWriter passes data through to an underlying writer until a limit on
+// the number of bytes or lines is reached, which protects memory-backed
+// sinks from runaway output.
+//
+// The line limit allows the given number of complete lines through; the
+// byte limit may cut a line short. With both, whichever is reached first
+// applies. Any marker doesn't count towards the limits.
+//
+// LimitWriter is safe for concurrent use.
+type LimitWriter struct {
+	w        io.Writer
+	maxBytes int64
+	maxLines int64
+	policy   Policy
+	marker   string
+
+	mutex    sync.Mutex
+	bytes    int64
+	lines    int64
+	midLine  bool
+	exceeded bool
+}
+
+// static assert that LimitWriter is an io.Writer
+var _ io.Writer = (*LimitWriter)(nil)
+
+// Option configures a LimitWriter
+type Option func(*LimitWriter)
+
+// WithMaxBytes limits the output to n bytes
+func WithMaxBytes(n int64) Option {
+	return func(l *LimitWriter) {
+		l.maxBytes = n
+	}
+}
+
+// WithMaxLines limits the output to n lines
+func WithMaxLines(n int64) Option {
+	return func(l *LimitWriter) {
+		l.maxLines = n
+	}
+}
+
+// WithPolicy sets what happens to data beyond the limit; the default is
+// Error
+func WithPolicy(p Policy) Option {
+	return func(l *LimitWriter) {
+		l.policy = p
+	}
+}
+
+// WithMarker sets the marker written by the Truncate policy
+func WithMarker(marker string) Option {
+	return func(l *LimitWriter) {
+		l.marker = marker
+	}
+}
+
+// New creates a new LimitWriter. Without WithMaxBytes or WithMaxLines,
+// there is no limit.
+func New(w io.Writer, opts ...Option) *LimitWriter {
+	l := &LimitWriter{
+		w:        w,
+		maxBytes: -1,
+		maxLines: -1,
+		marker:   DefaultMarker,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Write writes as much of p as the limits allow.
+//
+// Under the Error policy, it returns ErrLimit if any of p was held back;
+// otherwise, it reports all of p as written.
+func (l *LimitWriter) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	allowed := l.allowed(p)
+	n, err := l.w.Write(p[:allowed])
+	l.bytes += int64(n)
+	l.lines += int64(bytes.Count(p[:n], []byte{'\n'}))
+	if n > 0 {
+		l.midLine = p[n-1] != '\n'
+	}
+	if err != nil || allowed == len(p) {
+		return n, err
+	}
+
+	first := !l.exceeded
+	l.exceeded = true
+	switch l.policy {
+	case Error:
+		return n, ErrLimit
+	case Truncate:
+		if first {
+			if err := l.writeMarker(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// Exceeded reports whether any data has been held back
+func (l *LimitWriter) Exceeded() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.exceeded
+}
+
+// Unwrap returns the underlying writer
+func (l *LimitWriter) Unwrap() io.Writer {
+	return l.w
+}
+
+// allowed returns how much of p fits within the limits; it's called with
+// the lock held
+func (l *LimitWriter) allowed(p []byte) int {
+	if l.exceeded {
+		return 0
+	}
+	allowed := len(p)
+	if l.maxBytes >= 0 {
+		if remaining := l.maxBytes - l.bytes; int64(allowed) > remaining {
+			allowed = int(remaining)
+		}
+	}
+	if l.maxLines >= 0 {
+		remaining := l.maxLines - l.lines
+		if remaining <= 0 {
+			return 0
+		}
+		for i, b := range p[:allowed] {
+			if b == '\n' {
+				if remaining--; remaining == 0 {
+					return i + 1
+				}
+			}
+		}
+	}
+	return allowed
+}
+
+// writeMarker writes the marker on a line of its own; it's called with
+// the lock held
+func (l *LimitWriter) writeMarker() error {
+	marker := l.marker
+	if l.midLine {
+		marker = "\n" + marker
+	}
+	_, err := io.WriteString(l.w, marker)
+	return err
+}
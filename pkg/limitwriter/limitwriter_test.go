@@ -0,0 +1,80 @@
+package limitwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ndau/writers/pkg/limitwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitWriterUnlimited(t *testing.T) {
+	var buf bytes.Buffer
+	l := limitwriter.New(&buf)
+	n, err := l.Write([]byte("a\nb\nc\n"))
+	require.NoError(t, err)
+	require.Equal(t, 6, n)
+	require.False(t, l.Exceeded())
+}
+
+func TestLimitWriterBytesError(t *testing.T) {
+	var buf bytes.Buffer
+	l := limitwriter.New(&buf, limitwriter.WithMaxBytes(5))
+	n, err := l.Write([]byte("abc"))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	n, err = l.Write([]byte("defg"))
+	require.Equal(t, limitwriter.ErrLimit, err)
+	require.Equal(t, 2, n)
+	require.True(t, l.Exceeded())
+
+	n, err = l.Write([]byte("h"))
+	require.Equal(t, limitwriter.ErrLimit, err)
+	require.Zero(t, n)
+	require.Equal(t, "abcde", buf.String())
+}
+
+func TestLimitWriterLinesDiscard(t *testing.T) {
+	var buf bytes.Buffer
+	l := limitwriter.New(&buf, limitwriter.WithMaxLines(2), limitwriter.WithPolicy(limitwriter.Discard))
+	n, err := l.Write([]byte("one\ntw"))
+	require.NoError(t, err)
+	require.Equal(t, 6, n)
+	n, err = l.Write([]byte("o\nthree\nfour\n"))
+	require.NoError(t, err)
+	require.Equal(t, 13, n)
+	l.Write([]byte("five\n"))
+	require.Equal(t, "one\ntwo\n", buf.String())
+	require.True(t, l.Exceeded())
+}
+
+func TestLimitWriterTruncate(t *testing.T) {
+	var buf bytes.Buffer
+	l := limitwriter.New(&buf, limitwriter.WithMaxBytes(6), limitwriter.WithPolicy(limitwriter.Truncate))
+	n, err := l.Write([]byte("one\ntwo\nthree\n"))
+	require.NoError(t, err)
+	require.Equal(t, 14, n)
+	l.Write([]byte("more\n"))
+	require.Equal(t, "one\ntw\n"+limitwriter.DefaultMarker, buf.String())
+
+	buf.Reset()
+	l = limitwriter.New(&buf,
+		limitwriter.WithMaxLines(1),
+		limitwriter.WithMaxBytes(100),
+		limitwriter.WithPolicy(limitwriter.Truncate),
+		limitwriter.WithMarker("...\n"),
+	)
+	l.Write([]byte("one\ntwo\n"))
+	require.Equal(t, "one\n...\n", buf.String())
+}
@@ -0,0 +1,116 @@
+package linebuffer
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ndau/writers/pkg/writers"
+)
+
+const newline = 0x0a
+
+// LineBuffer is an io.Writer which reassembles arbitrarily-chunked writes
+// into complete lines, and passes each line to a handler function.
+//
+// Unlike LineWriter, a line is never split: however long it gets, the
+// handler sees it in a single call. The line passed to the handler includes
+// its trailing newline. The slice is only valid for the duration of the call;
+// handlers which want to retain it must copy it.
+//
+// Data which has not yet been terminated by a newline stays in the buffer
+// until Flush is called, at which point it is passed to the handler without
+// a trailing newline.
+//
+// LineBuffer is the building block for the line-oriented writers in this
+// repository. It is not safe for concurrent use.
+type LineBuffer struct {
+	handler func(line []byte) error
+	buf     []byte
+	flushes writers.FlushCounter
+}
+
+// static assert that LineBuffer is an io.Writer
+var _ io.Writer = (*LineBuffer)(nil)
+
+// static assert that LineBuffer implements Stats
+var _ writers.Stats = (*LineBuffer)(nil)
+
+// New creates a new LineBuffer which calls handler for every complete line
+func New(handler func(line []byte) error) *LineBuffer {
+	return &LineBuffer{
+		handler: handler,
+	}
+}
+
+// Write writes the contents of p, calling the handler for every line
+// completed by it.
+//
+// If the handler returns an error, the line it was handling is discarded
+// and Write returns immediately. In that case, n is the number of bytes of p
+// which were consumed before the failed line started.
+func (b *LineBuffer) Write(p []byte) (n int, err error) {
+	for n < len(p) {
+		idx := bytes.IndexByte(p[n:], newline)
+		if idx < 0 {
+			b.buf = append(b.buf, p[n:]...)
+			return len(p), nil
+		}
+		end := n + idx + 1
+
+		line := p[n:end]
+		if len(b.buf) > 0 {
+			b.buf = append(b.buf, line...)
+			line = b.buf
+		}
+		b.flushes.Record(writers.FlushNewline)
+		err = b.handler(line)
+		b.buf = b.buf[:0]
+		if err != nil {
+			return
+		}
+		n = end
+	}
+	return
+}
+
+// Flush passes any buffered partial line to the handler.
+//
+// It is a no-op if nothing is buffered.
+func (b *LineBuffer) Flush() error {
+	if len(b.buf) == 0 {
+		return nil
+	}
+	b.flushes.Record(writers.FlushExplicit)
+	err := b.handler(b.buf)
+	b.buf = b.buf[:0]
+	return err
+}
+
+// FlushStats implements writers.Stats.
+//
+// Each line passed to the handler counts as a flush.
+func (b *LineBuffer) FlushStats() writers.FlushStats {
+	return b.flushes.FlushStats()
+}
+
+// Buffered returns the number of bytes waiting for a newline.
+func (b *LineBuffer) Buffered() int {
+	return len(b.buf)
+}
+
+// Partial returns the bytes waiting for a newline.
+//
+// The slice is only valid until the next call to Write or Flush.
+func (b *LineBuffer) Partial() []byte {
+	return b.buf
+}
@@ -0,0 +1,71 @@
+package linebuffer_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+	"github.com/ndau/writers/pkg/writers"
+	"github.com/stretchr/testify/require"
+)
+
+func collect() (*[]string, func([]byte) error) {
+	lines := []string{}
+	return &lines, func(line []byte) error {
+		lines = append(lines, string(line))
+		return nil
+	}
+}
+
+func TestLineBufferReassemblesLines(t *testing.T) {
+	lines, handler := collect()
+	buffer := linebuffer.New(handler)
+
+	for _, chunk := range []string{"hel", "lo\nwor", "ld\n", "\nmore\nand", " more"} {
+		n, err := buffer.Write([]byte(chunk))
+		require.NoError(t, err)
+		require.Equal(t, len(chunk), n)
+	}
+	require.Equal(t, []string{"hello\n", "world\n", "\n", "more\n"}, *lines)
+	require.Equal(t, len("and more"), buffer.Buffered())
+
+	require.NoError(t, buffer.Flush())
+	require.Equal(t, "and more", (*lines)[4])
+	require.Zero(t, buffer.Buffered())
+
+	// flushing an empty buffer does nothing
+	require.NoError(t, buffer.Flush())
+	require.Len(t, *lines, 5)
+
+	stats := buffer.FlushStats()
+	require.Equal(t, uint64(4), stats[writers.FlushNewline])
+	require.Equal(t, uint64(1), stats[writers.FlushExplicit])
+}
+
+func TestLineBufferHandlerError(t *testing.T) {
+	failure := errors.New("failure")
+	calls := 0
+	buffer := linebuffer.New(func(line []byte) error {
+		calls++
+		if string(line) == "bad\n" {
+			return failure
+		}
+		return nil
+	})
+
+	n, err := buffer.Write([]byte("good\nbad\nunseen\n"))
+	require.Equal(t, failure, err)
+	require.Equal(t, len("good\n"), n)
+	require.Equal(t, 2, calls)
+	require.Zero(t, buffer.Buffered())
+}
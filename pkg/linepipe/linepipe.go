@@ -0,0 +1,198 @@
+package linepipe
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// DefaultBufferSize is the number of bytes a LinePipe holds before writes
+// block, unless configured otherwise
+const DefaultBufferSize = 64 * 1024
+
+// LinePipe is the inverse of LineWriter: rather than pushing each line
+// to an io.Writer as it's completed, it lets a consumer pull them.
+//
+// Its write side accepts arbitrary chunks of data, and its read side only
+// yields complete lines, either one at a time from ReadLine, or as a
+// stream from Read, so that it can be handed to a bufio.Scanner.
+//
+// Like io.Pipe, writes block while the reader falls behind: once the
+// buffer is full, Write waits until lines have been read. A line longer
+// than the buffer is read in buffer-sized pieces.
+//
+// When the writer calls Close, the reader receives any buffered lines,
+// then any partial line, then io.EOF. CloseWithError delivers a different
+// error in place of io.EOF.
+//
+// LinePipe is safe for concurrent use.
+type LinePipe struct {
+	size int
+
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	buf     []byte
+	werr    error // set when the write side is closed
+	rclosed bool
+	pending []byte // the rest of the line being returned by Read
+}
+
+// static assert that LinePipe is an io.ReadWriteCloser
+var _ io.ReadWriteCloser = (*LinePipe)(nil)
+
+// Option configures a LinePipe
+type Option func(*LinePipe)
+
+// WithBufferSize sets the number of bytes the pipe holds before writes
+// block
+func WithBufferSize(n int) Option {
+	return func(l *LinePipe) {
+		if n > 0 {
+			l.size = n
+		}
+	}
+}
+
+// New creates a new LinePipe
+func New(opts ...Option) *LinePipe {
+	l := &LinePipe{size: DefaultBufferSize}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.cond = sync.NewCond(&l.mutex)
+	return l
+}
+
+// Write adds p to the pipe, blocking while the buffer is full.
+//
+// After either side has been closed, it returns io.ErrClosedPipe.
+func (l *LinePipe) Write(p []byte) (n int, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for len(p) > 0 {
+		if l.werr != nil || l.rclosed {
+			return n, io.ErrClosedPipe
+		}
+		space := l.size - len(l.buf)
+		if space <= 0 {
+			l.cond.Wait()
+			continue
+		}
+		if space > len(p) {
+			space = len(p)
+		}
+		l.buf = append(l.buf, p[:space]...)
+		p = p[space:]
+		n += space
+		l.cond.Broadcast()
+	}
+	return n, nil
+}
+
+// Close closes the write side of the pipe; once the buffered data has
+// been read, reads return io.EOF
+func (l *LinePipe) Close() error {
+	return l.CloseWithError(nil)
+}
+
+// CloseWithError closes the write side of the pipe; once the buffered data
+// has been read, reads return err, or io.EOF if err is nil
+func (l *LinePipe) CloseWithError(err error) error {
+	if err == nil {
+		err = io.EOF
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.werr == nil {
+		l.werr = err
+	}
+	l.cond.Broadcast()
+	return nil
+}
+
+// CloseRead closes the read side of the pipe. Further reads, and writes,
+// return io.ErrClosedPipe.
+func (l *LinePipe) CloseRead() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.rclosed = true
+	l.buf = nil
+	l.pending = nil
+	l.cond.Broadcast()
+	return nil
+}
+
+// ReadLine returns the next line, without its newline, blocking until one
+// is complete. The final line may be partial.
+func (l *LinePipe) ReadLine() ([]byte, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	line, err := l.readLine()
+	return bytes.TrimSuffix(line, []byte{'\n'}), err
+}
+
+// Read reads the data of complete lines, blocking until there is at least
+// one.
+//
+// A line which doesn't fit in p is finished by the next Read, or returned
+// by the next ReadLine.
+func (l *LinePipe) Read(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.rclosed {
+		return 0, io.ErrClosedPipe
+	}
+	if len(l.pending) == 0 {
+		line, err := l.readLine()
+		if err != nil {
+			return 0, err
+		}
+		l.pending = line
+	}
+	n := copy(p, l.pending)
+	l.pending = l.pending[n:]
+	return n, nil
+}
+
+// readLine returns the next line, including its newline; it's called with
+// the lock held
+func (l *LinePipe) readLine() ([]byte, error) {
+	for {
+		if l.rclosed {
+			return nil, io.ErrClosedPipe
+		}
+		if len(l.pending) > 0 {
+			line := l.pending
+			l.pending = nil
+			return line, nil
+		}
+
+		end := bytes.IndexByte(l.buf, '\n') + 1
+		switch {
+		case end > 0:
+		case len(l.buf) >= l.size, len(l.buf) > 0 && l.werr != nil:
+			end = len(l.buf)
+		case l.werr != nil:
+			return nil, l.werr
+		default:
+			l.cond.Wait()
+			continue
+		}
+
+		line := make([]byte, end)
+		copy(line, l.buf)
+		l.buf = l.buf[end:]
+		l.cond.Broadcast()
+		return line, nil
+	}
+}
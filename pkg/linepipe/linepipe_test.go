@@ -0,0 +1,143 @@
+package linepipe_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/linepipe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinePipeReadLine(t *testing.T) {
+	l := linepipe.New()
+	go func() {
+		l.Write([]byte("one\ntw"))
+		l.Write([]byte("o\n\nthree"))
+		l.Close()
+	}()
+
+	var lines []string
+	for {
+		line, err := l.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		lines = append(lines, string(line))
+	}
+	require.Equal(t, []string{"one", "two", "", "three"}, lines)
+}
+
+func TestLinePipeScanner(t *testing.T) {
+	l := linepipe.New(linepipe.WithBufferSize(8))
+	go func() {
+		for _, chunk := range []string{"alpha\nbe", "ta\ngam", "ma\n"} {
+			l.Write([]byte(chunk))
+		}
+		l.Close()
+	}()
+
+	var lines []string
+	s := bufio.NewScanner(l)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	require.NoError(t, s.Err())
+	require.Equal(t, []string{"alpha", "beta", "gamma"}, lines)
+}
+
+func TestLinePipeOnlyCompleteLines(t *testing.T) {
+	l := linepipe.New()
+	l.Write([]byte("partial"))
+
+	got := make(chan string)
+	go func() {
+		line, _ := l.ReadLine()
+		got <- string(line)
+	}()
+	select {
+	case line := <-got:
+		t.Fatalf("read %q before the line was complete", line)
+	case <-time.After(20 * time.Millisecond):
+	}
+	l.Write([]byte(" line\n"))
+	require.Equal(t, "partial line", <-got)
+}
+
+func TestLinePipeBackpressure(t *testing.T) {
+	l := linepipe.New(linepipe.WithBufferSize(4))
+	done := make(chan int)
+	go func() {
+		n, _ := l.Write([]byte("ab\ncd\nef\n"))
+		done <- n
+	}()
+	select {
+	case <-done:
+		t.Fatal("write didn't block on a full buffer")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	for _, want := range []string{"ab", "cd", "ef"} {
+		line, err := l.ReadLine()
+		require.NoError(t, err)
+		require.Equal(t, want, string(line))
+	}
+	require.Equal(t, 9, <-done)
+}
+
+func TestLinePipeLongLine(t *testing.T) {
+	l := linepipe.New(linepipe.WithBufferSize(4))
+	go func() {
+		l.Write([]byte("abcdefg\n"))
+		l.Close()
+	}()
+	var lines []string
+	for {
+		line, err := l.ReadLine()
+		if err != nil {
+			break
+		}
+		lines = append(lines, string(line))
+	}
+	require.Equal(t, []string{"abcd", "efg"}, lines)
+}
+
+func TestLinePipeClose(t *testing.T) {
+	boom := errors.New("boom")
+	l := linepipe.New()
+	l.Write([]byte("last\n"))
+	require.NoError(t, l.CloseWithError(boom))
+	_, err := l.Write([]byte("more\n"))
+	require.Equal(t, io.ErrClosedPipe, err)
+
+	line, err := l.ReadLine()
+	require.NoError(t, err)
+	require.Equal(t, "last", string(line))
+	_, err = l.ReadLine()
+	require.Equal(t, boom, err)
+
+	l = linepipe.New(linepipe.WithBufferSize(2))
+	done := make(chan error)
+	go func() {
+		_, err := l.Write([]byte("abcd"))
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, l.CloseRead())
+	require.Equal(t, io.ErrClosedPipe, <-done)
+	_, err = l.ReadLine()
+	require.Equal(t, io.ErrClosedPipe, err)
+}
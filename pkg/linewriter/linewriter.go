@@ -12,12 +12,22 @@ package linewriter
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unicode/utf8"
+
+	"github.com/ndau/writers/pkg/writers"
 )
 
 const newline = 0x0a
 
+// ErrClosed is returned by writes to a LineWriter which has been shut down.
+var ErrClosed = errors.New("linewriter: write to closed writer")
+
 // LineWriter wraps an io.Writer and buffers output to it.
 //
 // It flushes whenever a newline (0x0a, \n) is detected.
@@ -33,26 +43,75 @@ const newline = 0x0a
 // bufio.Writer, after all data has been written, the
 // client should call the Flush method to guarantee that
 // all data has been forwarded to the underlying io.Writer.
+//
+// FlushOnIdle makes a LineWriter flush a partial line by itself once
+// nothing has been written for a while, and Shutdown flushes it for the
+// last time within a deadline; after Shutdown, writes return ErrClosed.
+//
+// Every flush is tagged with its reason, and the counts are available
+// from FlushStats.
+//
+// LineWriter is safe for concurrent use.
 type LineWriter struct {
+	w       io.Writer
+	flushes writers.FlushCounter
+	idle    writers.IdleTimer
+	// closed is set atomically, so that Shutdown can refuse writes before
+	// it gets the lock
+	closed int32
+	// buffered is the number of bytes in buffer after the last write or
+	// flush, which Shutdown reports if it can't get them out
+	buffered int64
+
+	mutex  sync.Mutex
 	buffer *bufio.Writer
+	// reason is the reason for the next flush of buffer. Flushes we don't
+	// initiate ourselves happen because bufio.Writer ran out of space.
+	reason writers.FlushReason
+	// onErr is the error from an idle flush, to be returned by the next
+	// Write or Flush
+	onErr error
 }
 
 // static assert that LineWriter is an io.Writer
 var _ io.Writer = (*LineWriter)(nil)
 
+// static assert that LineWriter implements Stats
+var _ writers.Stats = (*LineWriter)(nil)
+
+// static assert that LineWriter implements IdleFlusher and Shutdowner
+var _ writers.IdleFlusher = (*LineWriter)(nil)
+var _ writers.Shutdowner = (*LineWriter)(nil)
+
 // New creates a new LineWriter
 func New(w io.Writer) *LineWriter {
-	return &LineWriter{
-		buffer: bufio.NewWriter(w),
+	l := &LineWriter{
+		w:      w,
+		reason: writers.FlushBufferFull,
 	}
+	l.buffer = bufio.NewWriter(&flushRecorder{w: w, l: l})
+	return l
 }
 
 // Write writes the contents of p.
 //
 // It returns the number of bytes written.
 // If n < len(p), it also returns an error explaining
-// why the write is short.
+// why the write is short. A write error from an idle
+// flush is returned by the next call to Write or Flush.
 func (l *LineWriter) Write(p []byte) (n int, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if atomic.LoadInt32(&l.closed) != 0 {
+		return 0, ErrClosed
+	}
+	if err := l.onErr; err != nil {
+		l.onErr = nil
+		return 0, err
+	}
+	defer l.idle.Touch()
+	defer l.noteBuffered()
+
 	lower := 0
 
 	passthrough := func(upper int, flush bool) error {
@@ -63,7 +122,7 @@ func (l *LineWriter) Write(p []byte) (n int, err error) {
 		}
 
 		if flush {
-			err = l.buffer.Flush()
+			err = l.flush(writers.FlushNewline)
 			if err != nil {
 				return err
 			}
@@ -114,5 +173,95 @@ func (l *LineWriter) WriteString(s string) (int, error) {
 
 // Flush writes any buffered data to the underlying io.Writer.
 func (l *LineWriter) Flush() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	defer l.noteBuffered()
+	err := l.onErr
+	l.onErr = nil
+	if ferr := l.flush(writers.FlushExplicit); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// FlushOnIdle flushes any buffered data once d has passed without a
+// write. Those flushes are recorded as FlushTimer. A d of 0 or less turns
+// idle flushing off, which is the default.
+func (l *LineWriter) FlushOnIdle(d time.Duration) {
+	l.idle.Set(d, l.onIdle)
+}
+
+// Shutdown stops the LineWriter accepting writes, and flushes any
+// buffered data. If ctx ends before the flush completes, it returns a
+// *writers.ShutdownError with the number of bytes left in the buffer; the
+// flush carries on in the background.
+//
+// Further writes return ErrClosed. Shutdown does not close the underlying
+// writer.
+func (l *LineWriter) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&l.closed, 1)
+	l.idle.Stop()
+
+	done := make(chan error, 1)
+	go func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		defer l.noteBuffered()
+		done <- l.flush(writers.FlushClose)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return &writers.ShutdownError{
+			Bytes: int(atomic.LoadInt64(&l.buffered)),
+			Err:   ctx.Err(),
+		}
+	}
+}
+
+// FlushStats implements writers.Stats
+func (l *LineWriter) FlushStats() writers.FlushStats {
+	return l.flushes.FlushStats()
+}
+
+// Unwrap returns the underlying writer
+func (l *LineWriter) Unwrap() io.Writer {
+	return l.w
+}
+
+func (l *LineWriter) onIdle() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if atomic.LoadInt32(&l.closed) == 0 && l.buffer.Buffered() > 0 {
+		if err := l.flush(writers.FlushTimer); err != nil && l.onErr == nil {
+			l.onErr = err
+		}
+		l.noteBuffered()
+	}
+}
+
+// noteBuffered is called with the lock held
+func (l *LineWriter) noteBuffered() {
+	atomic.StoreInt64(&l.buffered, int64(l.buffer.Buffered()))
+}
+
+// flush is called with the lock held
+func (l *LineWriter) flush(reason writers.FlushReason) error {
+	l.reason = reason
+	defer func() { l.reason = writers.FlushBufferFull }()
 	return l.buffer.Flush()
 }
+
+// flushRecorder sits between the bufio.Writer and the underlying writer;
+// every write it sees is a flush, which it records with the current reason.
+type flushRecorder struct {
+	w io.Writer
+	l *LineWriter
+}
+
+func (f *flushRecorder) Write(p []byte) (int, error) {
+	f.l.flushes.Record(f.l.reason)
+	return f.w.Write(p)
+}
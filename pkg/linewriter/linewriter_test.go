@@ -12,9 +12,14 @@ package linewriter_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ndau/writers/pkg/linewriter"
+	"github.com/ndau/writers/pkg/writers"
 	"github.com/stretchr/testify/require"
 )
 
@@ -83,3 +88,104 @@ func TestLinewriterDoesntFlushWithoutNewline(t *testing.T) {
 	writer.WriteByte(0x0a)
 	require.NotEmpty(t, buffer.Bytes())
 }
+
+func TestLinewriterFlushReasons(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := linewriter.New(buffer)
+
+	writer.WriteString("one\ntwo\nthree")
+	writer.Write(bytes.Repeat([]byte{'x'}, 8000))
+	writer.Flush()
+	// flushing an empty buffer doesn't count
+	writer.Flush()
+
+	stats := writer.FlushStats()
+	require.Equal(t, uint64(2), stats[writers.FlushNewline])
+	require.Equal(t, uint64(1), stats[writers.FlushBufferFull])
+	require.Equal(t, uint64(1), stats[writers.FlushExplicit])
+	require.Equal(t, uint64(4), stats.Total())
+	require.Equal(t, 4+4+5+8000, buffer.Len())
+}
+
+// lockedBuffer is a bytes.Buffer which can be written from a timer
+// goroutine; if gate isn't nil, every write waits for it to be closed
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+	gate  chan struct{}
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	if b.gate != nil {
+		<-b.gate
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestLinewriterFlushOnIdle(t *testing.T) {
+	buffer := new(lockedBuffer)
+	writer := linewriter.New(buffer)
+	writer.FlushOnIdle(10 * time.Millisecond)
+
+	writer.WriteString("one\ntw")
+	require.Equal(t, "one\n", buffer.String())
+	require.Eventually(t, func() bool {
+		return buffer.String() == "one\ntw"
+	}, time.Second, time.Millisecond)
+	require.Equal(t, uint64(1), writer.FlushStats()[writers.FlushTimer])
+}
+
+// failWriter fails every write
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestLinewriterIdleFlushError(t *testing.T) {
+	writer := linewriter.New(failWriter{})
+	writer.FlushOnIdle(5 * time.Millisecond)
+
+	_, err := writer.WriteString("partial")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return writer.FlushStats()[writers.FlushTimer] == 1
+	}, time.Second, time.Millisecond)
+	_, err = writer.WriteString("more")
+	require.EqualError(t, err, "disk full")
+}
+
+func TestLinewriterShutdown(t *testing.T) {
+	buffer := new(lockedBuffer)
+	writer := linewriter.New(buffer)
+	writer.WriteString("one\ntwo")
+	require.NoError(t, writer.Shutdown(context.Background()))
+	require.Equal(t, "one\ntwo", buffer.String())
+	require.Equal(t, uint64(1), writer.FlushStats()[writers.FlushClose])
+
+	_, err := writer.WriteString("three\n")
+	require.Equal(t, linewriter.ErrClosed, err)
+}
+
+func TestLinewriterShutdownTimeout(t *testing.T) {
+	buffer := &lockedBuffer{gate: make(chan struct{})}
+	defer close(buffer.gate)
+	writer := linewriter.New(buffer)
+	writer.WriteString("partial")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := writer.Shutdown(ctx)
+	var serr *writers.ShutdownError
+	require.True(t, errors.As(err, &serr))
+	require.Equal(t, 7, serr.Bytes)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
@@ -0,0 +1,165 @@
+package logfmtwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+)
+
+// DefaultMessageKey is the key the text of each line is written under,
+// unless another is configured with WithMessageKey
+const DefaultMessageKey = "msg"
+
+// Pair is a logfmt key/value pair
+type Pair struct {
+	Key   string
+	Value string
+}
+
+// LogfmtWriter converts each completed line written to it into a logfmt
+// record:
+//
+//	key=value other="quoted value" msg="the line"
+//
+// Each record holds the static pairs, then the pairs derived from the line
+// by the field function, if there is one, then the text of the line. Values
+// are quoted when they need to be; characters which aren't allowed in keys
+// are replaced by underscores.
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush method to convert any partial line.
+//
+// LogfmtWriter is not safe for concurrent use.
+type LogfmtWriter struct {
+	w          io.Writer
+	lines      *linebuffer.LineBuffer
+	static     []Pair
+	derive     func(line []byte) []Pair
+	messageKey string
+	out        []byte
+}
+
+// static assert that LogfmtWriter is an io.Writer
+var _ io.Writer = (*LogfmtWriter)(nil)
+
+// Option configures a LogfmtWriter
+type Option func(*LogfmtWriter)
+
+// WithFields adds static pairs to every record
+func WithFields(pairs ...Pair) Option {
+	return func(l *LogfmtWriter) {
+		l.static = append(l.static, pairs...)
+	}
+}
+
+// WithFieldFunc sets a function which derives extra pairs from each line,
+// for example by extracting a level. The line doesn't include its newline.
+func WithFieldFunc(f func(line []byte) []Pair) Option {
+	return func(l *LogfmtWriter) {
+		l.derive = f
+	}
+}
+
+// WithMessageKey sets the key the text of each line is written under
+func WithMessageKey(key string) Option {
+	return func(l *LogfmtWriter) {
+		l.messageKey = key
+	}
+}
+
+// New creates a new LogfmtWriter
+func New(w io.Writer, opts ...Option) *LogfmtWriter {
+	l := &LogfmtWriter{
+		w:          w,
+		messageKey: DefaultMessageKey,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.lines = linebuffer.New(l.convert)
+	return l
+}
+
+// Write writes the contents of p, writing a record for every line
+// completed by it
+func (l *LogfmtWriter) Write(p []byte) (int, error) {
+	return l.lines.Write(p)
+}
+
+// Flush converts any partial line
+func (l *LogfmtWriter) Flush() error {
+	return l.lines.Flush()
+}
+
+// Unwrap returns the underlying writer
+func (l *LogfmtWriter) Unwrap() io.Writer {
+	return l.w
+}
+
+// convert is the LineBuffer handler
+func (l *LogfmtWriter) convert(line []byte) error {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+
+	l.out = l.out[:0]
+	for _, pair := range l.static {
+		l.out = AppendPair(l.out, pair.Key, pair.Value)
+	}
+	if l.derive != nil {
+		for _, pair := range l.derive(line) {
+			l.out = AppendPair(l.out, pair.Key, pair.Value)
+		}
+	}
+	l.out = AppendPair(l.out, l.messageKey, string(line))
+	l.out = append(l.out, '\n')
+	_, err := l.w.Write(l.out)
+	return err
+}
+
+// AppendPair appends key=value to dst, preceded by a space unless dst is
+// empty, quoting the value if necessary
+func AppendPair(dst []byte, key, value string) []byte {
+	if len(dst) > 0 {
+		dst = append(dst, ' ')
+	}
+	if key == "" {
+		key = "_"
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			dst = append(dst, '_')
+		} else {
+			dst = append(dst, string(r)...)
+		}
+	}
+	dst = append(dst, '=')
+	if needsQuotes(value) {
+		return strconv.AppendQuote(dst, value)
+	}
+	return append(dst, value...)
+}
+
+func needsQuotes(value string) bool {
+	if value == "" {
+		return true
+	}
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError {
+			return true
+		}
+	}
+	return false
+}
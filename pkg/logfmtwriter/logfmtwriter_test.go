@@ -0,0 +1,57 @@
+package logfmtwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ndau/writers/pkg/logfmtwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogfmtWriter(t *testing.T) {
+	var sb strings.Builder
+	l := logfmtwriter.New(&sb,
+		logfmtwriter.WithFields(
+			logfmtwriter.Pair{Key: "app", Value: "api"},
+			logfmtwriter.Pair{Key: "my key", Value: ""},
+		),
+		logfmtwriter.WithFieldFunc(func(line []byte) []logfmtwriter.Pair {
+			if bytes.HasPrefix(line, []byte("ERROR")) {
+				return []logfmtwriter.Pair{{Key: "level", Value: "error"}}
+			}
+			return nil
+		}),
+	)
+	_, err := l.Write([]byte("ERROR: a=\"b\"\r\nplain\n"))
+	require.NoError(t, err)
+	l.Write([]byte("tab\there"))
+	require.NoError(t, l.Flush())
+	require.Equal(t, ""+
+		`app=api my_key="" level=error msg="ERROR: a=\"b\""`+"\n"+
+		`app=api my_key="" msg=plain`+"\n"+
+		`app=api my_key="" msg="tab\there"`+"\n",
+		sb.String())
+}
+
+func TestLogfmtWriterMessageKey(t *testing.T) {
+	var sb strings.Builder
+	l := logfmtwriter.New(&sb, logfmtwriter.WithMessageKey("line"))
+	l.Write([]byte("héllo\n"))
+	require.Equal(t, "line=héllo\n", sb.String())
+}
+
+func TestAppendPair(t *testing.T) {
+	require.Equal(t, `_=x`, string(logfmtwriter.AppendPair(nil, "", "x")))
+	require.Equal(t, `a=1 b="c\\d"`, string(logfmtwriter.AppendPair([]byte("a=1"), "b", `c\d`)))
+}
@@ -0,0 +1,149 @@
+package loggerwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+)
+
+// DefaultLevel is the level of lines whose level isn't known, unless
+// another is configured with WithDefaultLevel
+const DefaultLevel = "info"
+
+// LogFunc logs a message at a level. Levels are lower case: "trace",
+// "debug", "info", "warn", "error", "fatal" or "panic", or whatever the
+// extractor or default level provides.
+//
+// Adapters for zap, logrus, zerolog and the like are a few lines long;
+// note that their fatal and panic methods usually exit or panic, which an
+// adapter may not want to do on behalf of a line of output.
+type LogFunc func(level, msg string)
+
+// Extractor finds the level of a line, and returns the line with the level
+// removed as msg. It reports false if the line has no level.
+type Extractor func(line string) (level, msg string, ok bool)
+
+var levelNames = map[string]string{
+	"TRACE":    "trace",
+	"DEBUG":    "debug",
+	"INFO":     "info",
+	"WARN":     "warn",
+	"WARNING":  "warn",
+	"ERR":      "error",
+	"ERROR":    "error",
+	"CRIT":     "fatal",
+	"CRITICAL": "fatal",
+	"FATAL":    "fatal",
+	"PANIC":    "panic",
+}
+
+var (
+	levelWords = `(TRACE|DEBUG|INFO|WARN|WARNING|ERR|ERROR|CRIT|CRITICAL|FATAL|PANIC)`
+	prefixPat  = regexp.MustCompile(`(?i)^\s*[\[(<]?` + levelWords + `[\])>]?(?::\s*|\s+|$)`)
+	logfmtPat  = regexp.MustCompile(`(?i)(?:^|\s)level="?` + levelWords + `"?(?:\s+|$)`)
+)
+
+// ExtractLevel is the default Extractor. It recognizes a level at the
+// start of the line, as in "ERROR: msg", "[warn] msg" or "INFO msg", or as
+// a logfmt pair anywhere in it, as in "level=debug msg".
+func ExtractLevel(line string) (level, msg string, ok bool) {
+	if m := prefixPat.FindStringSubmatchIndex(line); m != nil {
+		return levelNames[strings.ToUpper(line[m[2]:m[3]])], line[m[1]:], true
+	}
+	if m := logfmtPat.FindStringSubmatchIndex(line); m != nil {
+		msg = strings.TrimSpace(line[:m[0]] + " " + line[m[1]:])
+		return levelNames[strings.ToUpper(line[m[2]:m[3]])], msg, true
+	}
+	return "", line, false
+}
+
+// LoggerWriter passes each completed line written to it, without its
+// newline, to a logging function. This lets libraries which only take an
+// io.Writer feed straight into a structured logger.
+//
+// By default every line is logged at the default level. With
+// WithExtractor, the level of each line is taken from its text where
+// possible, and removed from the message.
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush method to log any partial line.
+//
+// LoggerWriter is not safe for concurrent use.
+type LoggerWriter struct {
+	log          LogFunc
+	defaultLevel string
+	extract      Extractor
+	lines        *linebuffer.LineBuffer
+}
+
+// static assert that LoggerWriter is an io.Writer
+var _ io.Writer = (*LoggerWriter)(nil)
+
+// Option configures a LoggerWriter
+type Option func(*LoggerWriter)
+
+// WithDefaultLevel sets the level of lines whose level isn't known
+func WithDefaultLevel(level string) Option {
+	return func(l *LoggerWriter) {
+		l.defaultLevel = level
+	}
+}
+
+// WithExtractor extracts levels from lines. Pass ExtractLevel for the
+// usual formats.
+func WithExtractor(e Extractor) Option {
+	return func(l *LoggerWriter) {
+		l.extract = e
+	}
+}
+
+// New creates a new LoggerWriter which passes lines to log
+func New(log LogFunc, opts ...Option) *LoggerWriter {
+	l := &LoggerWriter{
+		log:          log,
+		defaultLevel: DefaultLevel,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.lines = linebuffer.New(l.forward)
+	return l
+}
+
+// Write writes the contents of p, logging every line completed by it
+func (l *LoggerWriter) Write(p []byte) (int, error) {
+	return l.lines.Write(p)
+}
+
+// Flush logs any partial line
+func (l *LoggerWriter) Flush() error {
+	return l.lines.Flush()
+}
+
+// forward is the LineBuffer handler
+func (l *LoggerWriter) forward(line []byte) error {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+
+	level, msg := l.defaultLevel, string(line)
+	if l.extract != nil {
+		if lvl, m, ok := l.extract(msg); ok {
+			level, msg = lvl, m
+		}
+	}
+	l.log(level, msg)
+	return nil
+}
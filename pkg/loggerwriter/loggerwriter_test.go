@@ -0,0 +1,73 @@
+package loggerwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"testing"
+
+	"github.com/ndau/writers/pkg/loggerwriter"
+	"github.com/stretchr/testify/require"
+)
+
+type entry struct {
+	level, msg string
+}
+
+func collect() (*[]entry, loggerwriter.LogFunc) {
+	entries := []entry{}
+	return &entries, func(level, msg string) {
+		entries = append(entries, entry{level, msg})
+	}
+}
+
+func TestLoggerWriter(t *testing.T) {
+	entries, log := collect()
+	l := loggerwriter.New(log)
+	_, err := l.Write([]byte("ERROR: one\r\ntw"))
+	require.NoError(t, err)
+	l.Write([]byte("o"))
+	require.NoError(t, l.Flush())
+	require.Equal(t, []entry{{"info", "ERROR: one"}, {"info", "two"}}, *entries)
+}
+
+func TestLoggerWriterExtractor(t *testing.T) {
+	entries, log := collect()
+	l := loggerwriter.New(log,
+		loggerwriter.WithExtractor(loggerwriter.ExtractLevel),
+		loggerwriter.WithDefaultLevel("debug"),
+	)
+	l.Write([]byte("ERROR: disk full\n[warn] slow\nINFO started\nts=1 level=Error msg=x\nplain\nINFORMATION\n"))
+	require.Equal(t, []entry{
+		{"error", "disk full"},
+		{"warn", "slow"},
+		{"info", "started"},
+		{"error", "ts=1 msg=x"},
+		{"debug", "plain"},
+		{"debug", "INFORMATION"},
+	}, *entries)
+}
+
+func TestExtractLevel(t *testing.T) {
+	for line, want := range map[string][2]string{
+		"FATAL":               {"fatal", ""},
+		"  (CRIT) reactor":    {"fatal", "reactor"},
+		"<panic>: oops":       {"panic", "oops"},
+		`level="trace" a=1`:   {"trace", "a=1"},
+		"WARNING:no space ok": {"warn", "no space ok"},
+	} {
+		level, msg, ok := loggerwriter.ExtractLevel(line)
+		require.True(t, ok, line)
+		require.Equal(t, want, [2]string{level, msg}, line)
+	}
+	_, msg, ok := loggerwriter.ExtractLevel("errors happen")
+	require.False(t, ok)
+	require.Equal(t, "errors happen", msg)
+}
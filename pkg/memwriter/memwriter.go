@@ -0,0 +1,187 @@
+package memwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// DefaultChunkSize is the size of the chunks a MemWriter stores data in
+const DefaultChunkSize = 4096
+
+// ErrEvicted is returned by ReadAt for offsets which have been evicted
+var ErrEvicted = errors.New("memwriter: offset has been evicted")
+
+// MemWriter is an in-memory sink which is safe for concurrent use. Think of
+// it as a better bytes.Buffer for services and tests which capture a lot of
+// output.
+//
+// Data is stored in a list of fixed-size chunks. Bytes which have been
+// written are never modified, so Snapshot only needs to hold the lock long
+// enough to copy the list of chunks; the data itself is copied without
+// blocking writers.
+//
+// Growth can be bounded with WithMaxBytes, in which case the oldest chunks
+// are evicted as new data arrives.
+//
+// MemWriter is also an io.ReaderAt. Offsets are counted from the start of
+// the stream, not the start of the retained data, so they stay valid as
+// chunks are evicted (until the data they refer to is itself evicted).
+type MemWriter struct {
+	chunkSize int
+	maxBytes  int64
+
+	mutex   sync.Mutex
+	chunks  [][]byte
+	evicted int64
+	size    int64
+}
+
+// static assert that MemWriter is an io.Writer and io.ReaderAt
+var _ io.Writer = (*MemWriter)(nil)
+var _ io.ReaderAt = (*MemWriter)(nil)
+
+// Option configures a MemWriter
+type Option func(*MemWriter)
+
+// WithChunkSize sets the size of the chunks data is stored in
+func WithChunkSize(n int) Option {
+	return func(m *MemWriter) {
+		if n > 0 {
+			m.chunkSize = n
+		}
+	}
+}
+
+// WithMaxBytes bounds the memory used by a MemWriter.
+//
+// Eviction happens a whole chunk at a time, oldest first. At least the most
+// recent n bytes are always retained, and at most n bytes plus one chunk.
+func WithMaxBytes(n int64) Option {
+	return func(m *MemWriter) {
+		m.maxBytes = n
+	}
+}
+
+// New creates a new, empty MemWriter
+func New(opts ...Option) *MemWriter {
+	m := &MemWriter{
+		chunkSize: DefaultChunkSize,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Write appends the contents of p to the stored data.
+//
+// It always returns len(p), nil.
+func (m *MemWriter) Write(p []byte) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for remaining := p; len(remaining) > 0; {
+		last := len(m.chunks) - 1
+		if last < 0 || len(m.chunks[last]) == m.chunkSize {
+			m.chunks = append(m.chunks, make([]byte, 0, m.chunkSize))
+			last++
+		}
+		n := m.chunkSize - len(m.chunks[last])
+		if n > len(remaining) {
+			n = len(remaining)
+		}
+		// appending within capacity writes only past the end of the
+		// slice, which no snapshot can see
+		m.chunks[last] = append(m.chunks[last], remaining[:n]...)
+		remaining = remaining[n:]
+	}
+	m.size += int64(len(p))
+	m.evict()
+	return len(p), nil
+}
+
+// Snapshot returns a copy of the retained data
+func (m *MemWriter) Snapshot() []byte {
+	chunks, _, size := m.view()
+	out := make([]byte, 0, size)
+	for _, chunk := range chunks {
+		out = append(out, chunk...)
+	}
+	return out
+}
+
+// ReadAt implements io.ReaderAt.
+//
+// It returns ErrEvicted if off refers to data which has been evicted.
+func (m *MemWriter) ReadAt(p []byte, off int64) (int, error) {
+	chunks, start, _ := m.view()
+	if off < start {
+		return 0, ErrEvicted
+	}
+
+	n := 0
+	skip := off - start
+	for _, chunk := range chunks {
+		if skip >= int64(len(chunk)) {
+			skip -= int64(len(chunk))
+			continue
+		}
+		n += copy(p[n:], chunk[skip:])
+		skip = 0
+		if n == len(p) {
+			return n, nil
+		}
+	}
+	return n, io.EOF
+}
+
+// Len returns the number of bytes currently retained
+func (m *MemWriter) Len() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.size
+}
+
+// Evicted returns the number of bytes which have been evicted; this is
+// also the offset of the oldest retained byte.
+func (m *MemWriter) Evicted() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.evicted
+}
+
+// view returns a copy of the chunk list, the offset of its first byte, and
+// its total length. The chunks themselves can be read without the lock.
+func (m *MemWriter) view() ([][]byte, int64, int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	chunks := make([][]byte, len(m.chunks))
+	copy(chunks, m.chunks)
+	return chunks, m.evicted, m.size
+}
+
+// evict drops the oldest chunks while the rest still hold maxBytes;
+// it must be called with the lock held
+func (m *MemWriter) evict() {
+	if m.maxBytes <= 0 {
+		return
+	}
+	for len(m.chunks) > 1 && m.size-int64(len(m.chunks[0])) >= m.maxBytes {
+		n := int64(len(m.chunks[0]))
+		m.chunks[0] = nil
+		m.chunks = m.chunks[1:]
+		m.evicted += n
+		m.size -= n
+	}
+}
@@ -0,0 +1,102 @@
+package memwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ndau/writers/pkg/memwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemWriterSnapshot(t *testing.T) {
+	writer := memwriter.New(memwriter.WithChunkSize(4))
+	fmt.Fprint(writer, "hello, ")
+	snapshot := writer.Snapshot()
+	fmt.Fprint(writer, "world")
+
+	// earlier snapshots are unaffected by later writes
+	require.Equal(t, "hello, ", string(snapshot))
+	require.Equal(t, "hello, world", string(writer.Snapshot()))
+	require.Equal(t, int64(12), writer.Len())
+	require.Zero(t, writer.Evicted())
+}
+
+func TestMemWriterEviction(t *testing.T) {
+	writer := memwriter.New(memwriter.WithChunkSize(4), memwriter.WithMaxBytes(6))
+	fmt.Fprint(writer, "abcdefghij")
+	// chunks are abcd efgh ij; dropping abcd still leaves 6 bytes
+	require.Equal(t, "efghij", string(writer.Snapshot()))
+	require.Equal(t, int64(4), writer.Evicted())
+
+	fmt.Fprint(writer, "klm")
+	// efgh ijkl m: dropping efgh would leave only 5
+	require.Equal(t, "efghijklm", string(writer.Snapshot()))
+	fmt.Fprint(writer, "n")
+	require.Equal(t, "ijklmn", string(writer.Snapshot()))
+	require.Equal(t, int64(8), writer.Evicted())
+	require.Equal(t, int64(6), writer.Len())
+}
+
+func TestMemWriterReadAt(t *testing.T) {
+	writer := memwriter.New(memwriter.WithChunkSize(4), memwriter.WithMaxBytes(6))
+	fmt.Fprint(writer, "abcdefghij")
+
+	buf := make([]byte, 3)
+	n, err := writer.ReadAt(buf, 5)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.Equal(t, "fgh", string(buf))
+
+	n, err = writer.ReadAt(buf, 8)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, "ij", string(buf[:n]))
+
+	_, err = writer.ReadAt(buf, 2)
+	require.Equal(t, memwriter.ErrEvicted, err)
+
+	// it works as a SectionReader too
+	section := io.NewSectionReader(writer, 4, 6)
+	all, err := io.ReadAll(section)
+	require.NoError(t, err)
+	require.Equal(t, "efghij", string(all))
+}
+
+func TestMemWriterConcurrentSnapshots(t *testing.T) {
+	writer := memwriter.New(memwriter.WithChunkSize(16))
+	line := "0123456789\n"
+
+	wg := sync.WaitGroup{}
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				writer.Write([]byte(line))
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			snapshot := string(writer.Snapshot())
+			// every snapshot is a whole number of intact lines
+			require.Equal(t, strings.Repeat(line, len(snapshot)/len(line)), snapshot)
+		}
+	}()
+	wg.Wait()
+	require.Equal(t, int64(800*len(line)), writer.Len())
+}
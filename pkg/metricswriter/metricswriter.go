@@ -0,0 +1,110 @@
+package metricswriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"expvar"
+	"io"
+	"time"
+)
+
+// Metrics receives an observation of every write to the sink of a
+// MetricsWriter.
+//
+// Implementations must be safe for concurrent use. Expvar publishes the
+// observations through the expvar package; the prommetrics package has an
+// implementation which is a prometheus.Collector.
+type Metrics interface {
+	// ObserveWrite records a single write of n bytes, containing the given
+	// number of newlines, which took latency and returned err
+	ObserveWrite(n, lines int, latency time.Duration, err error)
+}
+
+// MetricsWriter passes everything written to it through to an underlying
+// writer, and reports the bytes and lines written, any errors and the
+// latency of each write to a Metrics.
+//
+// Writes are as safe for concurrent use as the underlying writer.
+type MetricsWriter struct {
+	w       io.Writer
+	metrics Metrics
+	now     func() time.Time
+}
+
+// static assert that MetricsWriter is an io.Writer
+var _ io.Writer = (*MetricsWriter)(nil)
+
+// New creates a new MetricsWriter
+func New(w io.Writer, metrics Metrics) *MetricsWriter {
+	return &MetricsWriter{
+		w:       w,
+		metrics: metrics,
+		now:     time.Now,
+	}
+}
+
+// Write writes p to the underlying writer, and observes the write
+func (m *MetricsWriter) Write(p []byte) (int, error) {
+	start := m.now()
+	n, err := m.w.Write(p)
+	latency := m.now().Sub(start)
+	m.metrics.ObserveWrite(n, bytes.Count(p[:n], []byte{'\n'}), latency, err)
+	return n, err
+}
+
+// Unwrap returns the underlying writer
+func (m *MetricsWriter) Unwrap() io.Writer {
+	return m.w
+}
+
+// Expvar publishes the observations of a MetricsWriter as an expvar.Map,
+// with the keys "bytes", "lines", "writes", "errors" and
+// "latency_seconds", the total time spent writing.
+type Expvar struct {
+	m       *expvar.Map
+	bytes   expvar.Int
+	lines   expvar.Int
+	writes  expvar.Int
+	errors  expvar.Int
+	latency expvar.Float
+}
+
+// static assert that Expvar is a Metrics
+var _ Metrics = (*Expvar)(nil)
+
+// NewExpvar creates a new Expvar, published under name. Like expvar.NewMap,
+// it panics if the name is already in use.
+func NewExpvar(name string) *Expvar {
+	e := &Expvar{m: expvar.NewMap(name)}
+	e.m.Set("bytes", &e.bytes)
+	e.m.Set("lines", &e.lines)
+	e.m.Set("writes", &e.writes)
+	e.m.Set("errors", &e.errors)
+	e.m.Set("latency_seconds", &e.latency)
+	return e
+}
+
+// ObserveWrite implements Metrics
+func (e *Expvar) ObserveWrite(n, lines int, latency time.Duration, err error) {
+	e.bytes.Add(int64(n))
+	e.lines.Add(int64(lines))
+	e.writes.Add(1)
+	if err != nil {
+		e.errors.Add(1)
+	}
+	e.latency.Add(latency.Seconds())
+}
+
+// Map returns the published map
+func (e *Expvar) Map() *expvar.Map {
+	return e.m
+}
@@ -0,0 +1,62 @@
+package metricswriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 1, errors.New("disk full")
+}
+
+// stepClock advances by a fixed step every time it's read
+func stepClock(step time.Duration) func() time.Time {
+	t := time.Unix(0, 0)
+	return func() time.Time {
+		t = t.Add(step)
+		return t
+	}
+}
+
+func TestMetricsWriterExpvar(t *testing.T) {
+	e := NewExpvar("metricswriter_test")
+	var buf bytes.Buffer
+	m := New(&buf, e)
+	m.now = stepClock(250 * time.Millisecond)
+
+	m.Write([]byte("one\ntwo\n"))
+	m.Write([]byte("three"))
+	require.Equal(t, "one\ntwo\nthree", buf.String())
+
+	f := New(failingWriter{}, e)
+	f.now = stepClock(time.Second)
+	_, err := f.Write([]byte("\nxyz\n"))
+	require.Error(t, err)
+
+	var got map[string]float64
+	require.NoError(t, json.Unmarshal([]byte(e.Map().String()), &got))
+	require.Equal(t, map[string]float64{
+		"bytes":           14,
+		"lines":           3,
+		"writes":          3,
+		"errors":          1,
+		"latency_seconds": 1.5,
+	}, got)
+}
@@ -0,0 +1,98 @@
+package prommetrics
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"time"
+
+	"github.com/ndau/writers/pkg/metricswriter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector records the observations of a MetricsWriter as Prometheus
+// metrics: the counters bytes_total, lines_total, writes_total and
+// errors_total, and the histogram write_duration_seconds.
+//
+// It lives in its own package so that using MetricsWriter doesn't pull in
+// the Prometheus client. Register it as usual:
+//
+//	c := prommetrics.New("myapp", "log", nil)
+//	prometheus.MustRegister(c)
+//	w := metricswriter.New(os.Stdout, c)
+type Collector struct {
+	bytes   prometheus.Counter
+	lines   prometheus.Counter
+	writes  prometheus.Counter
+	errors  prometheus.Counter
+	latency prometheus.Histogram
+}
+
+// static assert that Collector is both a Metrics and a prometheus.Collector
+var _ metricswriter.Metrics = (*Collector)(nil)
+var _ prometheus.Collector = (*Collector)(nil)
+
+// New creates a new Collector whose metrics are named with the given
+// namespace and subsystem, and carry the given constant labels, which may
+// be nil
+func New(namespace, subsystem string, labels prometheus.Labels) *Collector {
+	counter := func(name, help string) prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        name,
+			Help:        help,
+			ConstLabels: labels,
+		})
+	}
+	return &Collector{
+		bytes:  counter("bytes_total", "Bytes written to the sink."),
+		lines:  counter("lines_total", "Lines written to the sink."),
+		writes: counter("writes_total", "Writes to the sink."),
+		errors: counter("errors_total", "Writes to the sink which failed."),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "write_duration_seconds",
+			Help:        "Time taken by writes to the sink.",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(0.0001, 4, 8),
+		}),
+	}
+}
+
+// ObserveWrite implements metricswriter.Metrics
+func (c *Collector) ObserveWrite(n, lines int, latency time.Duration, err error) {
+	c.bytes.Add(float64(n))
+	c.lines.Add(float64(lines))
+	c.writes.Inc()
+	if err != nil {
+		c.errors.Inc()
+	}
+	c.latency.Observe(latency.Seconds())
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.metrics() {
+		m.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.metrics() {
+		m.Collect(ch)
+	}
+}
+
+func (c *Collector) metrics() []prometheus.Collector {
+	return []prometheus.Collector{c.bytes, c.lines, c.writes, c.errors, c.latency}
+}
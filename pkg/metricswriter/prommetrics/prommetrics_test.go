@@ -0,0 +1,48 @@
+package prommetrics_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ndau/writers/pkg/metricswriter"
+	"github.com/ndau/writers/pkg/metricswriter/prommetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	c := prommetrics.New("app", "log", prometheus.Labels{"sink": "stdout"})
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(c))
+
+	w := metricswriter.New(ioutil.Discard, c)
+	w.Write([]byte("one\ntwo\n"))
+	w.Write([]byte("three\n"))
+
+	expected := `
+# HELP app_log_bytes_total Bytes written to the sink.
+# TYPE app_log_bytes_total counter
+app_log_bytes_total{sink="stdout"} 14
+# HELP app_log_lines_total Lines written to the sink.
+# TYPE app_log_lines_total counter
+app_log_lines_total{sink="stdout"} 3
+# HELP app_log_errors_total Writes to the sink which failed.
+# TYPE app_log_errors_total counter
+app_log_errors_total{sink="stdout"} 0
+`
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"app_log_bytes_total", "app_log_lines_total", "app_log_errors_total"))
+	require.Equal(t, 5, testutil.CollectAndCount(c))
+}
@@ -0,0 +1,234 @@
+package multilinewriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"io"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+)
+
+// Defaults for the options of a MultilineWriter
+const (
+	DefaultTimeout  = time.Second
+	DefaultMaxLines = 500
+)
+
+// DefaultContinuation matches the continuation lines of Java and Go stack
+// traces: indented lines, and Java's "Caused by:" and "... n more"
+var DefaultContinuation = regexp.MustCompile(`^(?:[ \t]|Caused by:|\.\.\. \d+ more)`)
+
+// MultilineWriter joins continuation lines onto the line they continue,
+// and forwards each resulting record in a single Write. This keeps stack
+// traces and other multi-line messages together as one log event.
+//
+// A line is a continuation if it matches the continuation pattern, or, if
+// a start pattern is configured instead, if it doesn't match that. Since a
+// record isn't known to be complete until the next one starts, the last
+// record is forwarded when no line has arrived for the timeout, or when
+// Flush is called. A record is also forwarded once it reaches the maximum
+// number of lines.
+//
+// Records keep their internal newlines unless a separator is configured.
+// After all data has been written, the client should call Flush, which
+// also stops the timer. MultilineWriter is safe for concurrent use.
+type MultilineWriter struct {
+	w            io.Writer
+	continuation *regexp.Regexp
+	start        *regexp.Regexp
+	separator    []byte
+	timeout      time.Duration
+	maxLines     int
+
+	mutex  sync.Mutex
+	lines  *linebuffer.LineBuffer
+	record []byte
+	count  int
+	timer  *time.Timer
+	last   time.Time
+	onErr  error
+}
+
+// static assert that MultilineWriter is an io.Writer
+var _ io.Writer = (*MultilineWriter)(nil)
+
+// Option configures a MultilineWriter
+type Option func(*MultilineWriter)
+
+// WithContinuation sets the pattern which continuation lines match
+func WithContinuation(pattern *regexp.Regexp) Option {
+	return func(m *MultilineWriter) {
+		m.continuation = pattern
+		m.start = nil
+	}
+}
+
+// WithStart sets a pattern which the first line of every record matches,
+// such as a leading timestamp; every other line is a continuation. This
+// replaces the continuation pattern.
+func WithStart(pattern *regexp.Regexp) Option {
+	return func(m *MultilineWriter) {
+		m.start = pattern
+	}
+}
+
+// WithSeparator replaces the newlines inside a record with sep, for
+// example " " or `\n`, so each record is a single line
+func WithSeparator(sep string) Option {
+	return func(m *MultilineWriter) {
+		m.separator = []byte(sep)
+	}
+}
+
+// WithTimeout sets how long to wait for more continuation lines before
+// forwarding a record. A timeout of 0 waits until Flush.
+func WithTimeout(d time.Duration) Option {
+	return func(m *MultilineWriter) {
+		m.timeout = d
+	}
+}
+
+// WithMaxLines sets the maximum number of lines in a record
+func WithMaxLines(n int) Option {
+	return func(m *MultilineWriter) {
+		m.maxLines = n
+	}
+}
+
+// New creates a new MultilineWriter
+func New(w io.Writer, opts ...Option) *MultilineWriter {
+	m := &MultilineWriter{
+		w:            w,
+		continuation: DefaultContinuation,
+		timeout:      DefaultTimeout,
+		maxLines:     DefaultMaxLines,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.lines = linebuffer.New(m.add)
+	return m
+}
+
+// Write writes the contents of p, forwarding every record completed by
+// it.
+//
+// A write error from a record forwarded by the timer is returned by the
+// next call to Write or Flush.
+func (m *MultilineWriter) Write(p []byte) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err := m.onErr; err != nil {
+		m.onErr = nil
+		return 0, err
+	}
+	return m.lines.Write(p)
+}
+
+// Flush forwards the pending record, including any partial line, and
+// stops the timer
+func (m *MultilineWriter) Flush() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	err := m.onErr
+	m.onErr = nil
+	if ferr := m.lines.Flush(); err == nil {
+		err = ferr
+	}
+	if ferr := m.forward(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// isContinuation reports whether line continues the current record
+func (m *MultilineWriter) isContinuation(line []byte) bool {
+	if m.start != nil {
+		return !m.start.Match(line)
+	}
+	return m.continuation.Match(line)
+}
+
+// add is the LineBuffer handler; it's called with the lock held
+func (m *MultilineWriter) add(line []byte) error {
+	var err error
+	if m.count > 0 && (m.count >= m.maxLines || !m.isContinuation(line)) {
+		err = m.forward()
+	}
+
+	if m.count > 0 && m.separator != nil {
+		// replace the newline ending the previous line
+		m.record = append(m.record[:len(m.record)-1], m.separator...)
+	}
+	m.record = append(m.record, line...)
+	m.count++
+	if line[len(line)-1] != '\n' {
+		// a partial line from Flush
+		m.record = append(m.record, '\n')
+	}
+
+	m.last = time.Now()
+	if m.timeout > 0 && m.timer == nil {
+		m.timer = time.AfterFunc(m.timeout, m.onTimer)
+	}
+	return err
+}
+
+func (m *MultilineWriter) onTimer() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.timer == nil {
+		// stopped after it fired
+		return
+	}
+	if idle := time.Since(m.last); idle < m.timeout {
+		// lines have arrived since the timer was set
+		m.timer = time.AfterFunc(m.timeout-idle, m.onTimer)
+		return
+	}
+	m.timer = nil
+	if err := m.forward(); err != nil && m.onErr == nil {
+		m.onErr = err
+	}
+}
+
+// forward writes the pending record, if there is one; it's called with
+// the lock held
+func (m *MultilineWriter) forward() error {
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+	if m.count == 0 {
+		return nil
+	}
+	_, err := m.w.Write(m.record)
+	m.record = m.record[:0]
+	m.count = 0
+	return err
+}
+
+// Pending returns the number of lines in the record waiting to be
+// forwarded
+func (m *MultilineWriter) Pending() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.count
+}
+
+// Unwrap returns the underlying writer
+func (m *MultilineWriter) Unwrap() io.Writer {
+	return m.w
+}
+
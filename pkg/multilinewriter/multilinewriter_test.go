@@ -0,0 +1,95 @@
+package multilinewriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/multilinewriter"
+	"github.com/stretchr/testify/require"
+)
+
+// records collects each write as a record
+type records struct {
+	lock sync.Mutex
+	got  []string
+}
+
+func (r *records) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.got = append(r.got, string(p))
+	return len(p), nil
+}
+
+func (r *records) get() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.got...)
+}
+
+const javaTrace = `Exception in thread "main" java.lang.IllegalStateException: boom
+	at com.example.App.run(App.java:12)
+	at com.example.App.main(App.java:5)
+Caused by: java.io.IOException: disk
+	at com.example.Disk.read(Disk.java:40)
+	... 2 more
+`
+
+func TestMultilineWriterJoinsTraces(t *testing.T) {
+	r := &records{}
+	m := multilinewriter.New(r, multilinewriter.WithTimeout(0))
+	m.Write([]byte("starting\n" + javaTrace + "done\n"))
+	require.Equal(t, []string{"starting\n", javaTrace}, r.get())
+	require.Equal(t, 1, m.Pending())
+	require.NoError(t, m.Flush())
+	require.Equal(t, []string{"starting\n", javaTrace, "done\n"}, r.get())
+	require.Zero(t, m.Pending())
+}
+
+func TestMultilineWriterStartPattern(t *testing.T) {
+	r := &records{}
+	m := multilinewriter.New(r,
+		multilinewriter.WithStart(regexp.MustCompile(`^\d{4}-\d\d-\d\d `)),
+		multilinewriter.WithSeparator(`\n`),
+		multilinewriter.WithTimeout(0),
+	)
+	m.Write([]byte("2020-01-02 panic: oops\ngoroutine 1 [running]:\nmain.main()\n2020-01-02 next\npart"))
+	require.NoError(t, m.Flush())
+	require.Equal(t, []string{
+		`2020-01-02 panic: oops\ngoroutine 1 [running]:\nmain.main()` + "\n",
+		`2020-01-02 next\npart` + "\n",
+	}, r.get())
+}
+
+func TestMultilineWriterMaxLines(t *testing.T) {
+	r := &records{}
+	m := multilinewriter.New(r, multilinewriter.WithMaxLines(2), multilinewriter.WithTimeout(0))
+	m.Write([]byte("a\n b\n c\n d\n"))
+	m.Flush()
+	require.Equal(t, []string{"a\n b\n", " c\n d\n"}, r.get())
+}
+
+func TestMultilineWriterTimeout(t *testing.T) {
+	r := &records{}
+	m := multilinewriter.New(r, multilinewriter.WithTimeout(20*time.Millisecond))
+	m.Write([]byte("error\n"))
+	m.Write([]byte(" detail\n"))
+	require.Empty(t, r.get())
+	require.Eventually(t, func() bool {
+		return len(r.get()) == 1
+	}, time.Second, time.Millisecond)
+	require.Equal(t, []string{"error\n detail\n"}, r.get())
+	require.NoError(t, m.Flush())
+}
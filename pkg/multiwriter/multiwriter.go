@@ -0,0 +1,171 @@
+package multiwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ErrAllFailed is returned by a DropFailed MultiWriter once every sink
+// has been dropped.
+var ErrAllFailed = errors.New("multiwriter: all sinks have failed")
+
+// Policy determines how a MultiWriter handles errors from its sinks.
+type Policy int
+
+const (
+	// FailFast stops at the first failing sink and returns its error,
+	// exactly like io.MultiWriter
+	FailFast Policy = iota
+	// BestEffort writes to every sink, and returns all their errors
+	// together as Errors
+	BestEffort
+	// DropFailed stops writing to a sink once it has failed, and carries
+	// on with the rest
+	DropFailed
+)
+
+// SinkError is an error returned by one of a MultiWriter's sinks
+type SinkError struct {
+	// Index is the position of the sink in the list passed to New
+	Index int
+	Err   error
+}
+
+func (e *SinkError) Error() string {
+	return fmt.Sprintf("sink %d: %s", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *SinkError) Unwrap() error {
+	return e.Err
+}
+
+// Errors collects the errors from several sinks
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the individual errors
+func (e Errors) Unwrap() []error {
+	return e
+}
+
+// SinkStats describes a single sink of a MultiWriter
+type SinkStats struct {
+	// Bytes is the number of bytes the sink has accepted
+	Bytes int64
+	// Err is the most recent error returned by the sink, if any
+	Err error
+	// Dropped is true if the sink has been dropped by the DropFailed policy
+	Dropped bool
+}
+
+// MultiWriter is like io.MultiWriter, duplicating its writes to all of its
+// sinks, but with a configurable Policy for handling errors. io.MultiWriter
+// aborts on the first failure, which isn't what you want when teeing output
+// to both a file and the network, and the network blips.
+//
+// It also keeps count of the bytes accepted by each sink.
+//
+// MultiWriter is safe for concurrent use.
+type MultiWriter struct {
+	policy Policy
+
+	mutex sync.Mutex
+	sinks []io.Writer
+	stats []SinkStats
+}
+
+// static assert that MultiWriter is an io.Writer
+var _ io.Writer = (*MultiWriter)(nil)
+
+// New creates a new MultiWriter writing to each of the sinks, in order
+func New(policy Policy, sinks ...io.Writer) *MultiWriter {
+	return &MultiWriter{
+		policy: policy,
+		sinks:  sinks,
+		stats:  make([]SinkStats, len(sinks)),
+	}
+}
+
+// Write writes p to each of the sinks in turn.
+//
+// Errors are handled according to the MultiWriter's Policy. Under FailFast,
+// the returned count is from the failing sink. Otherwise, it is len(p)
+// unless every sink has failed.
+func (m *MultiWriter) Write(p []byte) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var errs Errors
+	live := 0
+	for i, sink := range m.sinks {
+		if m.stats[i].Dropped {
+			continue
+		}
+		n, err := sink.Write(p)
+		m.stats[i].Bytes += int64(n)
+		if err == nil && n != len(p) {
+			err = io.ErrShortWrite
+		}
+		if err == nil {
+			live++
+			continue
+		}
+
+		m.stats[i].Err = err
+		switch m.policy {
+		case FailFast:
+			return n, &SinkError{Index: i, Err: err}
+		case DropFailed:
+			m.stats[i].Dropped = true
+		default:
+			errs = append(errs, &SinkError{Index: i, Err: err})
+		}
+	}
+
+	switch {
+	case len(errs) > 0:
+		if live == 0 {
+			return 0, errs
+		}
+		return len(p), errs
+	case live == 0 && len(m.sinks) > 0:
+		return 0, ErrAllFailed
+	}
+	return len(p), nil
+}
+
+// Stats returns the current state of each sink, in the order they were
+// passed to New
+func (m *MultiWriter) Stats() []SinkStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	stats := make([]SinkStats, len(m.stats))
+	copy(stats, m.stats)
+	return stats
+}
+
+// Unwrap returns the sinks
+func (m *MultiWriter) Unwrap() []io.Writer {
+	return append([]io.Writer(nil), m.sinks...)
+}
@@ -0,0 +1,118 @@
+package multiwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ndau/writers/pkg/multiwriter"
+	"github.com/stretchr/testify/require"
+)
+
+var errBlip = errors.New("network blip")
+
+// flakyWriter fails while broken is set
+type flakyWriter struct {
+	bytes.Buffer
+	broken bool
+}
+
+func (f *flakyWriter) Write(p []byte) (int, error) {
+	if f.broken {
+		return 0, errBlip
+	}
+	return f.Buffer.Write(p)
+}
+
+func TestMultiWriterFailFast(t *testing.T) {
+	first := new(bytes.Buffer)
+	flaky := &flakyWriter{broken: true}
+	last := new(bytes.Buffer)
+	writer := multiwriter.New(multiwriter.FailFast, first, flaky, last)
+
+	n, err := writer.Write([]byte("data"))
+	require.Zero(t, n)
+	require.True(t, errors.Is(err, errBlip))
+	var sinkErr *multiwriter.SinkError
+	require.True(t, errors.As(err, &sinkErr))
+	require.Equal(t, 1, sinkErr.Index)
+	require.Equal(t, "data", first.String())
+	require.Empty(t, last.String())
+}
+
+func TestMultiWriterBestEffort(t *testing.T) {
+	file := new(bytes.Buffer)
+	network := &flakyWriter{broken: true}
+	writer := multiwriter.New(multiwriter.BestEffort, file, network)
+
+	n, err := writer.Write([]byte("one "))
+	require.Equal(t, 4, n)
+	require.EqualError(t, err, "sink 1: network blip")
+	require.True(t, errors.Is(err, errBlip))
+
+	network.broken = false
+	n, err = writer.Write([]byte("two"))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	require.Equal(t, "one two", file.String())
+	require.Equal(t, "two", network.String())
+	stats := writer.Stats()
+	require.Equal(t, int64(7), stats[0].Bytes)
+	require.Equal(t, int64(3), stats[1].Bytes)
+	require.Equal(t, errBlip, stats[1].Err)
+}
+
+func TestMultiWriterBestEffortAllFailing(t *testing.T) {
+	writer := multiwriter.New(multiwriter.BestEffort, &flakyWriter{broken: true}, &flakyWriter{broken: true})
+	n, err := writer.Write([]byte("lost"))
+	require.Zero(t, n)
+	require.Len(t, err.(multiwriter.Errors), 2)
+}
+
+func TestMultiWriterDropFailed(t *testing.T) {
+	file := new(bytes.Buffer)
+	network := &flakyWriter{broken: true}
+	writer := multiwriter.New(multiwriter.DropFailed, network, file)
+
+	n, err := writer.Write([]byte("one "))
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+
+	// the network sink stays dropped even once it recovers
+	network.broken = false
+	_, err = writer.Write([]byte("two"))
+	require.NoError(t, err)
+	require.Equal(t, "one two", file.String())
+	require.Empty(t, network.String())
+
+	stats := writer.Stats()
+	require.True(t, stats[0].Dropped)
+	require.False(t, stats[1].Dropped)
+	require.Equal(t, int64(7), stats[1].Bytes)
+}
+
+type shortWriter struct{}
+
+func (shortWriter) Write(p []byte) (int, error) {
+	return len(p) / 2, nil
+}
+
+func TestMultiWriterDropFailedAll(t *testing.T) {
+	writer := multiwriter.New(multiwriter.DropFailed, shortWriter{})
+	_, err := writer.Write([]byte("abcd"))
+	require.Equal(t, multiwriter.ErrAllFailed, err)
+	require.Equal(t, io.ErrShortWrite, writer.Stats()[0].Err)
+	require.Equal(t, int64(2), writer.Stats()[0].Bytes)
+}
@@ -0,0 +1,179 @@
+package muxwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+)
+
+// DefaultFormat is the format of the tag of each line, unless configured
+// otherwise
+const DefaultFormat = "[%s] "
+
+// Mux hands out writers for several sources, such as commands running in
+// parallel, which all funnel into a single sink. Each source's lines are
+// tagged with its name, and written to the sink whole, so that lines from
+// different sources never interleave:
+//
+//	mux := muxwriter.New(os.Stdout)
+//	for _, name := range []string{"build", "test"} {
+//		cmd := exec.Command("make", name)
+//		cmd.Stdout = mux.Source(name)
+//		...
+//	}
+//
+// Mux is safe for concurrent use, and so are its sources.
+type Mux struct {
+	w      io.Writer
+	format string
+	align  bool
+
+	mutex   sync.Mutex
+	sources []*Source
+	width   int
+	buf     []byte
+}
+
+// Option configures a Mux
+type Option func(*Mux)
+
+// WithFormat sets the format of the tag at the start of each line, which
+// must contain a single %s for the source name; the default is
+// DefaultFormat
+func WithFormat(format string) Option {
+	return func(m *Mux) {
+		m.format = format
+	}
+}
+
+// WithAlign pads source names to the length of the longest so far, so that
+// the lines after the tags line up
+func WithAlign() Option {
+	return func(m *Mux) {
+		m.align = true
+	}
+}
+
+// New creates a new Mux writing to w
+func New(w io.Writer, opts ...Option) *Mux {
+	m := &Mux{
+		w:      w,
+		format: DefaultFormat,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Source returns a new writer for the source with the given name
+func (m *Mux) Source(name string) *Source {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	s := &Source{mux: m, name: name}
+	s.lines = linebuffer.New(s.writeLine)
+	m.sources = append(m.sources, s)
+	if len(name) > m.width {
+		m.width = len(name)
+	}
+	return s
+}
+
+// Flush flushes every source
+func (m *Mux) Flush() error {
+	m.mutex.Lock()
+	sources := append([]*Source(nil), m.sources...)
+	m.mutex.Unlock()
+
+	var first error
+	for _, s := range sources {
+		if err := s.Flush(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Unwrap returns the sink
+func (m *Mux) Unwrap() io.Writer {
+	return m.w
+}
+
+// write writes a tagged line to the sink in a single Write
+func (m *Mux) write(name string, line []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.align {
+		name = fmt.Sprintf("%-*s", m.width, name)
+	}
+	m.buf = append(fmt.Appendf(m.buf[:0], m.format, name), line...)
+	if line[len(line)-1] != '\n' {
+		m.buf = append(m.buf, '\n')
+	}
+	_, err := m.w.Write(m.buf)
+	return err
+}
+
+// Source is the writer for a single source of a Mux.
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush or Close method to write any partial line. A partial line is
+// ended with a newline, so that the next line from another source starts
+// on a line of its own.
+type Source struct {
+	mux  *Mux
+	name string
+
+	mutex sync.Mutex
+	lines *linebuffer.LineBuffer
+}
+
+// static assert that Source is an io.WriteCloser
+var _ io.WriteCloser = (*Source)(nil)
+
+// Write writes the contents of p, writing every line it completes to the
+// sink
+func (s *Source) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lines.Write(p)
+}
+
+// Flush writes any partial line to the sink
+func (s *Source) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lines.Flush()
+}
+
+// Close writes any partial line to the sink. It does not close the sink.
+func (s *Source) Close() error {
+	return s.Flush()
+}
+
+// Name returns the name of the source
+func (s *Source) Name() string {
+	return s.name
+}
+
+// Unwrap returns the sink
+func (s *Source) Unwrap() io.Writer {
+	return s.mux.w
+}
+
+// writeLine is the LineBuffer handler
+func (s *Source) writeLine(line []byte) error {
+	return s.mux.write(s.name, line)
+}
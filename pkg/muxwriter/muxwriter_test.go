@@ -0,0 +1,86 @@
+package muxwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ndau/writers/pkg/muxwriter"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRecorder records each write it receives
+type writeRecorder struct {
+	mutex  sync.Mutex
+	writes []string
+}
+
+func (w *writeRecorder) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func TestMux(t *testing.T) {
+	var buf bytes.Buffer
+	mux := muxwriter.New(&buf)
+	build := mux.Source("build")
+	test := mux.Source("test")
+
+	build.Write([]byte("compiling"))
+	test.Write([]byte("running\n"))
+	build.Write([]byte(" main.go\nlinking"))
+	require.Equal(t, "[test] running\n[build] compiling main.go\n", buf.String())
+
+	require.NoError(t, mux.Flush())
+	require.Equal(t, "[test] running\n[build] compiling main.go\n[build] linking\n", buf.String())
+	require.Equal(t, "build", build.Name())
+}
+
+func TestMuxFormat(t *testing.T) {
+	var buf bytes.Buffer
+	mux := muxwriter.New(&buf, muxwriter.WithFormat("%s | "), muxwriter.WithAlign())
+	a := mux.Source("a")
+	long := mux.Source("long")
+	a.Write([]byte("one\n"))
+	long.Write([]byte("two\n"))
+	require.NoError(t, a.Close())
+	require.Equal(t, "a    | one\nlong | two\n", buf.String())
+}
+
+func TestMuxConcurrent(t *testing.T) {
+	rec := &writeRecorder{}
+	mux := muxwriter.New(rec)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		s := mux.Source(fmt.Sprint(i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				// write each line in two halves
+				s.Write([]byte("hello "))
+				s.Write([]byte("world\n"))
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, rec.writes, 800)
+	for _, w := range rec.writes {
+		require.True(t, strings.HasSuffix(w, "] hello world\n"), w)
+	}
+}
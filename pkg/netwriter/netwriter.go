@@ -0,0 +1,292 @@
+package netwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ndau/writers/pkg/internal/sendqueue"
+	"github.com/ndau/writers/pkg/linebuffer"
+	"github.com/ndau/writers/pkg/writers"
+)
+
+// Defaults for the options of a NetWriter
+const (
+	DefaultQueueSize   = 1024
+	DefaultBackoff     = 100 * time.Millisecond
+	DefaultMaxBackoff  = 10 * time.Second
+	DefaultDialTimeout = 10 * time.Second
+)
+
+// ErrClosed is returned by writes to a NetWriter which has been closed.
+var ErrClosed = errors.New("netwriter: write to closed writer")
+
+// State is the state of a NetWriter's connection
+type State int
+
+const (
+	// Disconnected means there is no connection
+	Disconnected State = iota
+	// Connected means lines are being sent
+	Connected
+)
+
+func (s State) String() string {
+	switch s {
+	case Disconnected:
+		return "disconnected"
+	case Connected:
+		return "connected"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// NetWriter sends each completed line written to it, including its
+// newline, over a network connection.
+//
+// Lines are queued and sent by a background goroutine, which dials the
+// connection when needed and reconnects, with exponential backoff, when it
+// breaks. The backoff only resets once a line has been sent, so a peer
+// which accepts connections but fails every write doesn't cause a busy
+// reconnect loop. Lines written while disconnected wait in the queue; once
+// it's full, the oldest are dropped. A line whose write fails is sent
+// again in full on the next connection, so the receiver may see a
+// fragment of it twice. Failed writes and dials can be reported to an
+// error handler.
+//
+// After all data has been written, the client must call Close, which sends
+// whatever is queued if the connection is up, and stops the goroutine.
+//
+// NetWriter is safe for concurrent use.
+type NetWriter struct {
+	network      string
+	addr         string
+	dial         func(network, addr string) (net.Conn, error)
+	queueSize    int
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	writeTimeout time.Duration
+	onState      func(state State, err error)
+	onError      writers.ErrorHandler
+	queue        *sendqueue.Queue
+
+	writeMutex sync.Mutex
+	lines      *linebuffer.LineBuffer
+}
+
+// static assert that NetWriter is an io.WriteCloser
+var _ io.WriteCloser = (*NetWriter)(nil)
+
+// Option configures a NetWriter
+type Option func(*NetWriter)
+
+// WithQueueSize sets the number of lines which can wait to be sent. A
+// size less than 1 uses DefaultQueueSize.
+func WithQueueSize(n int) Option {
+	return func(w *NetWriter) {
+		if n < 1 {
+			n = DefaultQueueSize
+		}
+		w.queueSize = n
+	}
+}
+
+// WithBackoff sets the delay before the first reconnection attempt, which
+// doubles after each failed attempt up to max. Delays of 0 or less use
+// DefaultBackoff and DefaultMaxBackoff, and max is raised to initial if
+// it's smaller.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(w *NetWriter) {
+		if initial <= 0 {
+			initial = DefaultBackoff
+		}
+		if max <= 0 {
+			max = DefaultMaxBackoff
+		}
+		if max < initial {
+			max = initial
+		}
+		w.backoff = initial
+		w.maxBackoff = max
+	}
+}
+
+// WithDialer replaces net.DialTimeout, for example to use TLS
+func WithDialer(dial func(network, addr string) (net.Conn, error)) Option {
+	return func(w *NetWriter) {
+		w.dial = dial
+	}
+}
+
+// WithWriteTimeout sets a deadline on each write to the connection. A
+// write which misses it is treated as a broken connection.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(w *NetWriter) {
+		w.writeTimeout = d
+	}
+}
+
+// WithStateHandler sets a function to be called from the background
+// goroutine whenever the connection changes state. When it becomes
+// Disconnected, err explains why.
+func WithStateHandler(f func(state State, err error)) Option {
+	return func(w *NetWriter) {
+		w.onState = f
+	}
+}
+
+// WithWriteErrorHandler sets a function to be called from the background
+// goroutine whenever a line can't be sent, because writing it or dialling
+// failed. Its Sink is network://addr. BytesLost is 0 while the line is
+// going to be sent again; if Close can't connect, it's the total size of
+// the lines being dropped.
+//
+// It's also called from Write, with writers.ErrQueueFull, for each line
+// dropped because the queue is full.
+func WithWriteErrorHandler(h writers.ErrorHandler) Option {
+	return func(w *NetWriter) {
+		w.onError = h
+	}
+}
+
+// New creates a new NetWriter which sends lines to addr on the named
+// network, as for net.Dial, and starts its goroutine.
+//
+// It doesn't connect until there is something to send.
+func New(network, addr string, opts ...Option) *NetWriter {
+	w := &NetWriter{
+		network:    network,
+		addr:       addr,
+		queueSize:  DefaultQueueSize,
+		backoff:    DefaultBackoff,
+		maxBackoff: DefaultMaxBackoff,
+	}
+	w.dial = func(network, addr string) (net.Conn, error) {
+		return net.DialTimeout(network, addr, DefaultDialTimeout)
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.lines = linebuffer.New(w.enqueue)
+
+	w.queue = sendqueue.New(sendqueue.Config{
+		Dial:       w.connect,
+		Size:       w.queueSize,
+		Backoff:    w.backoff,
+		MaxBackoff: w.maxBackoff,
+		OnState:    w.state,
+		OnError:    w.report,
+	})
+	return w
+}
+
+// Write queues every line completed by p.
+//
+// It returns len(p) unless the writer has been closed, even if lines
+// were dropped.
+func (w *NetWriter) Write(p []byte) (int, error) {
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+	if w.queue.Stopped() {
+		return 0, ErrClosed
+	}
+	return w.lines.Write(p)
+}
+
+// Flush queues any partial line. It doesn't wait for it to be sent.
+func (w *NetWriter) Flush() error {
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+	if w.queue.Stopped() {
+		return ErrClosed
+	}
+	return w.lines.Flush()
+}
+
+// Close queues any partial line, then stops the background goroutine.
+//
+// Queued lines are sent first if possible, but Close doesn't wait for a
+// broken connection to recover: if it can't connect, whatever is left in
+// the queue is dropped.
+func (w *NetWriter) Close() error {
+	w.writeMutex.Lock()
+	if w.queue.Stopped() {
+		w.writeMutex.Unlock()
+		return nil
+	}
+	w.lines.Flush()
+	w.queue.Stop()
+	w.writeMutex.Unlock()
+
+	w.queue.Wait()
+	return nil
+}
+
+// Dropped returns the number of lines discarded so far
+func (w *NetWriter) Dropped() uint64 {
+	return w.queue.Dropped()
+}
+
+// enqueue is the LineBuffer handler
+func (w *NetWriter) enqueue(line []byte) error {
+	w.queue.Put(append([]byte(nil), line...))
+	return nil
+}
+
+func (w *NetWriter) state(connected bool, err error) {
+	if w.onState == nil {
+		return
+	}
+	if connected {
+		w.onState(Connected, nil)
+	} else {
+		w.onState(Disconnected, err)
+	}
+}
+
+func (w *NetWriter) report(err error, lost int, msg []byte) {
+	if w.onError != nil {
+		w.onError(&writers.WriteError{
+			Sink:      w.network + "://" + w.addr,
+			BytesLost: lost,
+			LineHash:  writers.LineHash(msg),
+			Err:       err,
+		})
+	}
+}
+
+func (w *NetWriter) connect() (sendqueue.Conn, error) {
+	conn, err := w.dial(w.network, w.addr)
+	if err != nil {
+		return nil, err
+	}
+	return netConn{conn, w.writeTimeout}, nil
+}
+
+// netConn adapts a net.Conn to the send queue
+type netConn struct {
+	net.Conn
+	writeTimeout time.Duration
+}
+
+func (c netConn) Send(msg []byte) error {
+	if c.writeTimeout > 0 {
+		c.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	_, err := c.Write(msg)
+	return err
+}
@@ -0,0 +1,268 @@
+package netwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/netwriter"
+	"github.com/ndau/writers/pkg/writers"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNet records lines written to fake connections
+type fakeNet struct {
+	lock     sync.Mutex
+	up       bool
+	failNext int
+	dials    int
+	data     string
+}
+
+func (f *fakeNet) dial(network, addr string) (net.Conn, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.dials++
+	if !f.up {
+		return nil, errors.New("connection refused")
+	}
+	return &fakeConn{net: f}, nil
+}
+
+func (f *fakeNet) setUp(up bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.up = up
+}
+
+func (f *fakeNet) received() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.data
+}
+
+func (f *fakeNet) dialCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.dials
+}
+
+// fakeConn only implements the parts of net.Conn that NetWriter uses
+type fakeConn struct {
+	net.Conn
+	net *fakeNet
+}
+
+func (c *fakeConn) Write(p []byte) (int, error) {
+	c.net.lock.Lock()
+	defer c.net.lock.Unlock()
+	if c.net.failNext > 0 {
+		c.net.failNext--
+		return 0, errors.New("connection reset")
+	}
+	c.net.data += string(p)
+	return len(p), nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func TestNetWriterTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	got := make(chan string)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		got <- string(data)
+	}()
+
+	w := netwriter.New("tcp", ln.Addr().String())
+	_, err = w.Write([]byte("one\ntw"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("o\nthree"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, "one\ntwo\nthree", <-got)
+
+	_, err = w.Write([]byte("late\n"))
+	require.Equal(t, netwriter.ErrClosed, err)
+}
+
+func TestNetWriterReconnects(t *testing.T) {
+	fake := &fakeNet{up: true, failNext: 1}
+	var lock sync.Mutex
+	var states []netwriter.State
+	w := netwriter.New("tcp", "example.com:514",
+		netwriter.WithDialer(fake.dial),
+		netwriter.WithBackoff(time.Millisecond, 2*time.Millisecond),
+		netwriter.WithStateHandler(func(state netwriter.State, err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			states = append(states, state)
+		}),
+	)
+	w.Write([]byte("a\nb\n"))
+	require.NoError(t, w.Close())
+	require.Equal(t, "a\nb\n", fake.received())
+	require.Equal(t, 2, fake.dialCount())
+	require.Equal(t, []netwriter.State{netwriter.Connected, netwriter.Disconnected, netwriter.Connected}, states)
+}
+
+func TestNetWriterBuffersWhileDown(t *testing.T) {
+	fake := &fakeNet{}
+	w := netwriter.New("tcp", "example.com:514",
+		netwriter.WithDialer(fake.dial),
+		netwriter.WithBackoff(time.Millisecond, time.Millisecond),
+		netwriter.WithQueueSize(2),
+	)
+	// the first line is taken off the queue and held for the next connection
+	w.Write([]byte("a\n"))
+	require.Eventually(t, func() bool {
+		return fake.dialCount() > 1
+	}, time.Second, time.Millisecond)
+	w.Write([]byte("b\nc\nd\n"))
+	require.Empty(t, fake.received())
+	require.Equal(t, uint64(1), w.Dropped())
+
+	fake.setUp(true)
+	require.Eventually(t, func() bool {
+		return fake.received() == "a\nc\nd\n"
+	}, time.Second, time.Millisecond)
+	require.NoError(t, w.Close())
+}
+
+func TestNetWriterCloseWhileDown(t *testing.T) {
+	fake := &fakeNet{}
+	w := netwriter.New("tcp", "example.com:514",
+		netwriter.WithDialer(fake.dial),
+		netwriter.WithBackoff(time.Hour, time.Hour),
+	)
+	w.Write([]byte("a\nb\n"))
+	require.NoError(t, w.Close())
+	require.Empty(t, fake.received())
+	require.Equal(t, uint64(2), w.Dropped())
+}
+
+func TestStateString(t *testing.T) {
+	require.Equal(t, "connected", netwriter.Connected.String())
+	require.Equal(t, "State(7)", netwriter.State(7).String())
+}
+
+func TestNetWriterErrorHandler(t *testing.T) {
+	fake := &fakeNet{}
+	var errs []*writers.WriteError
+	w := netwriter.New("tcp", "example.com:514",
+		netwriter.WithDialer(fake.dial),
+		netwriter.WithBackoff(time.Hour, time.Hour),
+		netwriter.WithWriteErrorHandler(func(err *writers.WriteError) {
+			errs = append(errs, err)
+		}),
+	)
+	w.Write([]byte("a\nbb\n"))
+	require.NoError(t, w.Close())
+
+	// the goroutine has stopped, so errs is safe to read
+	require.NotEmpty(t, errs)
+	last := errs[len(errs)-1]
+	require.Equal(t, "tcp://example.com:514", last.Sink)
+	require.Equal(t, 5, last.BytesLost)
+	require.Equal(t, writers.LineHash([]byte("a\n")), last.LineHash)
+	require.EqualError(t, last.Err, "connection refused")
+}
+
+func TestNetWriterBacksOffOnFailedSends(t *testing.T) {
+	// the peer accepts connections, but every write fails
+	fake := &fakeNet{up: true, failNext: 1000}
+	w := netwriter.New("tcp", "example.com:514",
+		netwriter.WithDialer(fake.dial),
+		netwriter.WithBackoff(time.Hour, time.Hour),
+	)
+	w.Write([]byte("a\nb\n"))
+	require.Eventually(t, func() bool {
+		return fake.dialCount() == 1
+	}, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, 1, fake.dialCount())
+
+	closed := make(chan error)
+	go func() { closed <- w.Close() }()
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close hung")
+	}
+	require.Empty(t, fake.received())
+	require.Equal(t, uint64(2), w.Dropped())
+}
+
+func TestNetWriterReportsOverflow(t *testing.T) {
+	fake := &fakeNet{}
+	var lock sync.Mutex
+	var errs []*writers.WriteError
+	w := netwriter.New("tcp", "example.com:514",
+		netwriter.WithDialer(fake.dial),
+		netwriter.WithBackoff(time.Hour, time.Hour),
+		netwriter.WithQueueSize(1),
+		netwriter.WithWriteErrorHandler(func(err *writers.WriteError) {
+			lock.Lock()
+			defer lock.Unlock()
+			errs = append(errs, err)
+		}),
+	)
+	// the first line is taken off the queue and held for the next connection
+	w.Write([]byte("a\n"))
+	require.Eventually(t, func() bool {
+		return fake.dialCount() == 1
+	}, time.Second, time.Millisecond)
+	w.Write([]byte("bb\nccc\n"))
+
+	lock.Lock()
+	require.Equal(t, writers.ErrQueueFull, errs[len(errs)-1].Err)
+	require.Equal(t, 3, errs[len(errs)-1].BytesLost)
+	require.Equal(t, writers.LineHash([]byte("bb\n")), errs[len(errs)-1].LineHash)
+	lock.Unlock()
+	require.NoError(t, w.Close())
+}
+
+func TestNetWriterBadOptions(t *testing.T) {
+	fake := &fakeNet{}
+	w := netwriter.New("tcp", "example.com:514",
+		netwriter.WithDialer(fake.dial),
+		netwriter.WithBackoff(0, 0),
+		netwriter.WithQueueSize(0),
+	)
+	w.Write([]byte("a\nb\n"))
+	require.Eventually(t, func() bool {
+		return fake.dialCount() == 1
+	}, time.Second, time.Millisecond)
+	// a zero backoff would redial without pausing
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, 1, fake.dialCount())
+	// a zero queue size would drop every line
+	require.Equal(t, uint64(0), w.Dropped())
+
+	fake.setUp(true)
+	require.NoError(t, w.Close())
+	require.Equal(t, "a\nb\n", fake.received())
+}
@@ -0,0 +1,266 @@
+package progresswriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is the default time between progress reports
+const DefaultInterval = time.Second
+
+// Progress is a snapshot of how far a ProgressWriter has got
+type Progress struct {
+	// Bytes is the number of bytes written so far
+	Bytes int64
+	// Total is the expected number of bytes, or 0 if unknown
+	Total int64
+	// Elapsed is the time since the ProgressWriter was created
+	Elapsed time.Duration
+	// Rate is the average throughput so far, in bytes per second
+	Rate float64
+	// ETA is the estimated time remaining, or 0 if unknown
+	ETA time.Duration
+	// Done is set in the final report, made by Finish
+	Done bool
+}
+
+// Percent returns how much of the total has been written, or -1 if the
+// total is unknown
+func (p Progress) Percent() float64 {
+	if p.Total <= 0 {
+		return -1
+	}
+	return 100 * float64(p.Bytes) / float64(p.Total)
+}
+
+// String formats the progress for humans, for example
+// "45.0% 1.2 MiB/2.6 MiB 350.0 KiB/s ETA 4s"
+func (p Progress) String() string {
+	parts := []string{}
+	if p.Total > 0 {
+		parts = append(parts,
+			fmt.Sprintf("%5.1f%%", p.Percent()),
+			formatBytes(float64(p.Bytes))+"/"+formatBytes(float64(p.Total)),
+		)
+	} else {
+		parts = append(parts, formatBytes(float64(p.Bytes)))
+	}
+	parts = append(parts, formatBytes(p.Rate)+"/s")
+	if p.ETA > 0 && !p.Done {
+		parts = append(parts, "ETA "+p.ETA.Round(time.Second).String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// ProgressWriter is a pass-through writer which counts the bytes written
+// through it, and reports its progress at regular intervals, either to a
+// callback or as a progress bar drawn on another writer, such as a
+// terminal.
+//
+// Reports are made from Write, no more often than the interval, so none are
+// made while writing is stalled. After all data has been written, the
+// client should call Finish to make the final report.
+//
+// ProgressWriter is safe for concurrent use.
+type ProgressWriter struct {
+	w        io.Writer
+	total    int64
+	interval time.Duration
+	callback func(Progress)
+	bar      io.Writer
+	barWidth int
+	now      func() time.Time
+
+	mutex    sync.Mutex
+	start    time.Time
+	last     time.Time
+	bytes    int64
+	finished bool
+	// drawn is the length of the line last drawn on bar
+	drawn int
+	// barErr is the first error from writing to bar, after which the bar
+	// isn't drawn any more
+	barErr error
+}
+
+// static assert that ProgressWriter is an io.Writer
+var _ io.Writer = (*ProgressWriter)(nil)
+
+// Option configures a ProgressWriter
+type Option func(*ProgressWriter)
+
+// WithTotal sets the number of bytes expected, which enables the
+// percentage and ETA
+func WithTotal(n int64) Option {
+	return func(p *ProgressWriter) {
+		p.total = n
+	}
+}
+
+// WithInterval sets the minimum time between reports
+func WithInterval(d time.Duration) Option {
+	return func(p *ProgressWriter) {
+		p.interval = d
+	}
+}
+
+// WithCallback sets a function to receive each report. It's called
+// synchronously from Write, so it should be quick.
+func WithCallback(f func(Progress)) Option {
+	return func(p *ProgressWriter) {
+		p.callback = f
+	}
+}
+
+// WithBar draws a progress bar of the given width on out, redrawing it in
+// place with a carriage return at every report, padded with spaces to clear
+// what was drawn before. A width less than 1 draws the figures without a
+// bar; the bar is also omitted when the total is unknown. If writing to
+// out fails, the bar stops being drawn, and Finish returns the error.
+func WithBar(out io.Writer, width int) Option {
+	return func(p *ProgressWriter) {
+		p.bar = out
+		p.barWidth = width
+	}
+}
+
+// New creates a new ProgressWriter which writes to w
+func New(w io.Writer, opts ...Option) *ProgressWriter {
+	p := &ProgressWriter{
+		w:        w,
+		interval: DefaultInterval,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.start = p.now()
+	p.last = p.start
+	return p
+}
+
+// Write writes p to the underlying writer, counting the bytes accepted
+func (p *ProgressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.bytes += int64(n)
+	if now := p.now(); now.Sub(p.last) >= p.interval && !p.finished {
+		p.last = now
+		p.report(p.progress(now, false))
+	}
+	return n, err
+}
+
+// Progress returns the progress so far
+func (p *ProgressWriter) Progress() Progress {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.progress(p.now(), p.finished)
+}
+
+// Finish makes the final report, with Done set, and ends the progress bar
+// with a newline. It returns the first error from drawing the bar, if any.
+// Only the first call does anything; later calls return nil.
+func (p *ProgressWriter) Finish() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.finished {
+		return nil
+	}
+	p.finished = true
+	p.report(p.progress(p.now(), true))
+	p.draw("\n")
+	return p.barErr
+}
+
+// Unwrap returns the underlying writer
+func (p *ProgressWriter) Unwrap() io.Writer {
+	return p.w
+}
+
+func (p *ProgressWriter) progress(now time.Time, done bool) Progress {
+	prog := Progress{
+		Bytes:   p.bytes,
+		Total:   p.total,
+		Elapsed: now.Sub(p.start),
+		Done:    done,
+	}
+	if prog.Elapsed > 0 {
+		prog.Rate = float64(prog.Bytes) / prog.Elapsed.Seconds()
+	}
+	if prog.Rate > 0 && prog.Total > prog.Bytes {
+		prog.ETA = time.Duration(float64(prog.Total-prog.Bytes) / prog.Rate * float64(time.Second))
+	}
+	return prog
+}
+
+// report is called with the lock held
+func (p *ProgressWriter) report(prog Progress) {
+	if p.callback != nil {
+		p.callback(prog)
+	}
+	if p.bar != nil {
+		line := p.render(prog)
+		pad := p.drawn - len(line)
+		p.drawn = len(line)
+		if pad > 0 {
+			line += strings.Repeat(" ", pad)
+		}
+		p.draw("\r" + line)
+	}
+}
+
+// draw writes s to the bar, unless there's no bar or drawing it has
+// already failed. It's called with the lock held.
+func (p *ProgressWriter) draw(s string) {
+	if p.bar == nil || p.barErr != nil {
+		return
+	}
+	if _, err := io.WriteString(p.bar, s); err != nil {
+		p.barErr = err
+	}
+}
+
+func (p *ProgressWriter) render(prog Progress) string {
+	if p.barWidth < 1 || prog.Total <= 0 {
+		return prog.String()
+	}
+	filled := int(int64(p.barWidth) * prog.Bytes / prog.Total)
+	if filled > p.barWidth {
+		filled = p.barWidth
+	}
+	bar := strings.Repeat("=", filled)
+	if filled < p.barWidth {
+		bar += ">" + strings.Repeat(" ", p.barWidth-filled-1)
+	}
+	return "[" + bar + "] " + prog.String()
+}
+
+// formatBytes formats a byte count with IEC units
+func formatBytes(n float64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	i := -1
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", n, units[i])
+}
@@ -0,0 +1,124 @@
+package progresswriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// clock is a fake time source
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func newTest(w *bytes.Buffer, c *clock, opts ...Option) *ProgressWriter {
+	p := New(w, opts...)
+	p.now = c.now
+	p.start = c.t
+	p.last = c.t
+	return p
+}
+
+func TestProgressWriterCallback(t *testing.T) {
+	c := &clock{t: time.Unix(1000, 0)}
+	var out bytes.Buffer
+	var reports []Progress
+	p := newTest(&out, c, WithTotal(4000), WithCallback(func(prog Progress) {
+		reports = append(reports, prog)
+	}))
+
+	p.Write(make([]byte, 500))
+	require.Empty(t, reports, "interval hasn't passed")
+
+	c.t = c.t.Add(time.Second)
+	p.Write(make([]byte, 500))
+	require.Len(t, reports, 1)
+	require.Equal(t, Progress{
+		Bytes:   1000,
+		Total:   4000,
+		Elapsed: time.Second,
+		Rate:    1000,
+		ETA:     3 * time.Second,
+	}, reports[0])
+	require.Equal(t, 25.0, reports[0].Percent())
+
+	c.t = c.t.Add(time.Second)
+	p.Finish()
+	p.Finish()
+	require.Len(t, reports, 2)
+	require.True(t, reports[1].Done)
+	require.Equal(t, 500.0, reports[1].Rate)
+	require.Equal(t, 1000, out.Len())
+}
+
+func TestProgressWriterBar(t *testing.T) {
+	c := &clock{t: time.Unix(1000, 0)}
+	var out, bar bytes.Buffer
+	p := newTest(&out, c, WithTotal(4096), WithBar(&bar, 10), WithInterval(0))
+	c.t = c.t.Add(2 * time.Second)
+	p.Write(make([]byte, 1024))
+	require.Equal(t, "\r[==>       ]  25.0% 1.0 KiB/4.0 KiB 512 B/s ETA 6s", bar.String())
+
+	bar.Reset()
+	p.Write(make([]byte, 3072))
+	require.NoError(t, p.Finish())
+	require.Equal(t, ""+
+		"\r[==========] 100.0% 4.0 KiB/4.0 KiB 2.0 KiB/s     "+
+		"\r[==========] 100.0% 4.0 KiB/4.0 KiB 2.0 KiB/s\n",
+		bar.String(), "the shorter line clears the end of the longer one")
+}
+
+// failWriter fails every write after the first n
+type failWriter struct {
+	n      int
+	writes int
+}
+
+func (f *failWriter) Write(b []byte) (int, error) {
+	f.writes++
+	if f.writes > f.n {
+		return 0, errors.New("broken")
+	}
+	return len(b), nil
+}
+
+func TestProgressWriterBarError(t *testing.T) {
+	bar := &failWriter{n: 1}
+	p := New(&bytes.Buffer{}, WithBar(bar, 10), WithInterval(0))
+	p.Write([]byte("abc"))
+	p.Write([]byte("abc"))
+	p.Write([]byte("abc"))
+	require.Equal(t, 2, bar.writes, "the bar isn't drawn after it fails")
+	require.EqualError(t, p.Finish(), "broken")
+	require.Equal(t, 2, bar.writes)
+	require.NoError(t, p.Finish())
+}
+
+func TestProgressUnknownTotal(t *testing.T) {
+	prog := Progress{Bytes: 3 << 20, Elapsed: time.Second, Rate: 3 << 20}
+	require.Equal(t, -1.0, prog.Percent())
+	require.Equal(t, "3.0 MiB 3.0 MiB/s", prog.String())
+
+	var bar strings.Builder
+	p := New(&bytes.Buffer{}, WithBar(&bar, 10), WithInterval(0))
+	p.Write([]byte("abc"))
+	require.True(t, strings.HasPrefix(bar.String(), "\r3 B "))
+}
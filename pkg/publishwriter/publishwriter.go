@@ -0,0 +1,331 @@
+package publishwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+	"github.com/ndau/writers/pkg/writers"
+)
+
+// Defaults for the options of a PublishWriter
+const (
+	DefaultMaxMessages = 100
+	DefaultMaxBytes    = 1 << 20
+	DefaultInterval    = time.Second
+	DefaultErrorBuffer = 16
+)
+
+// ErrClosed is returned by writes to a PublishWriter which has been closed.
+var ErrClosed = errors.New("publishwriter: write to closed writer")
+
+// Publisher sends messages to a message broker. Adapters for Kafka, NATS,
+// SQS and the like implement it.
+type Publisher interface {
+	// Publish sends a batch of messages, in order. The publisher owns the
+	// slices it's given.
+	Publish(ctx context.Context, msgs [][]byte) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface
+type PublisherFunc func(ctx context.Context, msgs [][]byte) error
+
+// Publish implements Publisher
+func (f PublisherFunc) Publish(ctx context.Context, msgs [][]byte) error {
+	return f(ctx, msgs)
+}
+
+// PublishWriter publishes each completed line written to it, without its
+// trailing newline, as a message.
+//
+// Messages are collected into batches, which are published when they reach
+// a maximum number of messages or bytes, when a time interval has passed
+// since the first message was added, or when Flush or Close is called. A
+// batch which fails to publish is discarded, and the error is sent to the
+// Errors channel; the error is also returned by Flush and Close.
+//
+// A batch which is published because it's full is published synchronously,
+// during the Write which filled it. To keep a slow broker entirely off the
+// caller's path, wrap the PublishWriter in an AsyncWriter. Batches are
+// published without holding the lock, so while one is in progress, other
+// writes can carry on filling the next batch; batches are still published
+// one at a time, in order.
+//
+// After all data has been written, the client must call Close to publish
+// the final batch and stop the timer. PublishWriter is safe for concurrent
+// use.
+type PublishWriter struct {
+	pub         Publisher
+	ctx         context.Context
+	maxMessages int
+	maxBytes    int
+	interval    time.Duration
+	errs        chan error
+	flushes     writers.FlushCounter
+
+	mutex  sync.Mutex
+	lines  *linebuffer.LineBuffer
+	batch  [][]byte
+	size   int
+	timer  *time.Timer
+	closed bool
+	// ready holds the batches which have been cut, but not yet taken by
+	// the caller which cut them to be published
+	ready []batch
+	// next is the number of the next batch to be cut
+	next uint64
+
+	// sendMutex guards turn, the number of the next batch to be published,
+	// and is held while a batch is being published
+	sendMutex sync.Mutex
+	turned    *sync.Cond
+	turn      uint64
+}
+
+// batch is a batch of messages to publish, numbered in order
+type batch struct {
+	msgs   [][]byte
+	number uint64
+}
+
+// static assert that PublishWriter is an io.WriteCloser
+var _ io.WriteCloser = (*PublishWriter)(nil)
+
+// static assert that PublishWriter implements Stats
+var _ writers.Stats = (*PublishWriter)(nil)
+
+// Option configures a PublishWriter
+type Option func(*PublishWriter)
+
+// WithBatchSize sets the maximum number of messages and bytes in a batch;
+// values less than 1 leave that limit unchanged
+func WithBatchSize(messages, bytes int) Option {
+	return func(w *PublishWriter) {
+		if messages > 0 {
+			w.maxMessages = messages
+		}
+		if bytes > 0 {
+			w.maxBytes = bytes
+		}
+	}
+}
+
+// WithInterval sets the longest time a message waits in a batch before the
+// batch is published
+func WithInterval(d time.Duration) Option {
+	return func(w *PublishWriter) {
+		w.interval = d
+	}
+}
+
+// WithErrorBuffer sets the capacity of the Errors channel
+func WithErrorBuffer(n int) Option {
+	return func(w *PublishWriter) {
+		w.errs = make(chan error, n)
+	}
+}
+
+// WithContext sets the context passed to the publisher
+func WithContext(ctx context.Context) Option {
+	return func(w *PublishWriter) {
+		w.ctx = ctx
+	}
+}
+
+// New creates a new PublishWriter
+func New(pub Publisher, opts ...Option) *PublishWriter {
+	w := &PublishWriter{
+		pub:         pub,
+		ctx:         context.Background(),
+		maxMessages: DefaultMaxMessages,
+		maxBytes:    DefaultMaxBytes,
+		interval:    DefaultInterval,
+		errs:        make(chan error, DefaultErrorBuffer),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.lines = linebuffer.New(w.add)
+	w.turned = sync.NewCond(&w.sendMutex)
+	return w
+}
+
+// Errors returns a channel which receives the errors from failed batches.
+//
+// Errors which arrive while the channel is full are discarded, so nothing
+// blocks if nobody is listening. The channel is closed by Close.
+func (w *PublishWriter) Errors() <-chan error {
+	return w.errs
+}
+
+// Write adds every line completed by p to the current batch.
+func (w *PublishWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return 0, ErrClosed
+	}
+	n, err := w.lines.Write(p)
+	ready := w.takeReady()
+	w.mutex.Unlock()
+
+	w.publish(ready)
+	return n, err
+}
+
+// Flush publishes the current batch, including any partial line, and
+// waits for the publisher to return.
+func (w *PublishWriter) Flush() error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return ErrClosed
+	}
+	ready := w.flush(writers.FlushExplicit)
+	w.mutex.Unlock()
+
+	return w.publish(ready)
+}
+
+// Close publishes the final batch, including any partial line, stops the
+// timer and closes the Errors channel. Further writes return ErrClosed.
+func (w *PublishWriter) Close() error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return nil
+	}
+	w.closed = true
+	ready := w.flush(writers.FlushClose)
+	end := w.next
+	w.mutex.Unlock()
+
+	err := w.publish(ready)
+
+	// batches cut by other callers may still be being published, and
+	// they can send to the Errors channel
+	w.sendMutex.Lock()
+	for w.turn != end {
+		w.turned.Wait()
+	}
+	close(w.errs)
+	w.sendMutex.Unlock()
+	return err
+}
+
+// FlushStats implements writers.Stats.
+//
+// Each batch published counts as a flush: one published because it was
+// full is recorded as FlushBufferFull.
+func (w *PublishWriter) FlushStats() writers.FlushStats {
+	return w.flushes.FlushStats()
+}
+
+// add is the LineBuffer handler; it's called with the lock held
+func (w *PublishWriter) add(line []byte) error {
+	msg := append([]byte(nil), bytes.TrimSuffix(line, []byte{'\n'})...)
+
+	if len(w.batch) > 0 && w.size+len(msg) > w.maxBytes {
+		w.cut(writers.FlushBufferFull)
+	}
+	w.batch = append(w.batch, msg)
+	w.size += len(msg)
+
+	if len(w.batch) >= w.maxMessages || w.size >= w.maxBytes {
+		w.cut(writers.FlushBufferFull)
+	} else if w.timer == nil && w.interval > 0 {
+		w.timer = time.AfterFunc(w.interval, w.onTimer)
+	}
+	return nil
+}
+
+func (w *PublishWriter) onTimer() {
+	w.mutex.Lock()
+	w.timer = nil
+	if !w.closed {
+		w.cut(writers.FlushTimer)
+	}
+	ready := w.takeReady()
+	w.mutex.Unlock()
+
+	w.publish(ready)
+}
+
+// flush cuts the partial line and the batch, and returns the batches to
+// publish; it's called with the lock held
+func (w *PublishWriter) flush(reason writers.FlushReason) []batch {
+	w.lines.Flush()
+	w.cut(reason)
+	return w.takeReady()
+}
+
+// cut ends the current batch, if there is one, and makes it ready to
+// publish; it's called with the lock held
+func (w *PublishWriter) cut(reason writers.FlushReason) {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if len(w.batch) == 0 {
+		return
+	}
+	w.ready = append(w.ready, batch{msgs: w.batch, number: w.next})
+	w.next++
+	w.batch = nil
+	w.size = 0
+	w.flushes.Record(reason)
+}
+
+// takeReady returns the batches which are ready to publish. It's called
+// with the lock held, by whoever took the lock to cut them.
+func (w *PublishWriter) takeReady() []batch {
+	ready := w.ready
+	w.ready = nil
+	return ready
+}
+
+// publish publishes each batch, when its turn comes, and returns the
+// first error; it's called without the lock held
+func (w *PublishWriter) publish(batches []batch) (first error) {
+	for _, b := range batches {
+		if err := w.publishBatch(b); err != nil && first == nil {
+			first = err
+		}
+	}
+	return
+}
+
+func (w *PublishWriter) publishBatch(b batch) error {
+	w.sendMutex.Lock()
+	defer w.sendMutex.Unlock()
+	for w.turn != b.number {
+		w.turned.Wait()
+	}
+	defer func() {
+		w.turn++
+		w.turned.Broadcast()
+	}()
+
+	err := w.pub.Publish(w.ctx, b.msgs)
+	if err != nil {
+		select {
+		case w.errs <- err:
+		default:
+		}
+	}
+	return err
+}
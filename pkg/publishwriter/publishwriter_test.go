@@ -0,0 +1,145 @@
+package publishwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/publishwriter"
+	"github.com/ndau/writers/pkg/writers"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder is a Publisher which records its batches
+type recorder struct {
+	lock    sync.Mutex
+	batches [][]string
+	fail    error
+}
+
+func (r *recorder) Publish(ctx context.Context, msgs [][]byte) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.fail != nil {
+		return r.fail
+	}
+	var batch []string
+	for _, msg := range msgs {
+		batch = append(batch, string(msg))
+	}
+	r.batches = append(r.batches, batch)
+	return nil
+}
+
+func (r *recorder) get() [][]string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([][]string(nil), r.batches...)
+}
+
+func TestPublishWriterBatches(t *testing.T) {
+	r := &recorder{}
+	w := publishwriter.New(r, publishwriter.WithBatchSize(2, 0), publishwriter.WithInterval(0))
+	_, err := w.Write([]byte("a\nb\nc\nd"))
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"a", "b"}}, r.get())
+
+	require.NoError(t, w.Flush())
+	require.Equal(t, [][]string{{"a", "b"}, {"c", "d"}}, r.get())
+
+	w.Write([]byte("e\n"))
+	require.NoError(t, w.Close())
+	require.Equal(t, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}, r.get())
+
+	_, err = w.Write([]byte("f\n"))
+	require.Equal(t, publishwriter.ErrClosed, err)
+
+	// the partial line filled the second batch before Flush could send it
+	stats := w.FlushStats()
+	require.Equal(t, uint64(2), stats[writers.FlushBufferFull])
+	require.Equal(t, uint64(0), stats[writers.FlushExplicit])
+	require.Equal(t, uint64(1), stats[writers.FlushClose])
+}
+
+func TestPublishWriterMaxBytes(t *testing.T) {
+	r := &recorder{}
+	w := publishwriter.New(r, publishwriter.WithBatchSize(0, 5), publishwriter.WithInterval(0))
+	w.Write([]byte("abc\nde\nf\n"))
+	require.NoError(t, w.Close())
+	require.Equal(t, [][]string{{"abc", "de"}, {"f"}}, r.get())
+}
+
+func TestPublishWriterInterval(t *testing.T) {
+	r := &recorder{}
+	w := publishwriter.New(r, publishwriter.WithInterval(10*time.Millisecond))
+	w.Write([]byte("a\nb\n"))
+	require.Eventually(t, func() bool {
+		return len(r.get()) == 1
+	}, time.Second, time.Millisecond)
+	require.Equal(t, [][]string{{"a", "b"}}, r.get())
+	require.NoError(t, w.Close())
+}
+
+func TestPublishWriterErrors(t *testing.T) {
+	oops := errors.New("broker unavailable")
+	r := &recorder{fail: oops}
+	w := publishwriter.New(r,
+		publishwriter.WithBatchSize(1, 0),
+		publishwriter.WithErrorBuffer(1),
+		publishwriter.WithInterval(0),
+	)
+	// Write succeeds; the errors go to the channel, which holds one
+	_, err := w.Write([]byte("a\nb\n"))
+	require.NoError(t, err)
+
+	w.Write([]byte("c"))
+	require.Equal(t, oops, w.Close())
+
+	var errs []error
+	for err := range w.Errors() {
+		errs = append(errs, err)
+	}
+	require.Equal(t, []error{oops}, errs)
+}
+
+func TestPublishWriterSlowBrokerDoesNotBlockWrites(t *testing.T) {
+	gate := make(chan struct{})
+	entered := make(chan struct{}, 10)
+	r := &recorder{}
+	w := publishwriter.New(publishwriter.PublisherFunc(func(ctx context.Context, msgs [][]byte) error {
+		entered <- struct{}{}
+		<-gate
+		return r.Publish(ctx, msgs)
+	}), publishwriter.WithInterval(5*time.Millisecond))
+
+	w.Write([]byte("first\n"))
+	// the timer is now publishing the first batch, which the broker holds up
+	<-entered
+
+	written := make(chan struct{})
+	go func() {
+		w.Write([]byte("second\n"))
+		close(written)
+	}()
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		t.Fatal("Write blocked behind a slow broker")
+	}
+
+	close(gate)
+	require.NoError(t, w.Close())
+	require.Equal(t, [][]string{{"first"}, {"second"}}, r.get())
+}
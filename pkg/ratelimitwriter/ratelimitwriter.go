@@ -0,0 +1,216 @@
+package ratelimitwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+	"github.com/ndau/writers/pkg/writers"
+)
+
+// Policy determines what a RateLimitWriter does with a line which would
+// exceed its budget.
+type Policy int
+
+const (
+	// Block makes the caller wait until the line fits in the budget
+	Block Policy = iota
+	// Drop discards the line and counts it
+	Drop
+)
+
+// RateLimitWriter wraps an io.Writer and enforces a budget of bytes per
+// second and/or lines per second on the data forwarded to it.
+//
+// The budgets are token buckets which hold up to one second's worth of
+// tokens, so short bursts are permitted. Complete lines are the unit of
+// work: a line is either forwarded whole or not at all. A line longer than
+// the byte budget's burst is forwarded once the bucket is full.
+//
+// Depending on its Policy, a RateLimitWriter either blocks the caller until
+// a line fits in the budget, or drops the line. Dropped lines are reported
+// by Dropped.
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush method to forward any trailing partial line. RateLimitWriter is
+// not safe for concurrent use, except for Dropped.
+type RateLimitWriter struct {
+	w       io.Writer
+	lines   *linebuffer.LineBuffer
+	policy  Policy
+	byteBkt *bucket
+	lineBkt *bucket
+	dropped uint64
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// static assert that RateLimitWriter is an io.Writer
+var _ io.Writer = (*RateLimitWriter)(nil)
+
+// static assert that RateLimitWriter implements Stats
+var _ writers.Stats = (*RateLimitWriter)(nil)
+
+// Option configures a RateLimitWriter
+type Option func(*RateLimitWriter)
+
+// WithBytesPerSecond limits the forwarded data to n bytes per second.
+//
+// Values of n less than 1 remove the limit.
+func WithBytesPerSecond(n int) Option {
+	return func(r *RateLimitWriter) {
+		r.byteBkt = newBucket(float64(n))
+	}
+}
+
+// WithLinesPerSecond limits the forwarded data to n lines per second.
+//
+// Values of n less than 1 remove the limit.
+func WithLinesPerSecond(n int) Option {
+	return func(r *RateLimitWriter) {
+		r.lineBkt = newBucket(float64(n))
+	}
+}
+
+// WithPolicy sets what happens to lines which exceed the budget.
+//
+// The default is Block.
+func WithPolicy(p Policy) Option {
+	return func(r *RateLimitWriter) {
+		r.policy = p
+	}
+}
+
+// New creates a new RateLimitWriter.
+//
+// With no budget options, it forwards everything without limit.
+func New(w io.Writer, opts ...Option) *RateLimitWriter {
+	r := &RateLimitWriter{
+		w:     w,
+		now:   time.Now,
+		sleep: time.Sleep,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.lines = linebuffer.New(r.writeLine)
+	return r
+}
+
+// Write writes the contents of p.
+//
+// Under the Drop policy, bytes which are dropped are still reported as
+// written.
+func (r *RateLimitWriter) Write(p []byte) (int, error) {
+	return r.lines.Write(p)
+}
+
+// Flush forwards any buffered partial line, subject to the budget.
+func (r *RateLimitWriter) Flush() error {
+	return r.lines.Flush()
+}
+
+// FlushStats implements writers.Stats.
+//
+// Each complete line counts as a flush, whether or not it was forwarded.
+func (r *RateLimitWriter) FlushStats() writers.FlushStats {
+	return r.lines.FlushStats()
+}
+
+// Dropped returns the number of lines dropped so far.
+//
+// It is safe to call concurrently with Write.
+func (r *RateLimitWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&r.dropped)
+}
+
+// Unwrap returns the underlying writer
+func (r *RateLimitWriter) Unwrap() io.Writer {
+	return r.w
+}
+
+func (r *RateLimitWriter) writeLine(line []byte) error {
+	for {
+		now := r.now()
+		wait := r.byteBkt.wait(now, float64(len(line)))
+		if lw := r.lineBkt.wait(now, 1); lw > wait {
+			wait = lw
+		}
+		if wait == 0 {
+			r.byteBkt.take(float64(len(line)))
+			r.lineBkt.take(1)
+			_, err := r.w.Write(line)
+			return err
+		}
+		if r.policy == Drop {
+			atomic.AddUint64(&r.dropped, 1)
+			return nil
+		}
+		r.sleep(wait)
+	}
+}
+
+// bucket is a token bucket which refills at rate tokens per second, up to
+// one second's worth of tokens. A nil bucket imposes no limit.
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64) *bucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &bucket{
+		rate:   rate,
+		tokens: rate,
+	}
+}
+
+// wait refills the bucket and returns how long it will be until n tokens
+// are available; n is capped at the bucket's capacity.
+func (b *bucket) wait(now time.Time, n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+
+	if n > b.rate {
+		n = b.rate
+	}
+	if b.tokens >= n {
+		return 0
+	}
+	wait := time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+	if wait <= 0 {
+		wait = time.Nanosecond
+	}
+	return wait
+}
+
+// take removes n tokens from the bucket; it may go negative when a line
+// is larger than the bucket's capacity.
+func (b *bucket) take(n float64) {
+	if b != nil {
+		b.tokens -= n
+	}
+}
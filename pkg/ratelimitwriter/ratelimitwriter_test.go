@@ -0,0 +1,120 @@
+package ratelimitwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock lets tests control time; sleeping just advances it
+type fakeClock struct {
+	t     time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) sleep(d time.Duration) {
+	c.slept += d
+	c.t = c.t.Add(d)
+}
+
+func newFake(w *bytes.Buffer, opts ...Option) (*RateLimitWriter, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	r := New(w, opts...)
+	r.now = clock.now
+	r.sleep = clock.sleep
+	return r, clock
+}
+
+func TestRateLimitWriterUnlimited(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	r, clock := newFake(buffer)
+	text := strings.Repeat("a line of text\n", 1000)
+	_, err := r.Write([]byte(text))
+	require.NoError(t, err)
+	require.Equal(t, text, buffer.String())
+	require.Zero(t, clock.slept)
+}
+
+func TestRateLimitWriterBlocksOnLines(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	r, clock := newFake(buffer, WithLinesPerSecond(10))
+	_, err := r.Write([]byte(strings.Repeat("x\n", 30)))
+	require.NoError(t, err)
+	require.Equal(t, 30, strings.Count(buffer.String(), "\n"))
+	// the first 10 are free, the remaining 20 take 2 seconds
+	require.InDelta(t, 2*time.Second, clock.slept, float64(time.Millisecond))
+	require.Zero(t, r.Dropped())
+}
+
+func TestRateLimitWriterBlocksOnBytes(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	r, clock := newFake(buffer, WithBytesPerSecond(100))
+	line := strings.Repeat("y", 49) + "\n"
+	for i := 0; i < 4; i++ {
+		_, err := r.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.Equal(t, 200, buffer.Len())
+	require.InDelta(t, time.Second, clock.slept, float64(time.Millisecond))
+}
+
+func TestRateLimitWriterOversizedLine(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	r, clock := newFake(buffer, WithBytesPerSecond(10))
+	line := strings.Repeat("z", 99) + "\n"
+	_, err := r.Write([]byte(line))
+	require.NoError(t, err)
+	require.Equal(t, line, buffer.String())
+	require.Zero(t, clock.slept)
+
+	// the bucket is now deeply in debt
+	_, err = r.Write([]byte("z\n"))
+	require.NoError(t, err)
+	require.InDelta(t, 9*time.Second+200*time.Millisecond, clock.slept, float64(time.Millisecond))
+}
+
+func TestRateLimitWriterDrops(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	r, clock := newFake(buffer, WithLinesPerSecond(5), WithPolicy(Drop))
+	text := strings.Repeat("x\n", 8)
+	n, err := r.Write([]byte(text))
+	require.NoError(t, err)
+	require.Equal(t, len(text), n)
+	require.Equal(t, strings.Repeat("x\n", 5), buffer.String())
+	require.Equal(t, uint64(3), r.Dropped())
+	require.Zero(t, clock.slept)
+
+	// after a second, the budget is available again
+	clock.t = clock.t.Add(time.Second)
+	_, err = r.Write([]byte("y\n"))
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(buffer.String(), "y\n"))
+	require.Equal(t, uint64(3), r.Dropped())
+}
+
+func TestRateLimitWriterFlush(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	r, _ := newFake(buffer, WithLinesPerSecond(5))
+	_, err := r.Write([]byte("partial"))
+	require.NoError(t, err)
+	require.Empty(t, buffer.String())
+	require.NoError(t, r.Flush())
+	require.Equal(t, "partial", buffer.String())
+}
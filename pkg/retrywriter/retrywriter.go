@@ -0,0 +1,193 @@
+package retrywriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+	"github.com/ndau/writers/pkg/writers"
+)
+
+// Defaults for the options of a RetryWriter
+const (
+	DefaultAttempts   = 3
+	DefaultBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+	DefaultJitter     = 0.2
+)
+
+// RetryWriter wraps an io.Writer and retries writes which fail with
+// transient errors, as network-backed sinks often do.
+//
+// Complete lines are the unit of work. When a write fails, only the part of
+// the line which the underlying writer didn't accept is retried, so lines
+// are never duplicated. Between attempts, RetryWriter waits for an
+// exponentially increasing backoff, randomized by a jitter factor.
+//
+// If a line still fails after all its attempts, or with an error which
+// isn't retryable, it is discarded and the error is returned from Write. A
+// line can only be torn if the sink accepted part of it before failing for
+// good. Every failed attempt, retried or not, is reported to the error
+// handler if one is set.
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush method to write any trailing partial line. RetryWriter is not
+// safe for concurrent use.
+type RetryWriter struct {
+	w          io.Writer
+	lines      *linebuffer.LineBuffer
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	jitter     float64
+	retryable  func(error) bool
+	onError    writers.ErrorHandler
+
+	sleep  func(time.Duration)
+	random func() float64
+}
+
+// static assert that RetryWriter is an io.Writer
+var _ io.Writer = (*RetryWriter)(nil)
+
+// Option configures a RetryWriter
+type Option func(*RetryWriter)
+
+// WithAttempts sets the maximum number of attempts to write each line,
+// including the first
+func WithAttempts(n int) Option {
+	return func(r *RetryWriter) {
+		r.attempts = n
+	}
+}
+
+// WithBackoff sets the delay before the first retry, which doubles after
+// each subsequent attempt up to max
+func WithBackoff(initial, max time.Duration) Option {
+	return func(r *RetryWriter) {
+		r.backoff = initial
+		r.maxBackoff = max
+	}
+}
+
+// WithJitter randomizes each delay by up to the given fraction in either
+// direction, so that many writers don't retry in lockstep
+func WithJitter(fraction float64) Option {
+	return func(r *RetryWriter) {
+		r.jitter = fraction
+	}
+}
+
+// WithRetryable sets a predicate which decides which errors are worth
+// retrying.
+//
+// By default, every error is retried.
+func WithRetryable(f func(error) bool) Option {
+	return func(r *RetryWriter) {
+		r.retryable = f
+	}
+}
+
+// WithWriteErrorHandler sets a handler to be called with every error from
+// the underlying writer. BytesLost is 0 for an attempt which will be
+// retried, and the rest of the line for one which won't.
+func WithWriteErrorHandler(h writers.ErrorHandler) Option {
+	return func(r *RetryWriter) {
+		r.onError = h
+	}
+}
+
+// New creates a new RetryWriter
+func New(w io.Writer, opts ...Option) *RetryWriter {
+	r := &RetryWriter{
+		w:          w,
+		attempts:   DefaultAttempts,
+		backoff:    DefaultBackoff,
+		maxBackoff: DefaultMaxBackoff,
+		jitter:     DefaultJitter,
+		retryable:  func(error) bool { return true },
+		sleep:      time.Sleep,
+		random:     rand.Float64,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.lines = linebuffer.New(r.writeLine)
+	return r
+}
+
+// Write writes the contents of p, retrying each line as necessary.
+func (r *RetryWriter) Write(p []byte) (int, error) {
+	return r.lines.Write(p)
+}
+
+// Flush writes any buffered partial line, retrying as necessary
+func (r *RetryWriter) Flush() error {
+	return r.lines.Flush()
+}
+
+// Unwrap returns the underlying writer
+func (r *RetryWriter) Unwrap() io.Writer {
+	return r.w
+}
+
+func (r *RetryWriter) writeLine(line []byte) error {
+	hash := uint64(0)
+	if r.onError != nil {
+		hash = writers.LineHash(line)
+	}
+	delay := r.backoff
+	for attempt := 1; ; attempt++ {
+		n, err := r.w.Write(line)
+		line = line[n:]
+		if len(line) == 0 {
+			// everything was accepted, so there's nothing left to retry
+			return nil
+		}
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+		if attempt >= r.attempts || !r.retryable(err) {
+			r.report(err, len(line), hash)
+			return err
+		}
+		r.report(err, 0, hash)
+
+		r.sleep(r.jittered(delay))
+		delay *= 2
+		if delay > r.maxBackoff {
+			delay = r.maxBackoff
+		}
+	}
+}
+
+func (r *RetryWriter) report(err error, lost int, hash uint64) {
+	if r.onError != nil {
+		r.onError(&writers.WriteError{
+			Sink:      writers.SinkName(r.w),
+			BytesLost: lost,
+			LineHash:  hash,
+			Err:       err,
+		})
+	}
+}
+
+func (r *RetryWriter) jittered(d time.Duration) time.Duration {
+	if r.jitter <= 0 {
+		return d
+	}
+	// scale by a random factor in [1-jitter, 1+jitter)
+	factor := 1 + r.jitter*(2*r.random()-1)
+	return time.Duration(float64(d) * factor)
+}
@@ -0,0 +1,152 @@
+package retrywriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/writers"
+	"github.com/stretchr/testify/require"
+)
+
+var errTransient = errors.New("transient")
+var errPermanent = errors.New("permanent")
+
+// flakyWriter fails its first failures writes, after accepting up to
+// partial bytes of each
+type flakyWriter struct {
+	bytes.Buffer
+	partial  int
+	failures int
+	err      error
+	writes   int
+}
+
+func (f *flakyWriter) Write(p []byte) (int, error) {
+	f.writes++
+	if f.failures == 0 {
+		return f.Buffer.Write(p)
+	}
+	f.failures--
+	if len(p) > f.partial {
+		p = p[:f.partial]
+	}
+	n, _ := f.Buffer.Write(p)
+	return n, f.err
+}
+
+func newRecording(w io.Writer, opts ...Option) (*RetryWriter, *[]time.Duration) {
+	var sleeps []time.Duration
+	r := New(w, opts...)
+	r.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	r.random = func() float64 { return 0.5 }
+	return r, &sleeps
+}
+
+func TestRetryWriterRecovers(t *testing.T) {
+	sink := &flakyWriter{failures: 2, err: errTransient}
+	writer, sleeps := newRecording(sink, WithBackoff(10*time.Millisecond, time.Second))
+
+	n, err := writer.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	require.Equal(t, 6, n)
+	require.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}, *sleeps)
+}
+
+func TestRetryWriterNoDuplication(t *testing.T) {
+	// each write only gets partway through before failing
+	sink := &flakyWriter{partial: 3, failures: 3, err: errTransient}
+	writer, _ := newRecording(sink, WithAttempts(10))
+
+	_, err := writer.Write([]byte("abcdefghij\n"))
+	require.NoError(t, err)
+	require.Equal(t, "abcdefghij\n", sink.String())
+	require.Equal(t, 4, sink.writes)
+}
+
+func TestRetryWriterGivesUp(t *testing.T) {
+	sink := &flakyWriter{failures: 100, err: errTransient}
+	writer, sleeps := newRecording(sink,
+		WithAttempts(4),
+		WithBackoff(time.Second, 3*time.Second),
+	)
+
+	n, err := writer.Write([]byte("lost\n"))
+	require.Equal(t, errTransient, err)
+	require.Zero(t, n)
+	require.Equal(t, 4, sink.writes)
+	require.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, *sleeps)
+}
+
+func TestRetryWriterNotRetryable(t *testing.T) {
+	sink := &flakyWriter{failures: 1, err: errPermanent}
+	writer, sleeps := newRecording(sink, WithRetryable(func(err error) bool {
+		return err != errPermanent
+	}))
+
+	_, err := writer.Write([]byte("fails\n"))
+	require.Equal(t, errPermanent, err)
+	require.Equal(t, 1, sink.writes)
+	require.Empty(t, *sleeps)
+}
+
+func TestRetryWriterJitter(t *testing.T) {
+	writer := New(nil, WithJitter(0.5))
+	writer.random = func() float64 { return 0 }
+	require.Equal(t, 50*time.Millisecond, writer.jittered(100*time.Millisecond))
+	writer.random = func() float64 { return 0.75 }
+	require.Equal(t, 125*time.Millisecond, writer.jittered(100*time.Millisecond))
+}
+
+func TestRetryWriterFlush(t *testing.T) {
+	sink := &flakyWriter{failures: 1, err: errTransient}
+	writer, sleeps := newRecording(sink)
+	writer.Write([]byte("partial"))
+	require.Empty(t, sink.String())
+	require.NoError(t, writer.Flush())
+	require.Equal(t, "partial", sink.String())
+	require.Len(t, *sleeps, 1)
+}
+
+func TestRetryWriterShortWrite(t *testing.T) {
+	// a short write with no error is retried too
+	sink := &flakyWriter{partial: 2, failures: 1}
+	writer, _ := newRecording(sink)
+	_, err := writer.Write([]byte("short\n"))
+	require.NoError(t, err)
+	require.Equal(t, "short\n", sink.String())
+	require.Equal(t, 2, sink.writes)
+}
+
+func TestRetryWriterErrorHandler(t *testing.T) {
+	sink := &flakyWriter{partial: 2, failures: 100, err: errTransient}
+	var errs []*writers.WriteError
+	writer, _ := newRecording(sink, WithWriteErrorHandler(func(err *writers.WriteError) {
+		errs = append(errs, err)
+	}))
+
+	_, err := writer.Write([]byte("lost line\n"))
+	require.Equal(t, errTransient, err)
+	require.Len(t, errs, 3)
+	for _, e := range errs {
+		require.Equal(t, "*retrywriter.flakyWriter", e.Sink)
+		require.Equal(t, writers.LineHash([]byte("lost line\n")), e.LineHash)
+		require.Equal(t, errTransient, e.Err)
+	}
+	require.Zero(t, errs[0].BytesLost)
+	require.Zero(t, errs[1].BytesLost)
+	// three attempts got two bytes each through
+	require.Equal(t, 4, errs[2].BytesLost)
+}
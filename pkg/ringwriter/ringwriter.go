@@ -0,0 +1,190 @@
+package ringwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// RingWriter keeps the most recent lines written to it in memory, so that
+// they can be dumped on demand: for example, to attach recent output to a
+// crash report.
+//
+// It retains up to a maximum number of lines, and optionally up to a
+// maximum number of bytes; the oldest lines are discarded first. A
+// trailing partial line counts against both limits, and is included in
+// the output of Lines and WriteTo. The most recent complete line is always
+// retained, however long it is, but a partial line is cut down to its last
+// maximum number of bytes, so that output which never ends a line, such as
+// a progress bar, doesn't grow without limit.
+//
+// Optionally, everything written to a RingWriter is also passed through
+// to an underlying writer.
+//
+// RingWriter is safe for concurrent use, so the retained lines can be
+// dumped from a different goroutine than the one writing them.
+type RingWriter struct {
+	maxLines int
+	maxBytes int
+	w        io.Writer
+
+	mutex   sync.Mutex
+	lines   [][]byte
+	bytes   int
+	partial []byte
+}
+
+// static assert that RingWriter is an io.Writer and io.WriterTo
+var _ io.Writer = (*RingWriter)(nil)
+var _ io.WriterTo = (*RingWriter)(nil)
+
+// Option configures a RingWriter
+type Option func(*RingWriter)
+
+// WithMaxBytes limits the retained lines to n bytes in total,
+// including their newlines and any partial line
+func WithMaxBytes(n int) Option {
+	return func(r *RingWriter) {
+		r.maxBytes = n
+	}
+}
+
+// WithPassthrough passes everything written through to w
+func WithPassthrough(w io.Writer) Option {
+	return func(r *RingWriter) {
+		r.w = w
+	}
+}
+
+// New creates a new RingWriter which retains the last n lines.
+//
+// If n is less than 1, the number of lines is unlimited, and the retained
+// lines should be limited with WithMaxBytes instead.
+func New(n int, opts ...Option) *RingWriter {
+	r := &RingWriter{
+		maxLines: n,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Write writes the contents of p.
+//
+// If there is an underlying writer, p is passed through to it first, and
+// only the bytes it accepted are retained.
+func (r *RingWriter) Write(p []byte) (n int, err error) {
+	if r.w != nil {
+		n, err = r.w.Write(p)
+		p = p[:n]
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.retain(p)
+	if r.w == nil {
+		n = len(p)
+	}
+	return
+}
+
+// Lines returns the retained lines, oldest first, without their newlines.
+func (r *RingWriter) Lines() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	lines := make([]string, 0, len(r.lines)+1)
+	for _, line := range r.lines {
+		lines = append(lines, string(line[:len(line)-1]))
+	}
+	if len(r.partial) > 0 {
+		lines = append(lines, string(r.partial))
+	}
+	return lines
+}
+
+// WriteTo writes the retained lines to w, oldest first.
+//
+// It implements io.WriterTo. Unlike bytes.Buffer, it doesn't consume the
+// lines: they're still retained afterwards.
+func (r *RingWriter) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var total int64
+	write := func(line []byte) error {
+		n, err := w.Write(line)
+		total += int64(n)
+		return err
+	}
+	for _, line := range r.lines {
+		if err := write(line); err != nil {
+			return total, err
+		}
+	}
+	if len(r.partial) > 0 {
+		return total, write(r.partial)
+	}
+	return total, nil
+}
+
+// Reset discards all retained lines
+func (r *RingWriter) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.lines = nil
+	r.bytes = 0
+	r.partial = nil
+}
+
+// Unwrap returns the passthrough writer, or nil if there isn't one
+func (r *RingWriter) Unwrap() io.Writer {
+	return r.w
+}
+
+// retain splits p into lines and retains them, along with any partial
+// line, within the limits. It's called with the lock held.
+func (r *RingWriter) retain(p []byte) {
+	for len(p) > 0 {
+		idx := bytes.IndexByte(p, '\n')
+		if idx < 0 {
+			r.partial = append(r.partial, p...)
+			break
+		}
+		r.lines = append(r.lines, append(r.partial, p[:idx+1]...))
+		r.bytes += len(r.partial) + idx + 1
+		r.partial = nil
+		p = p[idx+1:]
+	}
+
+	if r.maxBytes > 0 && len(r.partial) > r.maxBytes {
+		excess := len(r.partial) - r.maxBytes
+		copy(r.partial, r.partial[excess:])
+		r.partial = r.partial[:r.maxBytes]
+	}
+
+	// the partial line, if any, is the most recent one, so that all the
+	// complete lines can go; otherwise the last of them is kept
+	keep, partial := 1, 0
+	if len(r.partial) > 0 {
+		keep, partial = 0, 1
+	}
+	for len(r.lines) > keep &&
+		((r.maxLines > 0 && len(r.lines)+partial > r.maxLines) ||
+			(r.maxBytes > 0 && r.bytes+len(r.partial) > r.maxBytes)) {
+		r.bytes -= len(r.lines[0])
+		r.lines[0] = nil
+		r.lines = r.lines[1:]
+	}
+}
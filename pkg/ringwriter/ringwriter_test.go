@@ -0,0 +1,81 @@
+package ringwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ndau/writers/pkg/ringwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingWriterRetainsLastLines(t *testing.T) {
+	writer := ringwriter.New(3)
+	require.Empty(t, writer.Lines())
+
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(writer, "line %d\n", i)
+	}
+	require.Equal(t, []string{"line 7", "line 8", "line 9"}, writer.Lines())
+
+	// a partial line counts as one of the lines
+	fmt.Fprint(writer, "partial")
+	require.Equal(t, []string{"line 8", "line 9", "partial"}, writer.Lines())
+
+	buffer := new(bytes.Buffer)
+	n, err := writer.WriteTo(buffer)
+	require.NoError(t, err)
+	require.Equal(t, "line 8\nline 9\npartial", buffer.String())
+	require.Equal(t, int64(buffer.Len()), n)
+
+	// writing out doesn't consume anything
+	require.Len(t, writer.Lines(), 3)
+	writer.Reset()
+	require.Empty(t, writer.Lines())
+}
+
+func TestRingWriterMaxBytes(t *testing.T) {
+	writer := ringwriter.New(0, ringwriter.WithMaxBytes(10))
+	fmt.Fprint(writer, "aaa\nbbb\nccc\n")
+	require.Equal(t, []string{"bbb", "ccc"}, writer.Lines())
+
+	// the newest line is kept even when it's too big
+	fmt.Fprint(writer, strings.Repeat("d", 20)+"\n")
+	require.Equal(t, []string{strings.Repeat("d", 20)}, writer.Lines())
+}
+
+func TestRingWriterPassthrough(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := ringwriter.New(2, ringwriter.WithPassthrough(buffer))
+	fmt.Fprint(writer, "one\ntwo\nthree\nfour")
+	require.Equal(t, "one\ntwo\nthree\nfour", buffer.String())
+	require.Equal(t, []string{"three", "four"}, writer.Lines())
+}
+
+func TestRingWriterLongPartialLine(t *testing.T) {
+	writer := ringwriter.New(3, ringwriter.WithMaxBytes(10))
+	fmt.Fprint(writer, "aaa\nbbb\n")
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(writer, "\r%3d%%", i%101)
+	}
+	// the partial line pushes out the complete ones, and only its end is
+	// kept
+	require.Equal(t, []string{"\r 89%\r 90%"}, writer.Lines())
+
+	// once it's ended, it's a complete line like any other
+	fmt.Fprint(writer, "\n")
+	require.Equal(t, []string{"\r 89%\r 90%"}, writer.Lines())
+	fmt.Fprint(writer, "ccc\n")
+	require.Equal(t, []string{"ccc"}, writer.Lines())
+}
@@ -0,0 +1,491 @@
+package rotatewriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ndau/writers/pkg/writers"
+)
+
+// Defaults for the options of a RotateWriter
+const (
+	DefaultPattern    = "{name}-{time}{ext}"
+	DefaultTimeFormat = "20060102T150405.000"
+)
+
+// ErrClosed is returned by writes to a RotateWriter which has been closed.
+var ErrClosed = errors.New("rotatewriter: write to closed writer")
+
+// RotateWriter writes to a file, and rotates it when it grows past a
+// maximum size or age: the file is renamed to a backup name, and a new one
+// is started in its place. Old backups can be compressed with gzip, and
+// pruned so that only a given number are kept.
+//
+// Rotation only happens at line boundaries, so a line is never split
+// between two files; a line which is longer than the maximum size gets a
+// file to itself. Data is written straight to the file, without buffering.
+//
+// Backup names are made from a pattern, in which {name} is replaced by the
+// file's name without its extension, {ext} by its extension, and {time} by
+// the time of rotation. Backups are kept in the same directory as the file.
+// Compression and pruning happen in the background; Close waits for them,
+// and Shutdown waits for them until its context ends. FlushOnIdle syncs
+// the file to stable storage once nothing has been written for a while.
+//
+// After all data has been written, the client must call Close or Shutdown.
+// RotateWriter is safe for concurrent use.
+type RotateWriter struct {
+	filename   string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	compress   bool
+	pattern    string
+	timeFormat string
+	perm       os.FileMode
+	now        func() time.Time
+	idle       writers.IdleTimer
+
+	mutex   sync.Mutex
+	file    *os.File
+	size    int64
+	opened  time.Time
+	midLine bool
+	closed  bool
+
+	millMutex sync.Mutex
+	milling   sync.WaitGroup
+}
+
+// static assert that RotateWriter is an io.WriteCloser
+var _ io.WriteCloser = (*RotateWriter)(nil)
+
+// static assert that RotateWriter implements IdleFlusher and Shutdowner
+var _ writers.IdleFlusher = (*RotateWriter)(nil)
+var _ writers.Shutdowner = (*RotateWriter)(nil)
+
+// Option configures a RotateWriter
+type Option func(*RotateWriter)
+
+// WithMaxSize rotates the file before it grows past n bytes
+func WithMaxSize(n int64) Option {
+	return func(r *RotateWriter) {
+		r.maxSize = n
+	}
+}
+
+// WithMaxAge rotates the file once it has been open for d
+func WithMaxAge(d time.Duration) Option {
+	return func(r *RotateWriter) {
+		r.maxAge = d
+	}
+}
+
+// WithMaxBackups keeps only the n most recent backups. By default, all
+// backups are kept.
+func WithMaxBackups(n int) Option {
+	return func(r *RotateWriter) {
+		r.maxBackups = n
+	}
+}
+
+// WithCompress compresses backups with gzip, adding .gz to their names
+func WithCompress() Option {
+	return func(r *RotateWriter) {
+		r.compress = true
+	}
+}
+
+// WithPattern sets the pattern for backup names. It must contain {time}.
+func WithPattern(pattern string) Option {
+	return func(r *RotateWriter) {
+		r.pattern = pattern
+	}
+}
+
+// WithTimeFormat sets the layout of {time} in backup names, as for
+// time.Format. It must not contain path separators.
+func WithTimeFormat(layout string) Option {
+	return func(r *RotateWriter) {
+		r.timeFormat = layout
+	}
+}
+
+// WithPerm sets the permissions of new files; the default is 0644
+func WithPerm(perm os.FileMode) Option {
+	return func(r *RotateWriter) {
+		r.perm = perm
+	}
+}
+
+// New creates a new RotateWriter which writes to filename, appending to it
+// if it exists. It rotates on size or age only if the corresponding option
+// is given.
+func New(filename string, opts ...Option) (*RotateWriter, error) {
+	r := &RotateWriter{
+		filename:   filename,
+		pattern:    DefaultPattern,
+		timeFormat: DefaultTimeFormat,
+		perm:       0644,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if !strings.Contains(r.pattern, "{time}") {
+		return nil, errors.New("rotatewriter: pattern must contain {time}")
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write writes the contents of p to the file, rotating it first, and at
+// any line boundary within p, if it's due.
+func (r *RotateWriter) Write(p []byte) (n int, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return 0, ErrClosed
+	}
+	if err = r.reopen(); err != nil {
+		return
+	}
+	defer r.idle.Touch()
+
+	for len(p) > 0 {
+		end := bytes.IndexByte(p, '\n') + 1
+		if end == 0 {
+			end = len(p)
+		}
+		if !r.midLine && r.due(int64(end)) {
+			if err = r.rotate(); err != nil {
+				return
+			}
+		}
+		var written int
+		written, err = r.file.Write(p[:end])
+		n += written
+		r.size += int64(written)
+		if err != nil {
+			return
+		}
+		r.midLine = p[end-1] != '\n'
+		p = p[end:]
+	}
+	return
+}
+
+// Rotate rotates the file now, unless it's empty. If a line is only
+// partly written, the file is rotated anyway.
+func (r *RotateWriter) Rotate() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	if r.size == 0 {
+		return nil
+	}
+	return r.rotate()
+}
+
+// Sync commits the file to stable storage
+func (r *RotateWriter) Sync() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	if err := r.reopen(); err != nil {
+		return err
+	}
+	return r.file.Sync()
+}
+
+// Close closes the file, and waits for any compression and pruning of
+// backups to finish.
+func (r *RotateWriter) Close() error {
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.idle.Stop()
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+	}
+	r.mutex.Unlock()
+
+	r.milling.Wait()
+	return err
+}
+
+// FlushOnIdle syncs the file once d has passed without a write, as Sync
+// does. A d of 0 or less turns idle syncing off, which is the default.
+func (r *RotateWriter) FlushOnIdle(d time.Duration) {
+	r.idle.Set(d, func() { r.Sync() })
+}
+
+// Shutdown is like Close, but gives up waiting for compression and
+// pruning of backups when ctx ends. Nothing written is lost, since the
+// file isn't buffered; the returned *writers.ShutdownError only says that
+// the backups aren't finished yet, and they carry on in the background.
+func (r *RotateWriter) Shutdown(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Close()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return &writers.ShutdownError{Err: ctx.Err()}
+	}
+}
+
+// due reports whether the file should be rotated before writing n more
+// bytes to it; it's called with the lock held
+func (r *RotateWriter) due(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.maxSize > 0 && r.size+n > r.maxSize {
+		return true
+	}
+	return r.maxAge > 0 && r.now().Sub(r.opened) >= r.maxAge
+}
+
+func (r *RotateWriter) open() error {
+	f, err := os.OpenFile(r.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, r.perm)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file = f
+	r.size = info.Size()
+	r.opened = r.now()
+	r.midLine = false
+	return nil
+}
+
+// reopen opens the file again if a failed rotation left it closed; it's
+// called with the lock held
+func (r *RotateWriter) reopen() error {
+	if r.file != nil {
+		return nil
+	}
+	return r.open()
+}
+
+// rotate is called with the lock held. If it fails, the file is left as it
+// was, or if it can't even be reopened, it's closed, and the next write
+// tries to open it again.
+func (r *RotateWriter) rotate() error {
+	if err := r.reopen(); err != nil {
+		return err
+	}
+	err := r.file.Close()
+	r.file = nil
+	if err != nil {
+		return err
+	}
+	backup := r.backupName(r.now())
+	if err := os.Rename(r.filename, backup); err != nil {
+		// carry on writing to the file as it is
+		if oerr := r.open(); oerr != nil {
+			return oerr
+		}
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	if r.compress || r.maxBackups > 0 {
+		r.milling.Add(1)
+		go r.mill(backup)
+	}
+	return nil
+}
+
+// backupName returns an unused backup name for a rotation at t
+func (r *RotateWriter) backupName(t time.Time) string {
+	dir, base := filepath.Split(r.filename)
+	ext := filepath.Ext(base)
+	name := r.pattern
+	name = strings.ReplaceAll(name, "{name}", strings.TrimSuffix(base, ext))
+	name = strings.ReplaceAll(name, "{ext}", ext)
+	stamp := t.Format(r.timeFormat)
+
+	candidate := filepath.Join(dir, strings.ReplaceAll(name, "{time}", stamp))
+	for i := 1; exists(candidate) || exists(candidate+".gz"); i++ {
+		candidate = filepath.Join(dir, strings.ReplaceAll(name, "{time}", stamp+"-"+strconv.Itoa(i)))
+	}
+	return candidate
+}
+
+func exists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+// mill compresses a new backup and prunes old ones
+func (r *RotateWriter) mill(backup string) {
+	defer r.milling.Done()
+	r.millMutex.Lock()
+	defer r.millMutex.Unlock()
+
+	if r.compress {
+		if err := compress(backup); err == nil {
+			os.Remove(backup)
+		}
+	}
+	if r.maxBackups > 0 {
+		backups := r.Backups()
+		for len(backups) > r.maxBackups {
+			os.Remove(backups[0])
+			backups = backups[1:]
+		}
+	}
+}
+
+// Backups returns the names of the existing backups, oldest first.
+//
+// A file only counts as a backup if its name matches the pattern, and the
+// part in place of {time} is a time in the backup time format, perhaps
+// followed by -N; so other files which happen to match, such as the live
+// app-debug.log next to app.log, are left alone.
+func (r *RotateWriter) Backups() []string {
+	dir, base := filepath.Split(r.filename)
+	ext := filepath.Ext(base)
+	glob := r.pattern
+	glob = strings.ReplaceAll(glob, "{name}", escapeGlob(strings.TrimSuffix(base, ext)))
+	glob = strings.ReplaceAll(glob, "{ext}", escapeGlob(ext))
+	glob = strings.ReplaceAll(glob, "{time}", "*")
+	glob = filepath.Join(dir, glob)
+
+	// the literal parts of a backup's path, either side of the time
+	path := r.pattern
+	path = strings.ReplaceAll(path, "{name}", strings.TrimSuffix(base, ext))
+	path = strings.ReplaceAll(path, "{ext}", ext)
+	path = filepath.Join(dir, path)
+	split := strings.Index(path, "{time}")
+	prefix, suffix := path[:split], path[split+len("{time}"):]
+
+	plain, _ := filepath.Glob(glob)
+	gzipped, _ := filepath.Glob(glob + ".gz")
+	type backup struct {
+		name    string
+		modTime time.Time
+	}
+	var backups []backup
+	for _, name := range append(plain, gzipped...) {
+		if name == r.filename || !r.isStamp(strings.TrimSuffix(strings.TrimPrefix(
+			strings.TrimSuffix(name, ".gz"), prefix), suffix)) {
+			continue
+		}
+		if info, err := os.Stat(name); err == nil && info.Mode().IsRegular() {
+			backups = append(backups, backup{name, info.ModTime()})
+		}
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		if backups[i].modTime.Equal(backups[j].modTime) {
+			return backups[i].name < backups[j].name
+		}
+		return backups[i].modTime.Before(backups[j].modTime)
+	})
+	names := make([]string, len(backups))
+	for i, b := range backups {
+		names[i] = b.name
+	}
+	return names
+}
+
+// isStamp reports whether s is a time stamp made by backupName
+func (r *RotateWriter) isStamp(s string) bool {
+	if _, err := time.Parse(r.timeFormat, s); err == nil {
+		return true
+	}
+	dash := strings.LastIndexByte(s, '-')
+	if dash < 0 {
+		return false
+	}
+	if _, err := strconv.ParseUint(s[dash+1:], 10, 0); err != nil {
+		return false
+	}
+	_, err := time.Parse(r.timeFormat, s[:dash])
+	return err == nil
+}
+
+func escapeGlob(s string) string {
+	var sb strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[\`, c) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// compress writes a gzipped copy of name, with the same modification time
+func compress(name string) (err error) {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(name + ".gz")
+			return
+		}
+		os.Chtimes(name+".gz", info.ModTime(), info.ModTime())
+	}()
+
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,180 @@
+package rotatewriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// clock is a fake time source which advances a second each time it's read
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	c.t = c.t.Add(time.Second)
+	return c.t
+}
+
+func newTest(t *testing.T, opts ...Option) (*RotateWriter, string) {
+	dir := t.TempDir()
+	c := &clock{t: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	opts = append(opts, func(r *RotateWriter) { r.now = c.now })
+	r, err := New(filepath.Join(dir, "app.log"), opts...)
+	require.NoError(t, err)
+	return r, dir
+}
+
+func read(t *testing.T, name string) string {
+	data, err := ioutil.ReadFile(name)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func contents(t *testing.T, r *RotateWriter) []string {
+	var all []string
+	for _, name := range r.Backups() {
+		all = append(all, read(t, name))
+	}
+	return append(all, read(t, r.filename))
+}
+
+func TestRotateWriterSize(t *testing.T) {
+	r, dir := newTest(t, WithMaxSize(10))
+	n, err := r.Write([]byte("aaaa\nbbbb\ncccc\n"))
+	require.NoError(t, err)
+	require.Equal(t, 15, n)
+	// a partial line is never split from the rest of it
+	r.Write([]byte("dddd"))
+	r.Write([]byte("eeeeee\nf\n"))
+	require.NoError(t, r.Close())
+
+	require.Equal(t, []string{"aaaa\nbbbb\n", "cccc\nddddeeeeee\n", "f\n"}, contents(t, r))
+	backups := r.Backups()
+	require.Equal(t, filepath.Join(dir, "app-20200102T030407.000.log"), backups[0])
+}
+
+func TestRotateWriterAge(t *testing.T) {
+	r, _ := newTest(t, WithMaxAge(3*time.Second))
+	// each due check reads the clock, which advances a second
+	r.Write([]byte("a\nb\nc\nd\n"))
+	require.NoError(t, r.Close())
+	require.Equal(t, []string{"a\nb\nc\n", "d\n"}, contents(t, r))
+}
+
+func TestRotateWriterCompressAndPrune(t *testing.T) {
+	r, dir := newTest(t, WithMaxSize(2), WithCompress(), WithMaxBackups(2),
+		WithPattern("old/{time}{ext}"), WithTimeFormat("150405"))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "old"), 0755))
+	r.Write([]byte("1\n2\n3\n4\n"))
+	require.NoError(t, r.Close())
+
+	backups := r.Backups()
+	require.Len(t, backups, 2)
+	for i, want := range []string{"2\n", "3\n"} {
+		require.Equal(t, ".gz", filepath.Ext(backups[i]))
+		f, err := os.Open(backups[i])
+		require.NoError(t, err)
+		gz, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(gz)
+		require.NoError(t, err)
+		require.Equal(t, want, string(data))
+		f.Close()
+	}
+	require.Equal(t, "4\n", read(t, filepath.Join(dir, "app.log")))
+}
+
+func TestRotateWriterRotate(t *testing.T) {
+	r, _ := newTest(t)
+	require.NoError(t, r.Rotate())
+	require.Empty(t, r.Backups(), "empty files aren't rotated")
+	r.Write([]byte("x\n"))
+	require.NoError(t, r.Rotate())
+	r.Write([]byte("y\n"))
+	require.NoError(t, r.Sync())
+	require.Equal(t, []string{"x\n", "y\n"}, contents(t, r))
+
+	require.NoError(t, r.Close())
+	_, err := r.Write([]byte("z\n"))
+	require.Equal(t, ErrClosed, err)
+	require.Equal(t, ErrClosed, r.Rotate())
+}
+
+func TestRotateWriterAppends(t *testing.T) {
+	r, dir := newTest(t, WithMaxSize(4))
+	r.Write([]byte("ab\n"))
+	require.NoError(t, r.Close())
+
+	r, err := New(filepath.Join(dir, "app.log"), WithMaxSize(4))
+	require.NoError(t, err)
+	r.Write([]byte("cd\n"))
+	require.NoError(t, r.Close())
+	require.Equal(t, []string{"ab\n", "cd\n"}, contents(t, r))
+
+	_, err = New(filepath.Join(dir, "app.log"), WithPattern("{name}.old"))
+	require.Error(t, err)
+}
+
+func TestRotateWriterShutdown(t *testing.T) {
+	r, _ := newTest(t, WithMaxSize(4))
+	r.FlushOnIdle(time.Millisecond)
+	r.Write([]byte("a\nb\nc\n"))
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, r.Shutdown(context.Background()))
+	require.Equal(t, []string{"a\nb\n", "c\n"}, contents(t, r))
+
+	_, err := r.Write([]byte("d\n"))
+	require.Equal(t, ErrClosed, err)
+	require.NoError(t, r.Shutdown(context.Background()))
+}
+
+func TestRotateWriterOnlyPrunesBackups(t *testing.T) {
+	r, dir := newTest(t, WithMaxBackups(1))
+	// these match the backup glob, but aren't backups
+	for _, name := range []string{"app-debug.log", "app-debug-20200102T030405.000.log", "app-1.log.gz"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("keep\n"), 0644))
+	}
+
+	for _, line := range []string{"a\n", "b\n", "c\n"} {
+		r.Write([]byte(line))
+		require.NoError(t, r.Rotate())
+	}
+	require.NoError(t, r.Close())
+
+	require.Len(t, r.Backups(), 1)
+	for _, name := range []string{"app-debug.log", "app-debug-20200102T030405.000.log", "app-1.log.gz"} {
+		require.Equal(t, "keep\n", read(t, filepath.Join(dir, name)))
+	}
+}
+
+func TestRotateWriterRenameFails(t *testing.T) {
+	r, dir := newTest(t, WithPattern("old/{time}{ext}"))
+	r.Write([]byte("a\n"))
+	// the backup directory doesn't exist yet
+	require.Error(t, r.Rotate())
+
+	_, err := r.Write([]byte("b\n"))
+	require.NoError(t, err)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "old"), 0755))
+	require.NoError(t, r.Rotate())
+	r.Write([]byte("c\n"))
+	require.NoError(t, r.Close())
+	require.Equal(t, []string{"a\nb\n", "c\n"}, contents(t, r))
+}
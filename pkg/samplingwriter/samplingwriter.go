@@ -0,0 +1,149 @@
+package samplingwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"io"
+	"math/rand"
+	"regexp"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+	"github.com/ndau/writers/pkg/writers"
+)
+
+// SamplingWriter wraps an io.Writer and forwards only a sample of the
+// lines written to it.
+//
+// The sample is either every Nth line (see WithEveryN) or a random fraction
+// of lines (see WithFraction). Lines matching any of the must-keep patterns
+// (see WithKeep) are always forwarded, and do not count towards the sample.
+//
+// The intent is that you can wrap debug-level output cheaply in production
+// while still seeing every line which really matters.
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush method so that a trailing partial line is considered for the
+// sample. SamplingWriter is not safe for concurrent use.
+type SamplingWriter struct {
+	w      io.Writer
+	lines  *linebuffer.LineBuffer
+	sample func() bool
+	keep   []*regexp.Regexp
+	random func() float64
+}
+
+// static assert that SamplingWriter is an io.Writer
+var _ io.Writer = (*SamplingWriter)(nil)
+
+// static assert that SamplingWriter implements Stats
+var _ writers.Stats = (*SamplingWriter)(nil)
+
+// Option configures a SamplingWriter
+type Option func(*SamplingWriter)
+
+// WithEveryN forwards one line in every n, starting with the first.
+//
+// Values of n less than 2 forward every line.
+func WithEveryN(n int) Option {
+	return func(s *SamplingWriter) {
+		seen := 0
+		s.sample = func() bool {
+			selected := n < 2 || seen%n == 0
+			seen++
+			return selected
+		}
+	}
+}
+
+// WithFraction forwards each line with probability f, which should be
+// in the range [0, 1].
+func WithFraction(f float64) Option {
+	return func(s *SamplingWriter) {
+		s.sample = func() bool {
+			return s.random() < f
+		}
+	}
+}
+
+// WithKeep adds patterns for lines which must always be forwarded
+func WithKeep(patterns ...*regexp.Regexp) Option {
+	return func(s *SamplingWriter) {
+		s.keep = append(s.keep, patterns...)
+	}
+}
+
+// WithRandom sets the source of randomness used by WithFraction.
+//
+// It must return values in the range [0, 1). It defaults to rand.Float64.
+func WithRandom(random func() float64) Option {
+	return func(s *SamplingWriter) {
+		s.random = random
+	}
+}
+
+// New creates a new SamplingWriter.
+//
+// With no options, every line is forwarded.
+func New(w io.Writer, opts ...Option) *SamplingWriter {
+	s := &SamplingWriter{
+		w:      w,
+		random: rand.Float64,
+		sample: func() bool { return true },
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.lines = linebuffer.New(s.writeLine)
+	return s
+}
+
+// Write writes the contents of p.
+//
+// It returns the number of bytes consumed, whether or not they were
+// forwarded by the sample.
+func (s *SamplingWriter) Write(p []byte) (int, error) {
+	return s.lines.Write(p)
+}
+
+// Flush considers any buffered partial line for the sample, and forwards
+// it if selected.
+func (s *SamplingWriter) Flush() error {
+	return s.lines.Flush()
+}
+
+// FlushStats implements writers.Stats.
+//
+// Each complete line counts as a flush, whether or not it was forwarded.
+func (s *SamplingWriter) FlushStats() writers.FlushStats {
+	return s.lines.FlushStats()
+}
+
+// Unwrap returns the underlying writer
+func (s *SamplingWriter) Unwrap() io.Writer {
+	return s.w
+}
+
+func (s *SamplingWriter) writeLine(line []byte) error {
+	if !s.mustKeep(line) && !s.sample() {
+		return nil
+	}
+	_, err := s.w.Write(line)
+	return err
+}
+
+func (s *SamplingWriter) mustKeep(line []byte) bool {
+	for _, pattern := range s.keep {
+		if pattern.Match(line) {
+			return true
+		}
+	}
+	return false
+}
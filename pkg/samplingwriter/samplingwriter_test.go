@@ -0,0 +1,80 @@
+package samplingwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/ndau/writers/pkg/samplingwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSamplingWriterDefaultForwardsEverything(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := samplingwriter.New(buffer)
+
+	_, err := writer.Write([]byte("one\ntwo\nthree"))
+	require.NoError(t, err)
+	require.Equal(t, "one\ntwo\n", buffer.String())
+	require.NoError(t, writer.Flush())
+	require.Equal(t, "one\ntwo\nthree", buffer.String())
+}
+
+func TestSamplingWriterEveryN(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := samplingwriter.New(
+		buffer,
+		samplingwriter.WithEveryN(3),
+		samplingwriter.WithKeep(regexp.MustCompile(`ERROR`)),
+	)
+
+	for i := 0; i < 7; i++ {
+		fmt.Fprintf(writer, "debug %d\n", i)
+		if i == 1 {
+			fmt.Fprintln(writer, "ERROR kept")
+		}
+	}
+	require.Equal(t, "debug 0\nERROR kept\ndebug 3\ndebug 6\n", buffer.String())
+}
+
+func TestSamplingWriterFraction(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	values := []float64{0.1, 0.9, 0.4, 0.6}
+	writer := samplingwriter.New(
+		buffer,
+		samplingwriter.WithFraction(0.5),
+		samplingwriter.WithRandom(func() float64 {
+			v := values[0]
+			values = values[1:]
+			return v
+		}),
+	)
+
+	_, err := writer.Write([]byte("a\nb\nc\nd\n"))
+	require.NoError(t, err)
+	require.Equal(t, "a\nc\n", buffer.String())
+}
+
+func TestSamplingWriterZeroFractionKeepsOnlyMatches(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := samplingwriter.New(
+		buffer,
+		samplingwriter.WithFraction(0),
+		samplingwriter.WithKeep(regexp.MustCompile(`^WARN`), regexp.MustCompile(`^ERROR`)),
+	)
+
+	_, err := writer.Write([]byte("INFO a\nWARN b\nDEBUG c\nERROR d\n"))
+	require.NoError(t, err)
+	require.Equal(t, "WARN b\nERROR d\n", buffer.String())
+}
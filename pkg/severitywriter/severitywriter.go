@@ -0,0 +1,86 @@
+package severitywriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/ndau/writers/pkg/demuxwriter"
+)
+
+// DefaultErrorTokens are the level tokens which mark a line as an error,
+// unless others are configured with WithErrorTokens
+var DefaultErrorTokens = []string{"ERROR", "FATAL", "PANIC", "CRITICAL"}
+
+type config struct {
+	tokens     []string
+	ignoreCase bool
+}
+
+// Option configures the splitter
+type Option func(*config)
+
+// WithErrorTokens replaces the level tokens which mark a line as an error.
+//
+// For example, WithErrorTokens("ERROR", "WARN") also sends warnings to
+// the error writer. With no tokens, every line goes to the output writer.
+func WithErrorTokens(tokens ...string) Option {
+	return func(c *config) {
+		c.tokens = tokens
+	}
+}
+
+// WithIgnoreCase matches the error tokens case-insensitively, so that
+// ERROR also matches "level=error"
+func WithIgnoreCase() Option {
+	return func(c *config) {
+		c.ignoreCase = true
+	}
+}
+
+// New creates a writer which sends every line containing an error token to
+// errw (typically os.Stderr), and every other line to outw (typically
+// os.Stdout).
+//
+// This is handy when adapting libraries which only accept a single
+// io.Writer. Tokens only match as whole words, so by default "ERROR"
+// matches "ERROR: oops" and "[ERROR]", but not "ERRORS" or "no error".
+//
+// The splitter is a DemuxWriter, so the client should call Flush after
+// all data has been written.
+func New(errw, outw io.Writer, opts ...Option) *demuxwriter.DemuxWriter {
+	c := config{tokens: DefaultErrorTokens}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return demuxwriter.New(outw,
+		demuxwriter.Route{Pattern: Pattern(c.tokens, c.ignoreCase), W: errw},
+	)
+}
+
+// Pattern returns a regular expression which matches any of the tokens as
+// a whole word. If there are no tokens, it matches nothing.
+func Pattern(tokens []string, ignoreCase bool) *regexp.Regexp {
+	if len(tokens) == 0 {
+		return regexp.MustCompile(`[^\s\S]`)
+	}
+	quoted := make([]string, len(tokens))
+	for i, token := range tokens {
+		quoted[i] = regexp.QuoteMeta(token)
+	}
+	flags := ""
+	if ignoreCase {
+		flags = "(?i)"
+	}
+	return regexp.MustCompile(flags + `\b(?:` + strings.Join(quoted, "|") + `)\b`)
+}
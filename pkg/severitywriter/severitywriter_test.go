@@ -0,0 +1,59 @@
+package severitywriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ndau/writers/pkg/severitywriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeverityWriterDefaults(t *testing.T) {
+	stderr := new(bytes.Buffer)
+	stdout := new(bytes.Buffer)
+	writer := severitywriter.New(stderr, stdout)
+
+	_, err := writer.Write([]byte("INFO ready\n[ERROR] boom\nWARN careful\nno error here\nFATAL: dead\nERRORS are words"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Flush())
+
+	require.Equal(t, "[ERROR] boom\nFATAL: dead\n", stderr.String())
+	require.Equal(t, "INFO ready\nWARN careful\nno error here\nERRORS are words", stdout.String())
+}
+
+func TestSeverityWriterConfigured(t *testing.T) {
+	stderr := new(bytes.Buffer)
+	stdout := new(bytes.Buffer)
+	writer := severitywriter.New(stderr, stdout,
+		severitywriter.WithErrorTokens("error", "warn"),
+		severitywriter.WithIgnoreCase(),
+	)
+
+	_, err := writer.Write([]byte("level=info msg=ok\nlevel=warn msg=hmm\nlevel=ERROR msg=bad\n"))
+	require.NoError(t, err)
+	require.Equal(t, "level=warn msg=hmm\nlevel=ERROR msg=bad\n", stderr.String())
+	require.Equal(t, "level=info msg=ok\n", stdout.String())
+}
+
+func TestSeverityWriterNoTokens(t *testing.T) {
+	stderr := new(bytes.Buffer)
+	stdout := new(bytes.Buffer)
+	writer := severitywriter.New(stderr, stdout, severitywriter.WithErrorTokens())
+
+	_, err := writer.Write([]byte("level=info msg=ok\nlevel=ERROR msg=bad\n"))
+	require.NoError(t, err)
+	require.Empty(t, stderr.String())
+	require.Equal(t, "level=info msg=ok\nlevel=ERROR msg=bad\n", stdout.String())
+	require.False(t, severitywriter.Pattern(nil, false).MatchString("anything at all"))
+	require.False(t, severitywriter.Pattern(nil, false).MatchString(""))
+}
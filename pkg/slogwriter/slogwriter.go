@@ -0,0 +1,208 @@
+package slogwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+	"github.com/ndau/writers/pkg/linewriter"
+	"github.com/ndau/writers/pkg/severitywriter"
+)
+
+// NewTextHandler returns a slog.Handler which writes records in text
+// format, through a LineWriter wrapping w. The handler serializes its
+// writes, so w can be any chain of this package's writers, whether or not
+// they're safe for concurrent use.
+func NewTextHandler(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+	return slog.NewTextHandler(linewriter.New(w), opts)
+}
+
+// NewJSONHandler returns a slog.Handler which writes records as JSON,
+// through a LineWriter wrapping w. The handler serializes its writes, so w
+// can be any chain of this package's writers, whether or not they're safe
+// for concurrent use.
+func NewJSONHandler(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+	return slog.NewJSONHandler(linewriter.New(w), opts)
+}
+
+type levelRule struct {
+	pattern *regexp.Regexp
+	level   slog.Level
+}
+
+var levelRules = []levelRule{
+	{severitywriter.Pattern([]string{"ERROR", "ERR", "FATAL", "PANIC", "CRITICAL"}, false), slog.LevelError},
+	{severitywriter.Pattern([]string{"WARN", "WARNING"}, false), slog.LevelWarn},
+	{severitywriter.Pattern([]string{"INFO"}, false), slog.LevelInfo},
+	{severitywriter.Pattern([]string{"DEBUG", "TRACE"}, false), slog.LevelDebug},
+}
+
+// DetectLevel looks for a level token in line, such as ERROR or WARN, as a
+// whole upper-case word. It reports false if there is none.
+func DetectLevel(line []byte) (slog.Level, bool) {
+	for _, rule := range levelRules {
+		if rule.pattern.Match(line) {
+			return rule.level, true
+		}
+	}
+	return 0, false
+}
+
+// Writer re-emits each completed line written to it as a record through a
+// slog.Logger. This lets code which only knows how to write to an
+// io.Writer, such as a subprocess or a library using the log package, feed
+// into structured logging.
+//
+// The level of each record is found by the level function, which by
+// default uses DetectLevel and falls back to the default level. With
+// WithJSON, lines which are JSON objects are taken apart: msg (or message)
+// becomes the message, level the level, and the other fields, apart from
+// time, become attributes.
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush method to log any partial line.
+//
+// Writer is not safe for concurrent use.
+type Writer struct {
+	logger       *slog.Logger
+	ctx          context.Context
+	defaultLevel slog.Level
+	levelFunc    func(line []byte) (slog.Level, bool)
+	json         bool
+	lines        *linebuffer.LineBuffer
+}
+
+// static assert that Writer is an io.Writer
+var _ io.Writer = (*Writer)(nil)
+
+// Option configures a Writer
+type Option func(*Writer)
+
+// WithDefaultLevel sets the level of lines whose level can't be found. The
+// default is slog.LevelInfo.
+func WithDefaultLevel(level slog.Level) Option {
+	return func(w *Writer) {
+		w.defaultLevel = level
+	}
+}
+
+// WithLevelFunc replaces DetectLevel as the way to find the level of a
+// line
+func WithLevelFunc(f func(line []byte) (slog.Level, bool)) Option {
+	return func(w *Writer) {
+		w.levelFunc = f
+	}
+}
+
+// WithJSON takes apart lines which are JSON objects
+func WithJSON() Option {
+	return func(w *Writer) {
+		w.json = true
+	}
+}
+
+// WithContext sets the context passed to the logger
+func WithContext(ctx context.Context) Option {
+	return func(w *Writer) {
+		w.ctx = ctx
+	}
+}
+
+// NewWriter creates a new Writer which logs through logger
+func NewWriter(logger *slog.Logger, opts ...Option) *Writer {
+	w := &Writer{
+		logger:       logger,
+		ctx:          context.Background(),
+		defaultLevel: slog.LevelInfo,
+		levelFunc:    DetectLevel,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.lines = linebuffer.New(w.log)
+	return w
+}
+
+// Write writes the contents of p, logging every line completed by it
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.lines.Write(p)
+}
+
+// Flush logs any partial line
+func (w *Writer) Flush() error {
+	return w.lines.Flush()
+}
+
+// log is the LineBuffer handler
+func (w *Writer) log(line []byte) error {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+
+	if w.json && w.logJSON(line) {
+		return nil
+	}
+	level, ok := w.levelFunc(line)
+	if !ok {
+		level = w.defaultLevel
+	}
+	w.logger.Log(w.ctx, level, string(line))
+	return nil
+}
+
+// logJSON logs line if it's a JSON object, and reports whether it was
+func (w *Writer) logJSON(line []byte) bool {
+	var fields map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if dec.Decode(&fields) != nil || dec.More() {
+		return false
+	}
+
+	level, ok := w.levelFunc(line)
+	if !ok {
+		level = w.defaultLevel
+	}
+	if s, isString := fields["level"].(string); isString {
+		if level.UnmarshalText([]byte(strings.ToUpper(s))) == nil {
+			delete(fields, "level")
+		}
+	}
+
+	var msg string
+	for _, key := range []string{"msg", "message"} {
+		if s, isString := fields[key].(string); isString {
+			msg = s
+			delete(fields, key)
+			break
+		}
+	}
+	delete(fields, "time")
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]slog.Attr, len(keys))
+	for i, k := range keys {
+		attrs[i] = slog.Any(k, fields[k])
+	}
+	w.logger.LogAttrs(w.ctx, level, msg, attrs...)
+	return true
+}
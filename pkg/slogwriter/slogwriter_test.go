@@ -0,0 +1,98 @@
+package slogwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ndau/writers/pkg/slogwriter"
+	"github.com/stretchr/testify/require"
+)
+
+// chunks records each write it receives
+type chunks struct {
+	writes []string
+}
+
+func (c *chunks) Write(p []byte) (int, error) {
+	c.writes = append(c.writes, string(p))
+	return len(p), nil
+}
+
+func noTime(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.TimeKey && len(groups) == 0 {
+		return slog.Attr{}
+	}
+	return a
+}
+
+func TestHandlers(t *testing.T) {
+	var c chunks
+	logger := slog.New(slogwriter.NewTextHandler(&c, &slog.HandlerOptions{ReplaceAttr: noTime}))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			logger.Info("hello", "i", i)
+		}(i)
+	}
+	wg.Wait()
+	require.Len(t, c.writes, 10)
+	for _, w := range c.writes {
+		require.True(t, strings.HasPrefix(w, "level=INFO msg=hello i="), w)
+	}
+
+	c.writes = nil
+	logger = slog.New(slogwriter.NewJSONHandler(&c, &slog.HandlerOptions{ReplaceAttr: noTime}))
+	logger.Warn("careful", "n", 1)
+	require.Equal(t, []string{`{"level":"WARN","msg":"careful","n":1}` + "\n"}, c.writes)
+}
+
+func TestWriter(t *testing.T) {
+	var sb strings.Builder
+	logger := slog.New(slog.NewTextHandler(&sb, &slog.HandlerOptions{
+		Level:       slog.LevelDebug,
+		ReplaceAttr: noTime,
+	}))
+	w := slogwriter.NewWriter(logger)
+	_, err := w.Write([]byte("starting\r\nERROR: disk full\n[DEBUG] x=1"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	require.Equal(t, ""+
+		"level=INFO msg=starting\n"+
+		"level=ERROR msg=\"ERROR: disk full\"\n"+
+		"level=DEBUG msg=\"[DEBUG] x=1\"\n",
+		sb.String())
+}
+
+func TestWriterJSON(t *testing.T) {
+	var sb strings.Builder
+	logger := slog.New(slog.NewJSONHandler(&sb, &slog.HandlerOptions{ReplaceAttr: noTime}))
+	w := slogwriter.NewWriter(logger, slogwriter.WithJSON(), slogwriter.WithDefaultLevel(slog.LevelWarn))
+	w.Write([]byte(`{"time":"x","level":"error","message":"failed","code":500,"user":"bob"}` + "\n"))
+	w.Write([]byte("not json\n"))
+	require.Equal(t, ""+
+		`{"level":"ERROR","msg":"failed","code":500,"user":"bob"}`+"\n"+
+		`{"level":"WARN","msg":"not json"}`+"\n",
+		sb.String())
+}
+
+func TestDetectLevel(t *testing.T) {
+	level, ok := slogwriter.DetectLevel([]byte("2020/01/02 WARNING: low memory"))
+	require.True(t, ok)
+	require.Equal(t, slog.LevelWarn, level)
+	_, ok = slogwriter.DetectLevel([]byte("no errors here"))
+	require.False(t, ok)
+}
@@ -0,0 +1,130 @@
+package slowwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// SlowWriter is a test helper which passes writes through to an underlying
+// writer slowly, to simulate a slow network or disk: it waits before each
+// write, and can split each write into small chunks, each with its own
+// wait, so that the underlying writer sees the partial writes a socket
+// would.
+//
+// The wait is a fixed latency plus a random jitter. The jitter comes from
+// a seeded source, so a test sees the same sequence of delays every time
+// it runs.
+//
+// SlowWriter is safe for concurrent use; concurrent writes wait in turn.
+type SlowWriter struct {
+	w       io.Writer
+	latency time.Duration
+	jitter  time.Duration
+	chunk   int
+	sleep   func(time.Duration)
+
+	mutex  sync.Mutex
+	random *rand.Rand
+}
+
+// static assert that SlowWriter is an io.Writer
+var _ io.Writer = (*SlowWriter)(nil)
+
+// Option configures a SlowWriter
+type Option func(*SlowWriter)
+
+// WithLatency waits for d before each write
+func WithLatency(d time.Duration) Option {
+	return func(s *SlowWriter) {
+		s.latency = d
+	}
+}
+
+// WithJitter adds a random delay of up to d to each wait
+func WithJitter(d time.Duration) Option {
+	return func(s *SlowWriter) {
+		s.jitter = d
+	}
+}
+
+// WithChunkSize passes each write to the underlying writer in chunks of at
+// most n bytes, waiting before each chunk
+func WithChunkSize(n int) Option {
+	return func(s *SlowWriter) {
+		s.chunk = n
+	}
+}
+
+// WithSeed seeds the source of the jitter; the default seed is 1
+func WithSeed(seed int64) Option {
+	return func(s *SlowWriter) {
+		s.random = rand.New(rand.NewSource(seed))
+	}
+}
+
+// New creates a new SlowWriter
+func New(w io.Writer, opts ...Option) *SlowWriter {
+	s := &SlowWriter{
+		w:      w,
+		sleep:  time.Sleep,
+		random: rand.New(rand.NewSource(1)),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Write waits, then writes p to the underlying writer, chunk by chunk. If
+// the underlying writer accepts none of a chunk without returning an
+// error, Write returns io.ErrShortWrite.
+func (s *SlowWriter) Write(p []byte) (n int, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for {
+		chunk := p[n:]
+		if s.chunk > 0 && len(chunk) > s.chunk {
+			chunk = chunk[:s.chunk]
+		}
+		s.wait()
+		written, err := s.w.Write(chunk)
+		n += written
+		if err != nil || n == len(p) {
+			return n, err
+		}
+		if written == 0 {
+			// the underlying writer made no progress, and would be
+			// called forever
+			return n, io.ErrShortWrite
+		}
+	}
+}
+
+// Unwrap returns the underlying writer
+func (s *SlowWriter) Unwrap() io.Writer {
+	return s.w
+}
+
+// wait sleeps for the latency and a random jitter; it's called with the
+// lock held
+func (s *SlowWriter) wait() {
+	d := s.latency
+	if s.jitter > 0 {
+		d += time.Duration(s.random.Int63n(int64(s.jitter)))
+	}
+	if d > 0 {
+		s.sleep(d)
+	}
+}
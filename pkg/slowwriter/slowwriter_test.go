@@ -0,0 +1,101 @@
+package slowwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// chunkRecorder records each write it receives
+type chunkRecorder struct {
+	chunks []string
+}
+
+func (c *chunkRecorder) Write(p []byte) (int, error) {
+	c.chunks = append(c.chunks, string(p))
+	return len(p), nil
+}
+
+func newRecorded(w *chunkRecorder, opts ...Option) (*SlowWriter, *[]time.Duration) {
+	s := New(w, opts...)
+	var waits []time.Duration
+	s.sleep = func(d time.Duration) { waits = append(waits, d) }
+	return s, &waits
+}
+
+func TestSlowWriterChunks(t *testing.T) {
+	rec := &chunkRecorder{}
+	s, waits := newRecorded(rec, WithLatency(time.Millisecond), WithChunkSize(3))
+	n, err := s.Write([]byte("abcdefgh"))
+	require.NoError(t, err)
+	require.Equal(t, 8, n)
+	require.Equal(t, []string{"abc", "def", "gh"}, rec.chunks)
+	require.Equal(t, []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond}, *waits)
+}
+
+func TestSlowWriterJitter(t *testing.T) {
+	delays := func(seed int64) []time.Duration {
+		s, waits := newRecorded(&chunkRecorder{},
+			WithLatency(10*time.Millisecond),
+			WithJitter(5*time.Millisecond),
+			WithSeed(seed),
+		)
+		for i := 0; i < 5; i++ {
+			s.Write([]byte("x"))
+		}
+		return *waits
+	}
+
+	first := delays(42)
+	require.Len(t, first, 5)
+	for _, d := range first {
+		require.True(t, d >= 10*time.Millisecond && d < 15*time.Millisecond, d)
+	}
+	require.Equal(t, first, delays(42))
+	require.NotEqual(t, first, delays(7))
+}
+
+func TestSlowWriterSleeps(t *testing.T) {
+	var buf bytes.Buffer
+	s := New(&buf, WithLatency(5*time.Millisecond), WithChunkSize(2))
+	start := time.Now()
+	s.Write([]byte("abcd"))
+	require.True(t, time.Since(start) >= 10*time.Millisecond)
+	require.Equal(t, "abcd", buf.String())
+}
+
+// stalledWriter accepts the first few bytes, and then nothing, without an
+// error
+type stalledWriter struct {
+	left int
+}
+
+func (s *stalledWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if n > s.left {
+		n = s.left
+	}
+	s.left -= n
+	return n, nil
+}
+
+func TestSlowWriterStalled(t *testing.T) {
+	s := New(&stalledWriter{left: 3}, WithChunkSize(4))
+	s.sleep = func(time.Duration) {}
+	n, err := s.Write([]byte("abcdefgh"))
+	require.Equal(t, io.ErrShortWrite, err)
+	require.Equal(t, 3, n)
+}
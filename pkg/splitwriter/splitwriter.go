@@ -0,0 +1,171 @@
+package splitwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrClosed is returned by writes to a SplitWriter which has been closed.
+var ErrClosed = errors.New("splitwriter: write to closed writer")
+
+// SplitWriter shards its output across a numbered series of files,
+// starting a new one every so many bytes or lines. A line is never split
+// between two files; a line which is longer than the maximum size gets a
+// file to itself.
+//
+// File names are made by formatting the file's number, starting at 1, with
+// a pattern such as "export-%04d.csv". Each file is created when the first
+// byte is written to it, so there are no empty files.
+//
+// Data is written straight to the current file, without buffering. After
+// all data has been written, the client must call Close to close the last
+// file. SplitWriter is not safe for concurrent use.
+type SplitWriter struct {
+	pattern  string
+	maxBytes int64
+	maxLines int
+	open     func(name string) (io.WriteCloser, error)
+
+	current io.WriteCloser
+	bytes   int64
+	lines   int
+	midLine bool
+	names   []string
+	closed  bool
+}
+
+// static assert that SplitWriter is an io.WriteCloser
+var _ io.WriteCloser = (*SplitWriter)(nil)
+
+// Option configures a SplitWriter
+type Option func(*SplitWriter)
+
+// WithMaxBytes starts a new file rather than let the current one grow past
+// n bytes
+func WithMaxBytes(n int64) Option {
+	return func(s *SplitWriter) {
+		s.maxBytes = n
+	}
+}
+
+// WithMaxLines starts a new file after every n lines
+func WithMaxLines(n int) Option {
+	return func(s *SplitWriter) {
+		s.maxLines = n
+	}
+}
+
+// WithOpener replaces os.Create as the way to create each file, for
+// example to add compression or write somewhere other than the local disk
+func WithOpener(open func(name string) (io.WriteCloser, error)) Option {
+	return func(s *SplitWriter) {
+		s.open = open
+	}
+}
+
+// New creates a new SplitWriter which names its files with pattern, which
+// must contain a single integer verb such as %04d
+func New(pattern string, opts ...Option) *SplitWriter {
+	s := &SplitWriter{
+		pattern: pattern,
+		open: func(name string) (io.WriteCloser, error) {
+			return os.Create(name)
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Write writes the contents of p, starting new files at line boundaries
+// as needed
+func (s *SplitWriter) Write(p []byte) (n int, err error) {
+	if s.closed {
+		return 0, ErrClosed
+	}
+	for len(p) > 0 {
+		end := bytes.IndexByte(p, '\n') + 1
+		if end == 0 {
+			end = len(p)
+		}
+		if s.current == nil || (!s.midLine && s.full(int64(end))) {
+			if err = s.next(); err != nil {
+				return
+			}
+		}
+		var written int
+		written, err = s.current.Write(p[:end])
+		n += written
+		s.bytes += int64(written)
+		if err != nil {
+			return
+		}
+		s.midLine = p[end-1] != '\n'
+		if !s.midLine {
+			s.lines++
+		}
+		p = p[end:]
+	}
+	return
+}
+
+// Close closes the current file. Further writes return ErrClosed.
+func (s *SplitWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.current == nil {
+		return nil
+	}
+	return s.current.Close()
+}
+
+// Files returns the names of the files created so far, in order
+func (s *SplitWriter) Files() []string {
+	return append([]string(nil), s.names...)
+}
+
+// full reports whether the current file has room for n more bytes
+func (s *SplitWriter) full(n int64) bool {
+	if s.maxLines > 0 && s.lines >= s.maxLines {
+		return true
+	}
+	return s.maxBytes > 0 && s.bytes > 0 && s.bytes+n > s.maxBytes
+}
+
+// next closes the current file, if any, and creates the next one
+func (s *SplitWriter) next() error {
+	if s.current != nil {
+		err := s.current.Close()
+		s.current = nil
+		if err != nil {
+			return err
+		}
+	}
+	name := fmt.Sprintf(s.pattern, len(s.names)+1)
+	f, err := s.open(name)
+	if err != nil {
+		return err
+	}
+	s.current = f
+	s.names = append(s.names, name)
+	s.bytes = 0
+	s.lines = 0
+	s.midLine = false
+	return nil
+}
@@ -0,0 +1,101 @@
+package splitwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ndau/writers/pkg/splitwriter"
+	"github.com/stretchr/testify/require"
+)
+
+// memFiles is an opener which keeps files in memory
+type memFiles struct {
+	files map[string]*memFile
+	fail  bool
+}
+
+type memFile struct {
+	strings.Builder
+	closed bool
+}
+
+func (f *memFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+func (m *memFiles) open(name string) (io.WriteCloser, error) {
+	if m.fail {
+		return nil, errors.New("disk full")
+	}
+	f := &memFile{}
+	m.files[name] = f
+	return f, nil
+}
+
+func (m *memFiles) contents(names []string) []string {
+	var all []string
+	for _, name := range names {
+		all = append(all, m.files[name].String())
+	}
+	return all
+}
+
+func TestSplitWriterLines(t *testing.T) {
+	m := &memFiles{files: map[string]*memFile{}}
+	s := splitwriter.New("part-%04d", splitwriter.WithMaxLines(2), splitwriter.WithOpener(m.open))
+	_, err := s.Write([]byte("a\nb\nc"))
+	require.NoError(t, err)
+	s.Write([]byte("c\nd\ne\n"))
+	require.NoError(t, s.Close())
+
+	require.Equal(t, []string{"part-0001", "part-0002", "part-0003"}, s.Files())
+	require.Equal(t, []string{"a\nb\n", "cc\nd\n", "e\n"}, m.contents(s.Files()))
+	for _, f := range m.files {
+		require.True(t, f.closed)
+	}
+
+	_, err = s.Write([]byte("f\n"))
+	require.Equal(t, splitwriter.ErrClosed, err)
+}
+
+func TestSplitWriterBytes(t *testing.T) {
+	m := &memFiles{files: map[string]*memFile{}}
+	s := splitwriter.New("p%d", splitwriter.WithMaxBytes(6), splitwriter.WithOpener(m.open))
+	s.Write([]byte("aa\nbb\ncc\nthis is long\nd\n"))
+	require.NoError(t, s.Close())
+	require.Equal(t, []string{"aa\nbb\n", "cc\n", "this is long\n", "d\n"}, m.contents(s.Files()))
+}
+
+func TestSplitWriterOpenError(t *testing.T) {
+	m := &memFiles{files: map[string]*memFile{}, fail: true}
+	s := splitwriter.New("p%d", splitwriter.WithOpener(m.open))
+	n, err := s.Write([]byte("a\n"))
+	require.EqualError(t, err, "disk full")
+	require.Zero(t, n)
+	require.NoError(t, s.Close())
+}
+
+func TestSplitWriterFiles(t *testing.T) {
+	dir := t.TempDir()
+	s := splitwriter.New(filepath.Join(dir, "export-%02d.csv"), splitwriter.WithMaxLines(1))
+	s.Write([]byte("x\ny\n"))
+	require.NoError(t, s.Close())
+	data, err := ioutil.ReadFile(filepath.Join(dir, "export-02.csv"))
+	require.NoError(t, err)
+	require.Equal(t, "y\n", string(data))
+}
@@ -0,0 +1,138 @@
+package ssewriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+)
+
+// SSEWriter formats each completed line written to it as a Server-Sent
+// Events frame:
+//
+//	event: <event>
+//	id: <id>
+//	data: <line>
+//
+// The event and id fields are only present when configured. A trailing CR
+// is stripped from each line, so CRLF input doesn't leak into the data.
+//
+// If the underlying writer is an http.Flusher, as http.ResponseWriter
+// usually is, it is flushed after every event so that the client sees it
+// immediately.
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush method to send any partial line.
+//
+// SSEWriter is not safe for concurrent use.
+type SSEWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	lines   *linebuffer.LineBuffer
+	event   string
+	ids     bool
+	nextID  uint64
+	frame   []byte
+}
+
+// static assert that SSEWriter is an io.Writer
+var _ io.Writer = (*SSEWriter)(nil)
+
+// Option configures an SSEWriter
+type Option func(*SSEWriter)
+
+// WithEvent sets the event field of every frame
+func WithEvent(name string) Option {
+	return func(s *SSEWriter) {
+		s.event = name
+	}
+}
+
+// WithIDs numbers frames sequentially in their id field, starting at first.
+//
+// A client which reconnects reports the last id it saw in the
+// Last-Event-ID header; a handler can pass that value plus one as first to
+// keep the sequence going.
+func WithIDs(first uint64) Option {
+	return func(s *SSEWriter) {
+		s.ids = true
+		s.nextID = first
+	}
+}
+
+// SetHeaders sets the response headers an event stream needs. It must be
+// called before anything is written to the response.
+func SetHeaders(h http.Header) {
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+}
+
+// New creates a new SSEWriter
+func New(w io.Writer, opts ...Option) *SSEWriter {
+	s := &SSEWriter{w: w}
+	s.flusher, _ = w.(http.Flusher)
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.lines = linebuffer.New(s.send)
+	return s
+}
+
+// Write writes the contents of p, sending an event for every line
+// completed by it
+func (s *SSEWriter) Write(p []byte) (int, error) {
+	return s.lines.Write(p)
+}
+
+// Flush sends any partial line as an event
+func (s *SSEWriter) Flush() error {
+	return s.lines.Flush()
+}
+
+// Unwrap returns the underlying writer
+func (s *SSEWriter) Unwrap() io.Writer {
+	return s.w
+}
+
+// send is the LineBuffer handler
+func (s *SSEWriter) send(line []byte) error {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+
+	s.frame = s.frame[:0]
+	if s.event != "" {
+		s.frame = append(s.frame, "event: "...)
+		s.frame = append(s.frame, s.event...)
+		s.frame = append(s.frame, '\n')
+	}
+	if s.ids {
+		s.frame = append(s.frame, "id: "...)
+		s.frame = strconv.AppendUint(s.frame, s.nextID, 10)
+		s.frame = append(s.frame, '\n')
+		s.nextID++
+	}
+	s.frame = append(s.frame, "data: "...)
+	s.frame = append(s.frame, line...)
+	s.frame = append(s.frame, '\n', '\n')
+
+	if _, err := s.w.Write(s.frame); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package ssewriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ndau/writers/pkg/ssewriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSEWriterFrames(t *testing.T) {
+	rec := httptest.NewRecorder()
+	s := ssewriter.New(rec)
+	_, err := s.Write([]byte("one\r\ntw"))
+	require.NoError(t, err)
+	require.True(t, rec.Flushed)
+	_, err = s.Write([]byte("o\nthree"))
+	require.NoError(t, err)
+	require.Equal(t, "data: one\n\ndata: two\n\n", rec.Body.String())
+
+	require.NoError(t, s.Flush())
+	require.Equal(t, "data: one\n\ndata: two\n\ndata: three\n\n", rec.Body.String())
+}
+
+func TestSSEWriterEventAndIDs(t *testing.T) {
+	var sb strings.Builder
+	s := ssewriter.New(&sb, ssewriter.WithEvent("log"), ssewriter.WithIDs(7))
+	s.Write([]byte("a\nb\n"))
+	require.Equal(t, "event: log\nid: 7\ndata: a\n\nevent: log\nid: 8\ndata: b\n\n", sb.String())
+}
+
+func TestSSEWriterStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ssewriter.SetHeaders(w.Header())
+		s := ssewriter.New(w)
+		s.Write([]byte("hello\n"))
+		// the client must see the first event before the handler returns
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	r := bufio.NewReader(resp.Body)
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "data: hello\n", line)
+}
@@ -0,0 +1,199 @@
+package syncwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by writes to a SyncWriter which has been closed.
+var ErrClosed = errors.New("syncwriter: write to closed writer")
+
+// Syncer is a writer which can commit what has been written to stable
+// storage. *os.File is a Syncer.
+type Syncer interface {
+	io.Writer
+	Sync() error
+}
+
+// SyncWriter wraps a Syncer, typically an *os.File, and calls its Sync
+// method according to a policy: after every line, after every so many
+// bytes, or within a time interval of an unsynced write. Policies can be
+// combined; a sync for any reason resets them all. With no policy, the
+// file is only synced by Sync and Close.
+//
+// A sync which fails during a Write is returned by that Write, after the
+// data has been written. One which fails on the timer is returned by the
+// next call to Write, Sync or Close.
+//
+// After all data has been written, the client should call Close, which
+// syncs and closes the underlying file. SyncWriter is safe for concurrent
+// use.
+type SyncWriter struct {
+	f        Syncer
+	perLine  bool
+	perBytes int
+	interval time.Duration
+
+	mutex    sync.Mutex
+	unsynced int
+	timer    *time.Timer
+	syncs    uint64
+	err      error
+	closed   bool
+}
+
+// static assert that SyncWriter is an io.WriteCloser
+var _ io.WriteCloser = (*SyncWriter)(nil)
+
+// Option configures a SyncWriter
+type Option func(*SyncWriter)
+
+// WithEveryLine syncs after every Write which completes a line. Lines
+// completed by the same Write share a sync.
+func WithEveryLine() Option {
+	return func(s *SyncWriter) {
+		s.perLine = true
+	}
+}
+
+// WithEveryBytes syncs once n bytes have been written since the last sync
+func WithEveryBytes(n int) Option {
+	return func(s *SyncWriter) {
+		s.perBytes = n
+	}
+}
+
+// WithInterval syncs no later than d after an unsynced write
+func WithInterval(d time.Duration) Option {
+	return func(s *SyncWriter) {
+		s.interval = d
+	}
+}
+
+// New creates a new SyncWriter
+func New(f Syncer, opts ...Option) *SyncWriter {
+	s := &SyncWriter{f: f}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Write writes p to the file, then syncs it if the policy calls for it.
+func (s *SyncWriter) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	if err := s.takeErr(); err != nil {
+		return 0, err
+	}
+
+	n, err := s.f.Write(p)
+	s.unsynced += n
+	if err != nil {
+		return n, err
+	}
+	if n == 0 {
+		return n, nil
+	}
+
+	if (s.perLine && bytes.IndexByte(p, '\n') >= 0) || (s.perBytes > 0 && s.unsynced >= s.perBytes) {
+		return n, s.sync()
+	}
+	if s.interval > 0 && s.timer == nil {
+		s.timer = time.AfterFunc(s.interval, s.onTimer)
+	}
+	return n, nil
+}
+
+// Sync syncs the file now
+func (s *SyncWriter) Sync() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if err := s.takeErr(); err != nil {
+		return err
+	}
+	return s.sync()
+}
+
+// Close syncs the file and stops the timer. If the file is an io.Closer,
+// it's closed too.
+func (s *SyncWriter) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	err := s.takeErr()
+	if serr := s.sync(); err == nil {
+		err = serr
+	}
+	if c, ok := s.f.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Syncs returns the number of times the file has been synced
+func (s *SyncWriter) Syncs() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.syncs
+}
+
+// Unwrap returns the underlying Syncer
+func (s *SyncWriter) Unwrap() io.Writer {
+	return s.f
+}
+
+func (s *SyncWriter) onTimer() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.timer = nil
+	if s.closed || s.unsynced == 0 {
+		return
+	}
+	if err := s.sync(); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// takeErr returns and clears the error from a timed sync; it's called with
+// the lock held
+func (s *SyncWriter) takeErr() error {
+	err := s.err
+	s.err = nil
+	return err
+}
+
+// sync is called with the lock held
+func (s *SyncWriter) sync() error {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.unsynced = 0
+	s.syncs++
+	return s.f.Sync()
+}
@@ -0,0 +1,116 @@
+package syncwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/syncwriter"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFile records the data synced to it
+type fakeFile struct {
+	lock    sync.Mutex
+	data    strings.Builder
+	synced  []string
+	syncErr error
+	closed  bool
+}
+
+func (f *fakeFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.data.Write(p)
+}
+
+func (f *fakeFile) Sync() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.synced = append(f.synced, f.data.String())
+	return f.syncErr
+}
+
+func (f *fakeFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+func (f *fakeFile) syncedData() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string(nil), f.synced...)
+}
+
+func TestSyncWriterEveryLine(t *testing.T) {
+	f := &fakeFile{}
+	s := syncwriter.New(f, syncwriter.WithEveryLine())
+	s.Write([]byte("par"))
+	s.Write([]byte("tial\nmore\nlines\n"))
+	s.Write([]byte("x"))
+	require.Equal(t, []string{"partial\nmore\nlines\n"}, f.syncedData())
+	require.NoError(t, s.Close())
+	require.Equal(t, []string{"partial\nmore\nlines\n", "partial\nmore\nlines\nx"}, f.syncedData())
+	require.True(t, f.closed)
+	require.Equal(t, uint64(2), s.Syncs())
+
+	_, err := s.Write([]byte("late"))
+	require.Equal(t, syncwriter.ErrClosed, err)
+}
+
+func TestSyncWriterEveryBytes(t *testing.T) {
+	f := &fakeFile{}
+	s := syncwriter.New(f, syncwriter.WithEveryBytes(4))
+	s.Write([]byte("ab"))
+	s.Write([]byte("cd"))
+	s.Write([]byte("efg"))
+	require.Equal(t, []string{"abcd"}, f.syncedData())
+	require.NoError(t, s.Sync())
+	s.Write([]byte("h"))
+	require.Equal(t, []string{"abcd", "abcdefg"}, f.syncedData())
+}
+
+func TestSyncWriterInterval(t *testing.T) {
+	f := &fakeFile{}
+	s := syncwriter.New(f, syncwriter.WithInterval(10*time.Millisecond))
+	s.Write([]byte("a"))
+	s.Write([]byte("b"))
+	require.Eventually(t, func() bool {
+		return len(f.syncedData()) == 1
+	}, time.Second, time.Millisecond)
+	require.Equal(t, []string{"ab"}, f.syncedData())
+
+	f.syncErr = errors.New("io error")
+	s.Write([]byte("c"))
+	require.Eventually(t, func() bool {
+		return len(f.syncedData()) == 2
+	}, time.Second, time.Millisecond)
+	_, err := s.Write([]byte("d"))
+	require.EqualError(t, err, "io error")
+	f.syncErr = nil
+	require.NoError(t, s.Close())
+}
+
+func TestSyncWriterFile(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "audit.log"))
+	require.NoError(t, err)
+	s := syncwriter.New(f, syncwriter.WithEveryLine())
+	_, err = s.Write([]byte("entry\n"))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+	require.Error(t, f.Close(), "already closed")
+}
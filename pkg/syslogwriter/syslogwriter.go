@@ -0,0 +1,297 @@
+package syslogwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+	"github.com/ndau/writers/pkg/severitywriter"
+)
+
+// Severity is a syslog severity level
+type Severity int
+
+// These are the severities defined by RFC 5424
+const (
+	Emergency Severity = iota
+	Alert
+	Critical
+	Error
+	Warning
+	Notice
+	Info
+	Debug
+)
+
+// Facility is a syslog facility
+type Facility int
+
+// These are the most commonly used facilities defined by RFC 5424
+const (
+	Kern   Facility = 0
+	User   Facility = 1
+	Daemon Facility = 3
+	Local0 Facility = 16
+	Local1 Facility = 17
+	Local2 Facility = 18
+	Local3 Facility = 19
+	Local4 Facility = 20
+	Local5 Facility = 21
+	Local6 Facility = 22
+	Local7 Facility = 23
+)
+
+// timestampFormat is RFC 3339 limited to the microsecond precision RFC 5424
+// allows
+const timestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// Rule assigns a severity to lines matching a pattern
+type Rule struct {
+	Pattern  *regexp.Regexp
+	Severity Severity
+}
+
+// DefaultRules are the rules used unless others are configured with
+// WithRules. They match the usual level tokens as whole, upper-case words.
+var DefaultRules = []Rule{
+	{severitywriter.Pattern([]string{"EMERG", "EMERGENCY"}, false), Emergency},
+	{severitywriter.Pattern([]string{"ALERT"}, false), Alert},
+	{severitywriter.Pattern([]string{"CRIT", "CRITICAL", "FATAL", "PANIC"}, false), Critical},
+	{severitywriter.Pattern([]string{"ERR", "ERROR"}, false), Error},
+	{severitywriter.Pattern([]string{"WARN", "WARNING"}, false), Warning},
+	{severitywriter.Pattern([]string{"NOTICE"}, false), Notice},
+	{severitywriter.Pattern([]string{"INFO"}, false), Info},
+	{severitywriter.Pattern([]string{"DEBUG", "TRACE"}, false), Debug},
+}
+
+// SyslogWriter wraps each completed line written to it in RFC 5424 syslog
+// framing, and writes it to the underlying writer as a single message.
+//
+// The severity of each line is taken from the first Rule whose pattern
+// matches it, or the default severity if none does. When octet counting is
+// on, each message is prefixed with its length as described in RFC 6587,
+// which is how messages are delimited over stream transports.
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush method to send any partial line; a writer created by Dial
+// should be closed instead.
+//
+// SyslogWriter is not safe for concurrent use.
+type SyslogWriter struct {
+	w               io.Writer
+	closer          io.Closer
+	lines           *linebuffer.LineBuffer
+	octetCounting   bool
+	facility        Facility
+	defaultSeverity Severity
+	rules           []Rule
+	hostname        string
+	appName         string
+	procID          string
+	msgID           string
+	now             func() time.Time
+	msg             []byte
+	frame           []byte
+}
+
+// static assert that SyslogWriter is an io.WriteCloser
+var _ io.WriteCloser = (*SyslogWriter)(nil)
+
+// Option configures a SyslogWriter
+type Option func(*SyslogWriter)
+
+// WithFacility sets the facility of every message. The default is User.
+func WithFacility(f Facility) Option {
+	return func(s *SyslogWriter) {
+		s.facility = f
+	}
+}
+
+// WithDefaultSeverity sets the severity of lines which match no rule. The
+// default is Info.
+func WithDefaultSeverity(sev Severity) Option {
+	return func(s *SyslogWriter) {
+		s.defaultSeverity = sev
+	}
+}
+
+// WithRules replaces the rules which infer the severity of a line
+func WithRules(rules ...Rule) Option {
+	return func(s *SyslogWriter) {
+		s.rules = rules
+	}
+}
+
+// WithHostname sets the HOSTNAME field. The default is os.Hostname.
+func WithHostname(name string) Option {
+	return func(s *SyslogWriter) {
+		s.hostname = name
+	}
+}
+
+// WithAppName sets the APP-NAME field. The default is the base name of the
+// running program.
+func WithAppName(name string) Option {
+	return func(s *SyslogWriter) {
+		s.appName = name
+	}
+}
+
+// WithMsgID sets the MSGID field, which is nil by default
+func WithMsgID(id string) Option {
+	return func(s *SyslogWriter) {
+		s.msgID = id
+	}
+}
+
+// WithOctetCounting turns RFC 6587 octet counting on or off. Dial turns it
+// on for stream networks; New leaves it off unless this option is given.
+func WithOctetCounting(on bool) Option {
+	return func(s *SyslogWriter) {
+		s.octetCounting = on
+	}
+}
+
+// New creates a new SyslogWriter which writes messages to w
+func New(w io.Writer, opts ...Option) *SyslogWriter {
+	hostname, _ := os.Hostname()
+	s := &SyslogWriter{
+		w:               w,
+		facility:        User,
+		defaultSeverity: Info,
+		rules:           DefaultRules,
+		hostname:        hostname,
+		appName:         filepath.Base(os.Args[0]),
+		procID:          strconv.Itoa(os.Getpid()),
+		now:             time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.hostname = field(s.hostname, 255)
+	s.appName = field(s.appName, 48)
+	s.procID = field(s.procID, 128)
+	s.msgID = field(s.msgID, 32)
+	s.lines = linebuffer.New(s.send)
+	return s
+}
+
+// Dial connects to a syslog server and returns a SyslogWriter which sends
+// messages to it. Network is as for net.Dial: "udp" and "unixgram" send
+// one datagram per message, while "tcp" and "unix" use octet counting.
+//
+// The connection is not re-established if it fails.
+func Dial(network, addr string, opts ...Option) (*SyslogWriter, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		opts = append([]Option{WithOctetCounting(true)}, opts...)
+	}
+	s := New(conn, opts...)
+	s.closer = conn
+	return s, nil
+}
+
+// Write writes the contents of p, sending a message for every line
+// completed by it
+func (s *SyslogWriter) Write(p []byte) (int, error) {
+	return s.lines.Write(p)
+}
+
+// Flush sends any partial line as a message
+func (s *SyslogWriter) Flush() error {
+	return s.lines.Flush()
+}
+
+// Close flushes the writer, and closes the connection if it was created
+// by Dial
+func (s *SyslogWriter) Close() error {
+	err := s.Flush()
+	if s.closer != nil {
+		if cerr := s.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Severity returns the severity the rules assign to line
+func (s *SyslogWriter) Severity(line []byte) Severity {
+	for _, rule := range s.rules {
+		if rule.Pattern.Match(line) {
+			return rule.Severity
+		}
+	}
+	return s.defaultSeverity
+}
+
+// Unwrap returns the underlying writer
+func (s *SyslogWriter) Unwrap() io.Writer {
+	return s.w
+}
+
+// send is the LineBuffer handler
+func (s *SyslogWriter) send(line []byte) error {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+
+	pri := int(s.facility)*8 + int(s.Severity(line))
+	s.msg = append(s.msg[:0], '<')
+	s.msg = strconv.AppendInt(s.msg, int64(pri), 10)
+	s.msg = append(s.msg, ">1 "...)
+	s.msg = s.now().AppendFormat(s.msg, timestampFormat)
+	for _, f := range []string{s.hostname, s.appName, s.procID, s.msgID} {
+		s.msg = append(s.msg, ' ')
+		s.msg = append(s.msg, f...)
+	}
+	// no structured data
+	s.msg = append(s.msg, " - "...)
+	s.msg = append(s.msg, line...)
+
+	out := s.msg
+	if s.octetCounting {
+		s.frame = strconv.AppendInt(s.frame[:0], int64(len(s.msg)), 10)
+		s.frame = append(s.frame, ' ')
+		s.frame = append(s.frame, s.msg...)
+		out = s.frame
+	}
+	_, err := s.w.Write(out)
+	return err
+}
+
+// field makes a header field valid: printable ASCII without spaces, no
+// longer than max, and "-" (nil) if empty
+func field(v string, max int) string {
+	if v == "" {
+		return "-"
+	}
+	b := []byte(v)
+	if len(b) > max {
+		b = b[:max]
+	}
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,127 @@
+package syslogwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testTime = time.Date(2020, 3, 4, 5, 6, 7, 890000000, time.UTC)
+
+func newTest(w *strings.Builder, opts ...Option) *SyslogWriter {
+	opts = append([]Option{WithHostname("host"), WithAppName("app")}, opts...)
+	s := New(w, opts...)
+	s.procID = "42"
+	s.now = func() time.Time { return testTime }
+	return s
+}
+
+func TestSyslogWriterFraming(t *testing.T) {
+	var sb strings.Builder
+	s := newTest(&sb)
+	_, err := s.Write([]byte("hello\r\nERROR: oops\nno level"))
+	require.NoError(t, err)
+	require.NoError(t, s.Flush())
+	require.Equal(t, ""+
+		"<14>1 2020-03-04T05:06:07.890000Z host app 42 - - hello"+
+		"<11>1 2020-03-04T05:06:07.890000Z host app 42 - - ERROR: oops"+
+		"<14>1 2020-03-04T05:06:07.890000Z host app 42 - - no level",
+		sb.String())
+}
+
+func TestSyslogWriterSeverity(t *testing.T) {
+	s := New(nil)
+	for line, want := range map[string]Severity{
+		"[WARN] disk filling":     Warning,
+		"FATAL: can't start":      Critical,
+		"DEBUG x=1":               Debug,
+		"level=INFO msg=started":  Info,
+		"ERRORS are not an error": Info,
+		"NOTICE then ERROR":       Error,
+	} {
+		require.Equal(t, want, s.Severity([]byte(line)), line)
+	}
+
+	s = New(nil,
+		WithRules(Rule{regexp.MustCompile(`(?i)level=error`), Error}),
+		WithDefaultSeverity(Notice),
+	)
+	require.Equal(t, Error, s.Severity([]byte("level=error msg=oops")))
+	require.Equal(t, Notice, s.Severity([]byte("WARN: ignored")))
+}
+
+func TestSyslogWriterOptions(t *testing.T) {
+	var sb strings.Builder
+	s := newTest(&sb,
+		WithFacility(Local3),
+		WithMsgID("ID7"),
+		WithHostname("my host"),
+		WithAppName(""),
+		WithOctetCounting(true),
+	)
+	s.Write([]byte("WARN x\n"))
+	msg := "<156>1 2020-03-04T05:06:07.890000Z my_host - 42 ID7 - WARN x"
+	require.Equal(t, fmt.Sprintf("%d %s", len(msg), msg), sb.String())
+}
+
+func TestSyslogWriterDialUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	s, err := Dial("udp", pc.LocalAddr().String(), WithHostname("host"))
+	require.NoError(t, err)
+	s.Write([]byte("one\ntwo\n"))
+	require.NoError(t, s.Close())
+
+	buf := make([]byte, 1024)
+	for _, want := range []string{"one", "two"} {
+		pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(string(buf[:n]), "<14>1 "))
+		require.True(t, strings.HasSuffix(string(buf[:n]), " - - "+want))
+	}
+}
+
+func TestSyslogWriterDialTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	s, err := Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	s.Write([]byte("one\ntwo\n"))
+	require.NoError(t, s.Close())
+
+	conn, err := ln.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for _, want := range []string{"one", "two"} {
+		var n int
+		_, err := fmt.Fscanf(r, "%d ", &n)
+		require.NoError(t, err)
+		msg := make([]byte, n)
+		_, err = io.ReadFull(r, msg)
+		require.NoError(t, err)
+		require.True(t, strings.HasSuffix(string(msg), " - - "+want))
+	}
+}
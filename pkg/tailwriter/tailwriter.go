@@ -0,0 +1,111 @@
+package tailwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ndau/writers/pkg/ringwriter"
+)
+
+// TailError is an error accompanied by the last lines of output written
+// before it happened
+type TailError struct {
+	Err  error
+	Tail []string
+}
+
+func (e *TailError) Error() string {
+	if len(e.Tail) == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s; last %d lines of output:\n%s", e.Err, len(e.Tail), strings.Join(e.Tail, "\n"))
+}
+
+func (e *TailError) Unwrap() error {
+	return e.Err
+}
+
+// TailWriter passes everything written to it through to an underlying
+// writer, while retaining the last few lines, so that they can be included
+// in the error message when a command fails:
+//
+//	tail := tailwriter.New(os.Stderr, 50)
+//	cmd.Stderr = tail
+//	if err := cmd.Run(); err != nil {
+//		return tail.WrapError(err)
+//	}
+//
+// A trailing partial line counts as one of the lines in the tail.
+// TailWriter is a RingWriter with a passthrough, and like RingWriter, it's
+// safe for concurrent use.
+type TailWriter struct {
+	w    io.Writer
+	ring *ringwriter.RingWriter
+}
+
+// static assert that TailWriter is an io.Writer
+var _ io.Writer = (*TailWriter)(nil)
+
+// Option configures a TailWriter
+type Option func(*[]ringwriter.Option)
+
+// WithMaxBytes limits the retained lines to n bytes in total, including
+// their newlines and any partial line
+func WithMaxBytes(n int) Option {
+	return func(opts *[]ringwriter.Option) {
+		*opts = append(*opts, ringwriter.WithMaxBytes(n))
+	}
+}
+
+// New creates a new TailWriter which passes everything through to w, and
+// retains the last n lines
+func New(w io.Writer, n int, opts ...Option) *TailWriter {
+	ropts := []ringwriter.Option{ringwriter.WithPassthrough(w)}
+	for _, opt := range opts {
+		opt(&ropts)
+	}
+	return &TailWriter{
+		w:    w,
+		ring: ringwriter.New(n, ropts...),
+	}
+}
+
+// Write writes p to the underlying writer, and retains what it accepted
+func (t *TailWriter) Write(p []byte) (int, error) {
+	return t.ring.Write(p)
+}
+
+// Tail returns the last n lines, oldest first, without their newlines
+func (t *TailWriter) Tail() []string {
+	return t.ring.Lines()
+}
+
+// String returns the retained lines, joined by newlines
+func (t *TailWriter) String() string {
+	return strings.Join(t.Tail(), "\n")
+}
+
+// WrapError returns a *TailError holding err and the retained lines. If
+// err is nil, it returns nil.
+func (t *TailWriter) WrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &TailError{Err: err, Tail: t.Tail()}
+}
+
+// Unwrap returns the underlying writer
+func (t *TailWriter) Unwrap() io.Writer {
+	return t.w
+}
@@ -0,0 +1,60 @@
+package tailwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ndau/writers/pkg/tailwriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTailWriter(t *testing.T) {
+	var buf bytes.Buffer
+	tail := tailwriter.New(&buf, 2)
+	for i := 1; i <= 4; i++ {
+		fmt.Fprintf(tail, "line %d\n", i)
+	}
+	require.Equal(t, "line 1\nline 2\nline 3\nline 4\n", buf.String())
+	require.Equal(t, []string{"line 3", "line 4"}, tail.Tail())
+	require.Equal(t, "line 3\nline 4", tail.String())
+
+	// a partial line counts as one of the n
+	tail.Write([]byte("partial"))
+	require.Equal(t, "line 1\nline 2\nline 3\nline 4\npartial", buf.String())
+	require.Equal(t, []string{"line 4", "partial"}, tail.Tail())
+	require.Equal(t, "line 4\npartial", tail.String())
+}
+
+func TestTailWriterMaxBytes(t *testing.T) {
+	var buf bytes.Buffer
+	tail := tailwriter.New(&buf, 10, tailwriter.WithMaxBytes(8))
+	tail.Write([]byte("abc\ndef\nghi\n"))
+	require.Equal(t, []string{"def", "ghi"}, tail.Tail())
+}
+
+func TestTailWriterWrapError(t *testing.T) {
+	var buf bytes.Buffer
+	tail := tailwriter.New(&buf, 2)
+	require.NoError(t, tail.WrapError(nil))
+
+	exit := errors.New("exit status 1")
+	err := tail.WrapError(exit)
+	require.EqualError(t, err, "exit status 1")
+
+	tail.Write([]byte("compiling\nerror: missing semicolon\n"))
+	err = tail.WrapError(exit)
+	require.True(t, errors.Is(err, exit))
+	require.EqualError(t, err, "exit status 1; last 2 lines of output:\ncompiling\nerror: missing semicolon")
+}
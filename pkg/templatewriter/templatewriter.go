@@ -0,0 +1,128 @@
+package templatewriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"text/template"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+)
+
+// LineKey is the key under which the text of a line is passed to the
+// template, when the line isn't parsed as JSON
+const LineKey = "line"
+
+// TemplateWriter renders each completed line written to it through a
+// text/template, and writes the result.
+//
+// The template's data is a map[string]interface{}. By default it holds the
+// text of the line, without its newline, under LineKey, so a template can
+// refer to it as {{.line}}. With WithJSON, lines which are JSON objects are
+// decoded into the map instead, so their fields can be used directly, as
+// in {{.level}}; other lines still get LineKey.
+//
+// A newline is added to the output unless the template produces one. If
+// the template fails to execute, the line is discarded and Write returns
+// the error.
+//
+// Like LineWriter, after all data has been written, the client should call
+// the Flush method to render any partial line.
+//
+// TemplateWriter is not safe for concurrent use.
+type TemplateWriter struct {
+	w     io.Writer
+	tmpl  *template.Template
+	json  bool
+	lines *linebuffer.LineBuffer
+	out   bytes.Buffer
+}
+
+// static assert that TemplateWriter is an io.Writer
+var _ io.Writer = (*TemplateWriter)(nil)
+
+// Option configures a TemplateWriter
+type Option func(*TemplateWriter)
+
+// WithJSON decodes lines which are JSON objects into the template's data.
+// Numbers are decoded as json.Number, so they keep their precision.
+func WithJSON() Option {
+	return func(t *TemplateWriter) {
+		t.json = true
+	}
+}
+
+// New creates a new TemplateWriter which renders lines through tmpl
+func New(w io.Writer, tmpl *template.Template, opts ...Option) *TemplateWriter {
+	t := &TemplateWriter{
+		w:    w,
+		tmpl: tmpl,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.lines = linebuffer.New(t.render)
+	return t
+}
+
+// Parse parses text as a template and creates a TemplateWriter which
+// renders lines through it
+func Parse(w io.Writer, text string, opts ...Option) (*TemplateWriter, error) {
+	tmpl, err := template.New("line").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return New(w, tmpl, opts...), nil
+}
+
+// Write writes the contents of p, rendering every line completed by it
+func (t *TemplateWriter) Write(p []byte) (int, error) {
+	return t.lines.Write(p)
+}
+
+// Flush renders any partial line
+func (t *TemplateWriter) Flush() error {
+	return t.lines.Flush()
+}
+
+// Unwrap returns the underlying writer
+func (t *TemplateWriter) Unwrap() io.Writer {
+	return t.w
+}
+
+// render is the LineBuffer handler
+func (t *TemplateWriter) render(line []byte) error {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+
+	var data map[string]interface{}
+	if t.json {
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		if dec.Decode(&data) != nil || dec.More() {
+			data = nil
+		}
+	}
+	if data == nil {
+		data = map[string]interface{}{LineKey: string(line)}
+	}
+
+	t.out.Reset()
+	if err := t.tmpl.Execute(&t.out, data); err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(t.out.Bytes(), []byte{'\n'}) {
+		t.out.WriteByte('\n')
+	}
+	_, err := t.w.Write(t.out.Bytes())
+	return err
+}
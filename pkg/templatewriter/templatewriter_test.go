@@ -0,0 +1,59 @@
+package templatewriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/ndau/writers/pkg/templatewriter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateWriterPlain(t *testing.T) {
+	var sb strings.Builder
+	w, err := templatewriter.Parse(&sb, `> {{.line}}`)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello\nwor"))
+	require.NoError(t, err)
+	w.Write([]byte("ld"))
+	require.NoError(t, w.Flush())
+	require.Equal(t, "> hello\n> world\n", sb.String())
+}
+
+func TestTemplateWriterJSON(t *testing.T) {
+	var sb strings.Builder
+	tmpl := template.Must(template.New("x").Funcs(template.FuncMap{
+		"upper": strings.ToUpper,
+	}).Parse("{{with .level}}[{{upper .}}] {{end}}{{or .msg .line}} n={{.n}}\n"))
+	w := templatewriter.New(&sb, tmpl, templatewriter.WithJSON())
+	w.Write([]byte(`{"level":"warn","msg":"disk","n":12345678901234567890}` + "\n"))
+	w.Write([]byte("not json\n"))
+	w.Write([]byte(`{"msg":"a"} {"msg":"b"}` + "\n"))
+	require.Equal(t, ""+
+		"[WARN] disk n=12345678901234567890\n"+
+		"not json n=<no value>\n"+
+		`{"msg":"a"} {"msg":"b"} n=<no value>`+"\n",
+		sb.String())
+}
+
+func TestTemplateWriterErrors(t *testing.T) {
+	_, err := templatewriter.Parse(nil, "{{.line")
+	require.Error(t, err)
+
+	var sb strings.Builder
+	w, err := templatewriter.Parse(&sb, `{{index .line 99}}`)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("short\n"))
+	require.Error(t, err)
+	require.Empty(t, sb.String())
+}
@@ -0,0 +1,185 @@
+package termwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/ndau/writers/pkg/linebuffer"
+	"golang.org/x/term"
+)
+
+// DefaultWidth is the width reported when it can't be detected
+const DefaultWidth = 80
+
+// ColorMode determines whether color is enabled
+type ColorMode int
+
+const (
+	// Auto enables color when writing to a terminal, unless the NO_COLOR
+	// environment variable is set or TERM is "dumb"
+	Auto ColorMode = iota
+	// Always enables color
+	Always
+	// Never disables color
+	Never
+)
+
+// escapes matches ANSI escape sequences: CSI sequences such as colors and
+// cursor movement, and OSC sequences such as hyperlinks and titles
+var escapes = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)`)
+
+// TermWriter makes the decisions which depend on whether output goes to a
+// terminal once, in one place, for the writers and programs built on it.
+//
+// It detects whether the underlying writer is a terminal, reports its
+// width, and decides whether to use color. When color is disabled, it
+// strips ANSI escape sequences from the output. When the output isn't a
+// terminal, it also collapses lines which are updated in place with \r,
+// such as progress bars, to their final state, so that a log file gets
+// "100%" rather than every intermediate percentage.
+//
+// When the output isn't a terminal, lines are buffered until they're
+// complete; like LineWriter, after all data has been written, the client
+// should call the Flush method to write any partial line.
+//
+// TermWriter is not safe for concurrent use.
+type TermWriter struct {
+	w        io.Writer
+	fd       int
+	terminal bool
+	color    bool
+	lines    *linebuffer.LineBuffer
+	buf      []byte
+}
+
+// static assert that TermWriter is an io.Writer
+var _ io.Writer = (*TermWriter)(nil)
+
+// Option configures a TermWriter
+type Option func(*config)
+
+type config struct {
+	color ColorMode
+}
+
+// WithColor sets whether color is enabled; the default is Auto
+func WithColor(mode ColorMode) Option {
+	return func(c *config) {
+		c.color = mode
+	}
+}
+
+// New creates a new TermWriter. The writer is a terminal if it has an Fd
+// method, as *os.File does, and the descriptor is a terminal.
+func New(w io.Writer, opts ...Option) *TermWriter {
+	c := config{}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	t := &TermWriter{w: w, fd: -1}
+	if f, ok := w.(interface{ Fd() uintptr }); ok {
+		t.fd = int(f.Fd())
+		t.terminal = term.IsTerminal(t.fd)
+	}
+	switch c.color {
+	case Always:
+		t.color = true
+	case Auto:
+		t.color = t.terminal && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+	}
+	t.lines = linebuffer.New(t.writeLine)
+	return t
+}
+
+// IsTerminal reports whether the underlying writer is a terminal
+func (t *TermWriter) IsTerminal() bool {
+	return t.terminal
+}
+
+// Color reports whether color is enabled. When it isn't, escape sequences
+// are stripped from the output, so writers can emit color unconditionally.
+func (t *TermWriter) Color() bool {
+	return t.color
+}
+
+// CanUpdate reports whether lines can be updated in place with \r and
+// cursor movement, which is only the case on a terminal
+func (t *TermWriter) CanUpdate() bool {
+	return t.terminal
+}
+
+// Width returns the width of the terminal. If it isn't a terminal, or the
+// width can't be determined, it returns the value of the COLUMNS
+// environment variable, or failing that, DefaultWidth.
+func (t *TermWriter) Width() int {
+	if t.terminal {
+		if width, _, err := term.GetSize(t.fd); err == nil && width > 0 {
+			return width
+		}
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return DefaultWidth
+}
+
+// Write writes p, stripping escape sequences if color is disabled and
+// collapsing \r updates if the output isn't a terminal.
+//
+// On a terminal, p is written straight away, so escape sequences split
+// across writes are not stripped.
+func (t *TermWriter) Write(p []byte) (int, error) {
+	if !t.terminal {
+		return t.lines.Write(p)
+	}
+	if t.color {
+		return t.w.Write(p)
+	}
+	if _, err := t.w.Write(escapes.ReplaceAll(p, nil)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes any partial line
+func (t *TermWriter) Flush() error {
+	return t.lines.Flush()
+}
+
+// Unwrap returns the underlying writer
+func (t *TermWriter) Unwrap() io.Writer {
+	return t.w
+}
+
+// writeLine is the LineBuffer handler
+func (t *TermWriter) writeLine(line []byte) error {
+	body := bytes.TrimSuffix(line, []byte{'\n'})
+	eol := line[len(body):]
+	if bytes.HasSuffix(body, []byte{'\r'}) && len(eol) > 0 {
+		// \r\n is a line ending, not an update
+		body = body[:len(body)-1]
+		eol = line[len(body):]
+	}
+	if cr := bytes.LastIndexByte(body, '\r'); cr >= 0 {
+		body = body[cr+1:]
+	}
+	if !t.color {
+		body = escapes.ReplaceAll(body, nil)
+	}
+	t.buf = append(append(t.buf[:0], body...), eol...)
+	_, err := t.w.Write(t.buf)
+	return err
+}
@@ -0,0 +1,74 @@
+package termwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const red = "\x1b[31m"
+const reset = "\x1b[0m"
+
+func TestTermWriterRedirected(t *testing.T) {
+	var buf bytes.Buffer
+	tw := New(&buf)
+	require.False(t, tw.IsTerminal())
+	require.False(t, tw.Color())
+	require.False(t, tw.CanUpdate())
+
+	tw.Write([]byte(red + "error" + reset + ": oops\n"))
+	tw.Write([]byte("progress 10%\rprogress 5"))
+	tw.Write([]byte("0%\rprogress 100%\n"))
+	tw.Write([]byte("crlf\r\n\x1b]8;;http://example.com\x07link\x1b]8;;\x07\n"))
+	tw.Write([]byte("partial\r"))
+	require.Equal(t, "error: oops\nprogress 100%\ncrlf\r\nlink\n", buf.String())
+	require.NoError(t, tw.Flush())
+	require.Equal(t, "error: oops\nprogress 100%\ncrlf\r\nlink\n", buf.String())
+}
+
+func TestTermWriterAlwaysColor(t *testing.T) {
+	var buf bytes.Buffer
+	tw := New(&buf, WithColor(Always))
+	require.True(t, tw.Color())
+	tw.Write([]byte(red + "error" + reset + "\n"))
+	require.Equal(t, red+"error"+reset+"\n", buf.String())
+}
+
+func TestTermWriterTerminal(t *testing.T) {
+	var buf bytes.Buffer
+	tw := New(&buf, WithColor(Never))
+	tw.terminal = true
+	tw.Write([]byte(red + "10%" + reset + "\r"))
+	require.Equal(t, "10%\r", buf.String())
+
+	buf.Reset()
+	tw.color = true
+	tw.Write([]byte(red + "20%\r"))
+	require.Equal(t, red+"20%\r", buf.String())
+}
+
+func TestTermWriterFile(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	require.NoError(t, err)
+	defer f.Close()
+	tw := New(f)
+	require.False(t, tw.IsTerminal())
+
+	t.Setenv("COLUMNS", "123")
+	require.Equal(t, 123, tw.Width())
+	t.Setenv("COLUMNS", "")
+	require.Equal(t, DefaultWidth, tw.Width())
+}
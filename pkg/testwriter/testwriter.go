@@ -12,21 +12,171 @@ package testwriter
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"unicode/utf8"
 
-	"github.com/ndau/writers/pkg/linewriter"
+	"github.com/ndau/writers/pkg/severitywriter"
+	"github.com/ndau/writers/pkg/writers"
 )
 
-// TestWriter wraps a testing.T in a linewriter, calling
-// t.Log on every newline. It implements io.Writer.
+// repoPackages is the prefix of the packages in this repository, whose
+// frames are skipped when looking for the caller
+const repoPackages = "github.com/ndau/writers/pkg/"
+
+// DefaultErrorPattern matches the lines which WithFailOnErrors reports as
+// errors: those containing one of severitywriter's DefaultErrorTokens, and
+// the start of a Go panic
+var DefaultErrorPattern = regexp.MustCompile(
+	severitywriter.Pattern(severitywriter.DefaultErrorTokens, false).String() + `|^panic: `,
+)
+
+// NameToken is replaced by the name of the test in the path given to
+// WithFile
+const NameToken = "{test}"
+
+// unsafeName matches the characters of a test name which are replaced in
+// file names
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Action determines how a TestWriter reports a line
+type Action int
+
+const (
+	// Log reports the line with t.Log
+	Log Action = iota
+	// Error reports the line with t.Error, failing the test
+	Error
+	// Fatal reports the line with t.Fatal, failing the test and stopping
+	// it. Like t.Fatal itself, it must only be used when the writes happen
+	// on the goroutine running the test.
+	Fatal
+)
+
+// Rule reports the lines matching a pattern with an action
+type Rule struct {
+	Pattern *regexp.Regexp
+	Action  Action
+}
+
+// TestWriter calls t.Log on every newline written to it,
+// wrapping a testing.TB. It implements io.Writer.
 //
 // The intent is that within a test suite, you can redirect
 // all logging calls to the test log, producing one test-log
-// line per log line
+// line per log line. Because it accepts a testing.TB, the
+// same writer works in tests, benchmarks and fuzz targets.
+//
+// TestWriter marks itself as a test helper, so the file and
+// line reported for each log line are those of the code which
+// called Write, not TestWriter's own. When the writes come
+// through a logging library, that's the library; use WithCaller
+// to find the code which called the library instead.
 type TestWriter struct {
-	lw *linewriter.LineWriter
+	t       testing.TB
+	prefix  string
+	caller  bool
+	skip    []string
+	capture bool
+	joins   bool
+	rules   []Rule
+	path    string
+	flushes writers.FlushCounter
+
+	// mutex is held while writing, so that lines from concurrent
+	// writes don't get mixed up
+	mutex   sync.Mutex
+	partial []byte
+	lines   []string
+	file    *os.File
+}
+
+// Option configures a TestWriter
+type Option func(*TestWriter)
+
+// WithPrefix starts each log line with the given name, so that when
+// several components in one test each have their own TestWriter, their
+// output can be told apart:
+//
+//	server := testwriter.New(t, testwriter.WithPrefix("server"))
+//	client := testwriter.New(t, testwriter.WithPrefix("client"))
+//
+// logs lines like "server: listening on :8080".
+func WithPrefix(name string) Option {
+	return func(t *TestWriter) {
+		t.prefix = name + ": "
+	}
+}
+
+// WithCaller starts each log line, after any prefix, with the file
+// and line of the code which wrote it, skipping frames in the standard
+// library, in this repository, and in any packages whose import paths
+// start with one of the given prefixes, such as
+// "github.com/sirupsen/logrus".
+func WithCaller(skip ...string) Option {
+	return func(t *TestWriter) {
+		t.caller = true
+		t.skip = skip
+	}
+}
+
+// WithCapture records every line written, as well as logging it, so that
+// the output can be checked with Lines, Contains and AssertLine
+func WithCapture() Option {
+	return func(t *TestWriter) {
+		t.capture = true
+	}
+}
+
+// WithRule reports the lines matching pattern with the given action,
+// rather than with t.Log, for example to turn a subprocess's errors into
+// test failures. When several rules match a line, the first one applies.
+func WithRule(pattern *regexp.Regexp, action Action) Option {
+	return func(t *TestWriter) {
+		t.rules = append(t.rules, Rule{Pattern: pattern, Action: action})
+	}
+}
+
+// WithFailOnErrors reports the lines matching DefaultErrorPattern with
+// t.Error
+func WithFailOnErrors() Option {
+	return WithRule(DefaultErrorPattern, Error)
+}
+
+// WithFile also writes everything written to the TestWriter to a file,
+// so that CI can collect the full output even when t.Log output is
+// suppressed because the test passed. NameToken in path is replaced by
+// the name of the test, with characters other than letters, digits, '.',
+// '_' and '-' replaced by '_':
+//
+//	testwriter.New(t, testwriter.WithFile("artifacts/{test}.log"))
+//
+// Missing directories are created, and the file is closed when the test
+// ends. Failing to create or write the file is reported with t.Error.
+func WithFile(path string) Option {
+	return func(t *TestWriter) {
+		t.path = path
+	}
+}
+
+// WithLineBuffering holds back a partial line until the rest of it is
+// written, rather than logging each Write as at least one line. Use this
+// when the output arrives in arbitrary chunks, such as the output of a
+// subprocess.
+//
+// Any partial line left over when the test ends is logged by a cleanup
+// function, so it isn't lost; call Flush to log it sooner.
+func WithLineBuffering() Option {
+	return func(t *TestWriter) {
+		t.joins = true
+	}
 }
 
 // static assert that TestWriter is an io.Writer
@@ -35,16 +185,46 @@ var _ io.Writer = (*TestWriter)(nil)
 // Write writes some bytes to the test log.
 //
 // It is expected to produce a new test-log line for every call.
-// Therefore, if the log line doesn't end with a newline, one is appended.
+// Therefore, if the log line doesn't end with a newline, one is
+// implied, unless the TestWriter was created with WithLineBuffering.
 func (t *TestWriter) Write(p []byte) (int, error) {
-	if p[len(p)-1] != 0x0a { // 0x0a == newline
-		p = append(p, 0x0a)
+	t.t.Helper()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.file != nil {
+		if _, err := t.file.Write(p); err != nil {
+			t.t.Errorf("testwriter: %s", err)
+			t.file.Close()
+			t.file = nil
+		}
+	}
+
+	data := p
+	if t.joins {
+		data = append(t.partial, p...)
+		end := bytes.LastIndexByte(data, 0x0a) + 1
+		t.partial = append([]byte(nil), data[end:]...)
+		data = data[:end]
+	}
+	if len(data) > 0 {
+		for _, line := range bytes.Split(bytes.TrimSuffix(data, []byte{0x0a}), []byte{0x0a}) {
+			t.log(line, writers.FlushNewline)
+		}
 	}
-	return t.lw.Write(p)
+	return len(p), nil
+}
+
+// Flush logs any partial line held back by WithLineBuffering
+func (t *TestWriter) Flush() error {
+	t.t.Helper()
+	t.flush(writers.FlushExplicit)
+	return nil
 }
 
 // WriteByte writes a single byte
 func (t *TestWriter) WriteByte(c byte) error {
+	t.t.Helper()
 	_, err := t.Write([]byte{c})
 	return err
 }
@@ -53,6 +233,7 @@ func (t *TestWriter) WriteByte(c byte) error {
 //
 // It returns the number of bytes written and any error.
 func (t *TestWriter) WriteRune(r rune) (size int, err error) {
+	t.t.Helper()
 	buf := make([]byte, utf8.UTFMax)
 	nbytes := utf8.EncodeRune(buf, r)
 	return t.Write(buf[:nbytes])
@@ -64,18 +245,184 @@ func (t *TestWriter) WriteRune(r rune) (size int, err error) {
 // less than len(s), it also returns an error explaining
 // why the write is short.
 func (t *TestWriter) WriteString(s string) (int, error) {
+	t.t.Helper()
 	return t.Write([]byte(s))
 }
 
-// New creates a new TestWriter
-func New(t *testing.T) *TestWriter {
-	return &TestWriter{
-		linewriter.New(&testWriterInner{
-			t:   t,
-			buf: new(bytes.Buffer),
-		}),
+// FlushStats implements writers.Stats.
+//
+// Each line logged counts as a flush.
+func (t *TestWriter) FlushStats() writers.FlushStats {
+	return t.flushes.FlushStats()
+}
+
+// Lines returns the lines captured so far, without their newlines. It
+// returns nil unless the TestWriter was created with WithCapture.
+func (t *TestWriter) Lines() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]string(nil), t.lines...)
+}
+
+// Contains reports whether any captured line contains substr
+func (t *TestWriter) Contains(substr string) bool {
+	for _, line := range t.Lines() {
+		if strings.Contains(line, substr) {
+			return true
+		}
 	}
+	return false
 }
 
-// static assert that TestWriter implements io.Writer
-var _ io.Writer = (*TestWriter)(nil)
+// AssertLine reports an error to tb unless some captured line matches the
+// regular expression pattern. It returns whether there was a match.
+func (t *TestWriter) AssertLine(tb testing.TB, pattern string) bool {
+	tb.Helper()
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		tb.Errorf("testwriter: bad pattern: %s", err)
+		return false
+	}
+	lines := t.Lines()
+	for _, line := range lines {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	tb.Errorf("testwriter: no line matches %q in %d captured lines:\n%s",
+		pattern, len(lines), strings.Join(lines, "\n"))
+	return false
+}
+
+// New creates a new TestWriter which logs to t, which may be a
+// *testing.T, *testing.B or *testing.F
+func New(t testing.TB, opts ...Option) *TestWriter {
+	tw := &TestWriter{t: t}
+	for _, opt := range opts {
+		opt(tw)
+	}
+	if tw.path != "" {
+		tw.openFile()
+	}
+	if tw.joins {
+		t.Cleanup(func() { tw.flush(writers.FlushClose) })
+	}
+	return tw
+}
+
+// openFile opens the file set by WithFile, and arranges for it to be
+// closed when the test ends
+func (t *TestWriter) openFile() {
+	name := unsafeName.ReplaceAllString(t.t.Name(), "_")
+	path := strings.ReplaceAll(t.path, NameToken, name)
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err == nil {
+		t.file, err = os.Create(path)
+	}
+	if err != nil {
+		t.t.Errorf("testwriter: %s", err)
+		return
+	}
+	t.t.Cleanup(func() {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		if t.file != nil {
+			if err := t.file.Close(); err != nil {
+				t.t.Errorf("testwriter: %s", err)
+			}
+			t.file = nil
+		}
+	})
+}
+
+func (t *TestWriter) flush(reason writers.FlushReason) {
+	t.t.Helper()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.partial) > 0 {
+		t.log(t.partial, reason)
+		t.partial = nil
+	}
+}
+
+// log logs a single line; it's called with the lock held
+func (t *TestWriter) log(line []byte, reason writers.FlushReason) {
+	t.t.Helper()
+	t.flushes.Record(reason)
+	if t.capture {
+		t.lines = append(t.lines, string(line))
+	}
+	msg := strings.TrimSpace(string(line))
+	if t.caller {
+		if caller := t.findCaller(); caller != "" {
+			msg = caller + ": " + msg
+		}
+	}
+	switch t.action(line) {
+	case Error:
+		t.t.Error(t.prefix + msg)
+	case Fatal:
+		t.t.Fatal(t.prefix + msg)
+	default:
+		t.t.Log(t.prefix + msg)
+	}
+}
+
+// action returns the action of the first rule matching line
+func (t *TestWriter) action(line []byte) Action {
+	for _, rule := range t.rules {
+		if rule.Pattern.Match(line) {
+			return rule.Action
+		}
+	}
+	return Log
+}
+
+// findCaller returns the file and line of the first frame on the stack
+// which isn't skipped, or "" if there isn't one
+func (t *TestWriter) findCaller() string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(1, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !t.skipFrame(frame) {
+			return fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func (t *TestWriter) skipFrame(frame runtime.Frame) bool {
+	pkg := funcPackage(frame.Function)
+	switch {
+	case strings.HasSuffix(frame.File, "_test.go"):
+		return false
+	case strings.HasPrefix(pkg, repoPackages):
+		return true
+	case pkg != "main" && !strings.Contains(strings.SplitN(pkg, "/", 2)[0], "."):
+		// the standard library: its import paths have no domain
+		return true
+	}
+	for _, prefix := range t.skip {
+		if strings.HasPrefix(pkg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// funcPackage returns the import path of the package of a function name
+// as reported by runtime.Frame, such as
+// "github.com/ndau/writers/pkg/linewriter.(*LineWriter).Write"
+func funcPackage(function string) string {
+	slash := strings.LastIndex(function, "/") + 1
+	if dot := strings.Index(function[slash:], "."); dot >= 0 {
+		return function[:slash+dot]
+	}
+	return function
+}
+
+// static assert that TestWriter implements Stats
+var _ writers.Stats = (*TestWriter)(nil)
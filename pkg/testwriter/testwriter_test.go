@@ -11,7 +11,12 @@ package testwriter_test
 
 
 import (
+	"fmt"
+	"io/ioutil"
+	"log"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -44,3 +49,148 @@ func TestTestWriter(t *testing.T) {
 	write("another log line")
 	write("five lines without spacing:\n1\n  2\n3  \n  4  \n\t5\t")
 }
+
+// recordingTB records the lines logged through it, and the lines
+// reported as errors and fatal errors, without failing the test
+type recordingTB struct {
+	testing.TB
+	lines  []string
+	errors []string
+	fatals []string
+}
+
+func (r *recordingTB) Log(args ...interface{}) {
+	r.lines = append(r.lines, fmt.Sprint(args...))
+}
+
+func (r *recordingTB) Error(args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprint(args...))
+}
+
+func (r *recordingTB) Fatal(args ...interface{}) {
+	r.fatals = append(r.fatals, fmt.Sprint(args...))
+}
+
+func TestTestWriterTB(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	twriter := testwriter.New(tb)
+	_, err := twriter.WriteString("one\ntwo")
+	require.NoError(t, err)
+	require.Equal(t, []string{"one", "two"}, tb.lines)
+}
+
+func BenchmarkTestWriter(b *testing.B) {
+	twriter := testwriter.New(&recordingTB{TB: b})
+	for i := 0; i < b.N; i++ {
+		twriter.WriteString("a line of benchmark output\n")
+	}
+}
+
+func TestTestWriterCaller(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	logger := log.New(testwriter.New(tb, testwriter.WithCaller()), "", 0)
+	logger.Print("through the log package")
+	fmt.Fprintf(testwriter.New(tb, testwriter.WithCaller()), "through fmt\n")
+	require.Len(t, tb.lines, 2)
+	require.Regexp(t, `^testwriter_test\.go:\d+: through the log package$`, tb.lines[0])
+	require.Regexp(t, `^testwriter_test\.go:\d+: through fmt$`, tb.lines[1])
+}
+
+func TestTestWriterPrefix(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	server := testwriter.New(tb, testwriter.WithPrefix("server"))
+	client := testwriter.New(tb, testwriter.WithPrefix("client"), testwriter.WithCaller())
+	server.WriteString("listening\n")
+	client.WriteString("connected\n")
+	require.Len(t, tb.lines, 2)
+	require.Equal(t, "server: listening", tb.lines[0])
+	require.Regexp(t, `^client: testwriter_test\.go:\d+: connected$`, tb.lines[1])
+}
+
+// failureTB records failures instead of reporting them
+type failureTB struct {
+	testing.TB
+	errors []string
+}
+
+func (f *failureTB) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestTestWriterCapture(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	twriter := testwriter.New(tb, testwriter.WithCapture(), testwriter.WithPrefix("app"))
+	twriter.WriteString("starting up\nlistening on :8080\n")
+	twriter.WriteString("  indented")
+
+	require.Equal(t, []string{"starting up", "listening on :8080", "  indented"}, twriter.Lines())
+	require.Equal(t, "app: indented", tb.lines[2])
+	require.True(t, twriter.Contains("listening"))
+	require.False(t, twriter.Contains("app:"))
+	require.True(t, twriter.AssertLine(t, `^listening on :\d+$`))
+
+	failures := &failureTB{TB: t}
+	require.False(t, twriter.AssertLine(failures, `^shutting down`))
+	require.Len(t, failures.errors, 1)
+	require.Contains(t, failures.errors[0], "no line matches")
+
+	require.Nil(t, testwriter.New(tb).Lines())
+}
+
+func TestTestWriterLineBuffering(t *testing.T) {
+	var tb *recordingTB
+	t.Run("subtest", func(t *testing.T) {
+		tb = &recordingTB{TB: t}
+		twriter := testwriter.New(tb, testwriter.WithLineBuffering())
+		twriter.WriteString("first li")
+		twriter.WriteString("ne\nsecond")
+		require.Equal(t, []string{"first line"}, tb.lines)
+		require.NoError(t, twriter.Flush())
+		require.Equal(t, []string{"first line", "second"}, tb.lines)
+
+		twriter.WriteString("left over")
+	})
+	// the partial line was logged when the subtest ended
+	require.Equal(t, []string{"first line", "second", "left over"}, tb.lines)
+}
+
+func TestTestWriterRules(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	twriter := testwriter.New(tb,
+		testwriter.WithRule(regexp.MustCompile(`^FATAL`), testwriter.Fatal),
+		testwriter.WithRule(regexp.MustCompile(`WARN`), testwriter.Log),
+		testwriter.WithFailOnErrors(),
+	)
+	twriter.WriteString("INFO all good\n")
+	twriter.WriteString("ERROR something broke\n")
+	twriter.WriteString("panic: runtime error\n")
+	twriter.WriteString("WARN an ERROR was ignored\n")
+	twriter.WriteString("FATAL giving up\n")
+	twriter.WriteString("no errors here\n")
+
+	require.Equal(t, []string{"INFO all good", "WARN an ERROR was ignored", "no errors here"}, tb.lines)
+	require.Equal(t, []string{"ERROR something broke", "panic: runtime error"}, tb.errors)
+	require.Equal(t, []string{"FATAL giving up"}, tb.fatals)
+}
+
+func TestTestWriterFile(t *testing.T) {
+	dir := t.TempDir()
+	pattern := filepath.Join(dir, "logs", "{test}.log")
+	t.Run("sub test", func(t *testing.T) {
+		twriter := testwriter.New(&recordingTB{TB: t},
+			testwriter.WithFile(pattern),
+			testwriter.WithLineBuffering(),
+		)
+		twriter.WriteString("one\ntw")
+		twriter.WriteString("o\nthree")
+	})
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "logs", "TestTestWriterFile_sub_test.log"))
+	require.NoError(t, err)
+	require.Equal(t, "one\ntwo\nthree", string(data))
+
+	// the file is in the way of the directory
+	failures := &failureTB{TB: t}
+	testwriter.New(failures, testwriter.WithFile(filepath.Join(dir, "logs", "TestTestWriterFile_sub_test.log", "{test}")))
+	require.Len(t, failures.errors, 1)
+}
@@ -0,0 +1,118 @@
+package timeoutwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrTimeout is returned when a write does not complete in time.
+//
+// It has a Timeout method which returns true, like the errors from net.
+var ErrTimeout error = timeoutError{}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeoutwriter: write timed out" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// deadliner is implemented by writers which support write deadlines, such
+// as net.Conn and pipes from os.Pipe
+type deadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// TimeoutWriter wraps an io.Writer and enforces a deadline on each write
+// to it, returning ErrTimeout instead of hanging forever when the sink
+// stalls.
+//
+// If the underlying writer supports write deadlines (net.Conn does, for
+// example), they are used, and a timed-out write is really interrupted.
+//
+// Otherwise, each write runs on a separate goroutine, and TimeoutWriter
+// stops waiting for it when the deadline passes. The abandoned write may
+// still complete later, and the next write waits for it (within its own
+// deadline) so that writes never overlap.
+//
+// TimeoutWriter is safe for concurrent use.
+type TimeoutWriter struct {
+	w       io.Writer
+	timeout time.Duration
+	// busy holds a token while a goroutine is writing to w
+	busy chan struct{}
+}
+
+// static assert that TimeoutWriter is an io.Writer
+var _ io.Writer = (*TimeoutWriter)(nil)
+
+// New creates a new TimeoutWriter. A timeout of 0 or less means no
+// timeout: writes pass straight through to w.
+func New(w io.Writer, timeout time.Duration) *TimeoutWriter {
+	return &TimeoutWriter{
+		w:       w,
+		timeout: timeout,
+		busy:    make(chan struct{}, 1),
+	}
+}
+
+// Write writes p to the underlying writer, or returns ErrTimeout if that
+// takes too long.
+func (t *TimeoutWriter) Write(p []byte) (int, error) {
+	if t.timeout <= 0 {
+		return t.w.Write(p)
+	}
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+
+	select {
+	case t.busy <- struct{}{}:
+	case <-timer.C:
+		return 0, ErrTimeout
+	}
+
+	if d, ok := t.w.(deadliner); ok && d.SetWriteDeadline(time.Now().Add(t.timeout)) == nil {
+		n, err := t.w.Write(p)
+		d.SetWriteDeadline(time.Time{})
+		<-t.busy
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			err = ErrTimeout
+		}
+		return n, err
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+	results := make(chan result, 1)
+	data := append([]byte(nil), p...)
+	go func() {
+		n, err := t.w.Write(data)
+		<-t.busy
+		results <- result{n, err}
+	}()
+
+	select {
+	case r := <-results:
+		return r.n, r.err
+	case <-timer.C:
+		return 0, ErrTimeout
+	}
+}
+
+// Unwrap returns the underlying writer
+func (t *TimeoutWriter) Unwrap() io.Writer {
+	return t.w
+}
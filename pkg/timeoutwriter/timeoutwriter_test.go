@@ -0,0 +1,117 @@
+package timeoutwriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/timeoutwriter"
+	"github.com/stretchr/testify/require"
+)
+
+// stallingWriter blocks each write until it's released
+type stallingWriter struct {
+	mutex   sync.Mutex
+	buf     bytes.Buffer
+	release chan struct{}
+}
+
+func (s *stallingWriter) Write(p []byte) (int, error) {
+	<-s.release
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *stallingWriter) String() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.buf.String()
+}
+
+func TestTimeoutWriterFastWrite(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := timeoutwriter.New(buffer, time.Second)
+	n, err := writer.Write([]byte("quick"))
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+	require.Equal(t, "quick", buffer.String())
+}
+
+func TestTimeoutWriterStalledSink(t *testing.T) {
+	sink := &stallingWriter{release: make(chan struct{})}
+	writer := timeoutwriter.New(sink, 20*time.Millisecond)
+
+	_, err := writer.Write([]byte("first"))
+	require.Equal(t, timeoutwriter.ErrTimeout, err)
+	require.True(t, err.(interface{ Timeout() bool }).Timeout())
+
+	// the abandoned write is still pending, so this one can't start either
+	_, err = writer.Write([]byte("second"))
+	require.Equal(t, timeoutwriter.ErrTimeout, err)
+
+	// once the sink recovers, the abandoned write completes, and writes work again
+	close(sink.release)
+	require.Eventually(t, func() bool { return sink.String() == "first" }, time.Second, time.Millisecond)
+	_, err = writer.Write([]byte(" third"))
+	require.NoError(t, err)
+	require.Equal(t, "first third", sink.String())
+}
+
+func TestTimeoutWriterConnDeadline(t *testing.T) {
+	// nobody reads from the other end of the pipe
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	writer := timeoutwriter.New(client, 20*time.Millisecond)
+	_, err := writer.Write([]byte("unread"))
+	require.Equal(t, timeoutwriter.ErrTimeout, err)
+
+	// the deadline doesn't linger
+	go func() {
+		buf := make([]byte, 2)
+		server.Read(buf)
+	}()
+	time.Sleep(40 * time.Millisecond)
+	n, err := writer.Write([]byte("ok"))
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+}
+
+func TestTimeoutWriterNoTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			if _, err := server.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	// a timeout of 0 or less means the write is never timed out, even on
+	// a sink with deadlines
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		writer := timeoutwriter.New(client, timeout)
+		for i := 0; i < 20; i++ {
+			n, err := writer.Write([]byte("data"))
+			require.NoError(t, err)
+			require.Equal(t, 4, n)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package uploadwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config describes an S3-compatible bucket
+type S3Config struct {
+	// Endpoint is the base URL of the service, for example
+	// "https://s3.us-east-1.amazonaws.com" or "http://localhost:9000".
+	// Objects are addressed path-style, as Endpoint/Bucket/key.
+	Endpoint string
+	Region   string
+	Bucket   string
+
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is only needed for temporary credentials
+	SessionToken string
+
+	// Client is used to send requests; if nil, http.DefaultClient is used
+	Client *http.Client
+}
+
+// S3Error is returned when the service rejects a request
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("uploadwriter: s3 responded %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// S3Backend is a Backend for S3 and compatible object stores, which signs
+// its requests with AWS Signature Version 4
+type S3Backend struct {
+	cfg S3Config
+	now func() time.Time
+}
+
+// static assert that S3Backend is a Backend
+var _ Backend = (*S3Backend)(nil)
+
+// NewS3 creates a new S3Backend
+func NewS3(cfg S3Config) *S3Backend {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	return &S3Backend{
+		cfg: cfg,
+		now: time.Now,
+	}
+}
+
+// Create implements Backend
+func (b *S3Backend) Create(ctx context.Context, key string) (Upload, error) {
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	_, err := b.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Upload{backend: b, key: key, id: result.UploadID}, nil
+}
+
+type s3Part struct {
+	PartNumber int
+	ETag       string
+}
+
+type s3Upload struct {
+	backend *S3Backend
+	key     string
+	id      string
+	parts   []s3Part
+}
+
+func (u *s3Upload) UploadPart(ctx context.Context, number int, data []byte) error {
+	query := url.Values{
+		"partNumber": {strconv.Itoa(number)},
+		"uploadId":   {u.id},
+	}
+	header, err := u.backend.do(ctx, http.MethodPut, u.key, query, data, nil)
+	if err != nil {
+		return err
+	}
+	u.parts = append(u.parts, s3Part{PartNumber: number, ETag: header.Get("ETag")})
+	return nil
+}
+
+func (u *s3Upload) Complete(ctx context.Context) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: u.parts})
+	if err != nil {
+		return err
+	}
+	_, err = u.backend.do(ctx, http.MethodPost, u.key, url.Values{"uploadId": {u.id}}, body, nil)
+	return err
+}
+
+func (u *s3Upload) Abort(ctx context.Context) error {
+	_, err := u.backend.do(ctx, http.MethodDelete, u.key, url.Values{"uploadId": {u.id}}, nil, nil)
+	return err
+}
+
+// do sends a signed request, and decodes the XML response into result if
+// it's not nil
+func (b *S3Backend) do(ctx context.Context, method, key string, query url.Values, body []byte, result interface{}) (http.Header, error) {
+	u := b.cfg.Endpoint + "/" + escapePath(b.cfg.Bucket+"/"+key) + "?" + canonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	if b.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.cfg.SessionToken)
+	}
+	sign(req, hex.EncodeToString(sum[:]), b.cfg, "s3", b.now())
+
+	resp, err := b.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// CompleteMultipartUpload can fail after responding 200
+	if resp.StatusCode/100 != 2 || bytes.Contains(data, []byte("<Error>")) {
+		s3err := &S3Error{StatusCode: resp.StatusCode}
+		xml.Unmarshal(data, s3err)
+		return nil, s3err
+	}
+	if result != nil {
+		if err := xml.Unmarshal(data, result); err != nil {
+			return nil, err
+		}
+	}
+	return resp.Header, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req,
+// covering the host and any x-amz-* headers
+func sign(req *http.Request, payloadHash string, cfg S3Config, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + cfg.Region + "/" + service + "/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + cfg.SecretAccessKey)
+	for _, part := range []string{date, cfg.Region, service, "aws4_request", stringToSign} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		cfg.AccessKeyID, scope, signedHeaders, hex.EncodeToString(key),
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	io.WriteString(mac, data)
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes a query string as SigV4 requires: sorted by key,
+// with every character but the unreserved ones escaped
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for k, vs := range query {
+		for _, v := range vs {
+			pairs = append(pairs, escape(k, false)+"="+escape(v, false))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func escapePath(p string) string {
+	return escape(p, true)
+}
+
+// escape percent-encodes every byte of s except the RFC 3986 unreserved
+// characters, and slashes if keepSlash is set
+func escape(s string, keepSlash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', keepSlash && c == '/':
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
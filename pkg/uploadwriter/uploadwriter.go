@@ -0,0 +1,180 @@
+package uploadwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// DefaultPartSize is the smallest part S3 accepts, other than the last
+const DefaultPartSize = 5 << 20
+
+// ErrClosed is returned by writes to an UploadWriter which has been closed.
+var ErrClosed = errors.New("uploadwriter: write to closed writer")
+
+// Backend is an object store which supports multipart uploads
+type Backend interface {
+	// Create starts a multipart upload of the object named key
+	Create(ctx context.Context, key string) (Upload, error)
+}
+
+// Upload is a multipart upload in progress
+type Upload interface {
+	// UploadPart uploads a part. Parts are numbered from 1, and uploaded
+	// in order. The data is only valid for the duration of the call.
+	UploadPart(ctx context.Context, number int, data []byte) error
+	// Complete assembles the uploaded parts into the object
+	Complete(ctx context.Context) error
+	// Abort discards the uploaded parts
+	Abort(ctx context.Context) error
+}
+
+// UploadWriter accumulates the data written to it, and uploads it to an
+// object store in parts of a fixed size. The object is assembled when
+// Close is called, which also uploads whatever is left as the final part.
+//
+// The upload is started lazily, when the first part is ready. Each part is
+// uploaded synchronously during the Write which filled it. If an upload
+// fails, the whole upload is aborted, and that error is returned by every
+// later call.
+//
+// The object doesn't exist until Close succeeds, so the client must always
+// call Close. UploadWriter is not safe for concurrent use.
+type UploadWriter struct {
+	backend  Backend
+	key      string
+	ctx      context.Context
+	partSize int
+	upload   Upload
+	part     int
+	buf      []byte
+	err      error
+	closed   bool
+}
+
+// static assert that UploadWriter is an io.WriteCloser
+var _ io.WriteCloser = (*UploadWriter)(nil)
+
+// Option configures an UploadWriter
+type Option func(*UploadWriter)
+
+// WithPartSize sets the size of each part but the last. Object stores
+// generally have a minimum; for S3 it's DefaultPartSize. A size of 0 or
+// less uses DefaultPartSize.
+func WithPartSize(n int) Option {
+	return func(u *UploadWriter) {
+		if n <= 0 {
+			n = DefaultPartSize
+		}
+		u.partSize = n
+	}
+}
+
+// WithContext sets the context passed to the backend
+func WithContext(ctx context.Context) Option {
+	return func(u *UploadWriter) {
+		u.ctx = ctx
+	}
+}
+
+// New creates a new UploadWriter which uploads the object named key
+func New(backend Backend, key string, opts ...Option) *UploadWriter {
+	u := &UploadWriter{
+		backend:  backend,
+		key:      key,
+		ctx:      context.Background(),
+		partSize: DefaultPartSize,
+	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+// Write buffers the contents of p, uploading every part it fills
+func (u *UploadWriter) Write(p []byte) (n int, err error) {
+	if u.closed {
+		return 0, ErrClosed
+	}
+	if u.err != nil {
+		return 0, u.err
+	}
+	for len(p) > 0 {
+		room := u.partSize - len(u.buf)
+		if room > len(p) {
+			room = len(p)
+		}
+		u.buf = append(u.buf, p[:room]...)
+		p = p[room:]
+		n += room
+		if len(u.buf) >= u.partSize {
+			if err = u.uploadPart(); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Close uploads the final part and completes the upload.
+//
+// If the upload failed, it has been aborted, and Close returns the error.
+func (u *UploadWriter) Close() error {
+	if u.closed {
+		return u.err
+	}
+	u.closed = true
+	if u.err != nil {
+		return u.err
+	}
+	// an object always has at least one part, even if it's empty
+	if len(u.buf) > 0 || u.part == 0 {
+		if err := u.uploadPart(); err != nil {
+			return err
+		}
+	}
+	if err := u.upload.Complete(u.ctx); err != nil {
+		return u.fail(err)
+	}
+	return nil
+}
+
+// Parts returns the number of parts uploaded so far
+func (u *UploadWriter) Parts() int {
+	return u.part
+}
+
+func (u *UploadWriter) uploadPart() error {
+	if u.upload == nil {
+		upload, err := u.backend.Create(u.ctx, u.key)
+		if err != nil {
+			u.err = err
+			return err
+		}
+		u.upload = upload
+	}
+	if err := u.upload.UploadPart(u.ctx, u.part+1, u.buf); err != nil {
+		return u.fail(err)
+	}
+	u.part++
+	u.buf = u.buf[:0]
+	return nil
+}
+
+// fail aborts the upload and remembers err
+func (u *UploadWriter) fail(err error) error {
+	u.err = err
+	u.buf = nil
+	u.upload.Abort(u.ctx)
+	return err
+}
@@ -0,0 +1,213 @@
+package uploadwriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackend records the parts of each upload
+type fakeBackend struct {
+	parts     []string
+	failPart  int
+	completed bool
+	aborted   bool
+}
+
+func (f *fakeBackend) Create(ctx context.Context, key string) (Upload, error) {
+	return f, nil
+}
+
+func (f *fakeBackend) UploadPart(ctx context.Context, number int, data []byte) error {
+	if number == f.failPart {
+		return errors.New("part failed")
+	}
+	if number != len(f.parts)+1 {
+		return fmt.Errorf("part %d out of order", number)
+	}
+	f.parts = append(f.parts, string(data))
+	return nil
+}
+
+func (f *fakeBackend) Complete(ctx context.Context) error {
+	f.completed = true
+	return nil
+}
+
+func (f *fakeBackend) Abort(ctx context.Context) error {
+	f.aborted = true
+	return nil
+}
+
+func TestUploadWriterParts(t *testing.T) {
+	f := &fakeBackend{}
+	u := New(f, "job.log", WithPartSize(4))
+	n, err := u.Write([]byte("abcdefghij"))
+	require.NoError(t, err)
+	require.Equal(t, 10, n)
+	require.Equal(t, []string{"abcd", "efgh"}, f.parts)
+	u.Write([]byte("kl"))
+	require.Equal(t, []string{"abcd", "efgh", "ijkl"}, f.parts)
+	u.Write([]byte("m"))
+	require.False(t, f.completed)
+
+	require.NoError(t, u.Close())
+	require.Equal(t, []string{"abcd", "efgh", "ijkl", "m"}, f.parts)
+	require.True(t, f.completed)
+	require.Equal(t, 4, u.Parts())
+
+	_, err = u.Write([]byte("late"))
+	require.Equal(t, ErrClosed, err)
+}
+
+func TestUploadWriterEmpty(t *testing.T) {
+	f := &fakeBackend{}
+	u := New(f, "empty.log")
+	require.NoError(t, u.Close())
+	require.Equal(t, []string{""}, f.parts)
+	require.True(t, f.completed)
+}
+
+func TestUploadWriterBadPartSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		f := &fakeBackend{}
+		u := New(f, "job.log", WithPartSize(size))
+		n, err := u.Write([]byte("abc"))
+		require.NoError(t, err)
+		require.Equal(t, 3, n)
+		require.Empty(t, f.parts, "size %d uses the default", size)
+		require.NoError(t, u.Close())
+		require.Equal(t, []string{"abc"}, f.parts)
+	}
+}
+
+func TestUploadWriterFailure(t *testing.T) {
+	f := &fakeBackend{failPart: 2}
+	u := New(f, "job.log", WithPartSize(4))
+	n, err := u.Write([]byte("abcdefghij"))
+	require.EqualError(t, err, "part failed")
+	require.Equal(t, 8, n)
+	require.True(t, f.aborted)
+
+	_, err = u.Write([]byte("more"))
+	require.EqualError(t, err, "part failed")
+	require.EqualError(t, u.Close(), "part failed")
+	require.False(t, f.completed)
+}
+
+func TestSignV4(t *testing.T) {
+	// the get-vanilla case from the AWS Signature Version 4 test suite
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+	cfg := S3Config{
+		Region:          "us-east-1",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	emptyHash := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	sign(req, emptyHash, cfg, "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	require.Equal(t,
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+			"SignedHeaders=host;x-amz-date, "+
+			"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestEscape(t *testing.T) {
+	require.Equal(t, "logs/job%201/a~b%2Bc.log", escapePath("logs/job 1/a~b+c.log"))
+	require.Equal(t, "a%2Fb", escape("a/b", false))
+}
+
+// fakeS3 implements just enough of the S3 multipart API
+type fakeS3 struct {
+	lock    sync.Mutex
+	parts   map[int]string
+	objects map[string]string
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Error><Code>AccessDenied</Code><Message>no</Message></Error>")
+		return
+	}
+	q := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		s.parts = map[int]string{}
+		fmt.Fprint(w, "<InitiateMultipartUploadResult><UploadId>up1</UploadId></InitiateMultipartUploadResult>")
+	case r.Method == http.MethodPut && q.Get("uploadId") == "up1":
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		s.parts[n] = string(body)
+		w.Header().Set("ETag", fmt.Sprintf(`"etag%d"`, n))
+	case r.Method == http.MethodPost && q.Get("uploadId") == "up1":
+		var nums []int
+		for n := range s.parts {
+			nums = append(nums, n)
+		}
+		sort.Ints(nums)
+		var sb strings.Builder
+		for _, n := range nums {
+			if !strings.Contains(string(body), fmt.Sprintf(`<PartNumber>%d</PartNumber><ETag>&#34;etag%d&#34;</ETag>`, n, n)) {
+				fmt.Fprint(w, "<Error><Code>InvalidPart</Code><Message>bad etag</Message></Error>")
+				return
+			}
+			sb.WriteString(s.parts[n])
+		}
+		s.objects[r.URL.Path] = sb.String()
+		fmt.Fprint(w, "<CompleteMultipartUploadResult/>")
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestS3Backend(t *testing.T) {
+	fake := &fakeS3{objects: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	backend := NewS3(S3Config{
+		Endpoint:        server.URL + "/",
+		Region:          "us-east-1",
+		Bucket:          "archive",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+	})
+	u := New(backend, "jobs/run 1.log", WithPartSize(3))
+	u.Write([]byte("hello world"))
+	require.NoError(t, u.Close())
+	require.Equal(t, map[string]string{"/archive/jobs/run 1.log": "hello world"}, fake.objects)
+
+	backend.cfg.AccessKeyID = "wrong"
+	u = New(backend, "denied.log")
+	err := u.Close()
+	require.Error(t, err)
+	s3err, ok := err.(*S3Error)
+	require.True(t, ok)
+	require.Equal(t, http.StatusForbidden, s3err.StatusCode)
+	require.Equal(t, "AccessDenied", s3err.Code)
+}
@@ -0,0 +1,138 @@
+package utf8writer
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// ErrInvalidUTF8 is returned in Reject mode when the stream is not
+// well-formed UTF-8
+var ErrInvalidUTF8 = errors.New("utf8writer: invalid UTF-8")
+
+// Mode determines what a UTF8Writer does with invalid UTF-8
+type Mode int
+
+const (
+	// Replace substitutes U+FFFD for each invalid byte
+	Replace Mode = iota
+	// Reject returns ErrInvalidUTF8
+	Reject
+)
+
+var replacement = []byte(string(utf8.RuneError))
+
+// UTF8Writer wraps an io.Writer and makes sure that everything written to
+// it is well-formed UTF-8, which matters to downstream consumers like JSON
+// encoders.
+//
+// Depending on its Mode, invalid bytes are either replaced with U+FFFD or
+// rejected with ErrInvalidUTF8.
+//
+// A multi-byte rune may be split across Write calls, so an incomplete rune
+// at the end of a Write is held back until the next one. After all data
+// has been written, the client should call Flush, which deals with any
+// incomplete rune left over.
+//
+// UTF8Writer is not safe for concurrent use.
+type UTF8Writer struct {
+	w       io.Writer
+	mode    Mode
+	pending []byte
+	out     []byte
+}
+
+// static assert that UTF8Writer is an io.Writer
+var _ io.Writer = (*UTF8Writer)(nil)
+
+// New creates a new UTF8Writer
+func New(w io.Writer, mode Mode) *UTF8Writer {
+	return &UTF8Writer{
+		w:    w,
+		mode: mode,
+	}
+}
+
+// Write writes the contents of p, repairing or rejecting invalid UTF-8.
+//
+// In Reject mode, the valid data up to the first invalid byte is written,
+// and n reports how much of p that was.
+func (u *UTF8Writer) Write(p []byte) (n int, err error) {
+	held := len(u.pending)
+	data := p
+	if held > 0 {
+		data = append(u.pending, p...)
+		u.pending = nil
+	}
+
+	u.out = u.out[:0]
+	i := 0
+	for i < len(data) {
+		if data[i] < utf8.RuneSelf {
+			u.out = append(u.out, data[i])
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(data[i:])
+		if r != utf8.RuneError || size > 1 {
+			u.out = append(u.out, data[i:i+size]...)
+			i += size
+			continue
+		}
+		if !utf8.FullRune(data[i:]) {
+			// the rest of the rune is yet to come
+			u.pending = append([]byte(nil), data[i:]...)
+			break
+		}
+		if u.mode == Reject {
+			err = ErrInvalidUTF8
+			break
+		}
+		u.out = append(u.out, replacement...)
+		i++
+	}
+
+	if len(u.out) > 0 {
+		if _, werr := u.w.Write(u.out); werr != nil {
+			u.pending = nil
+			return 0, werr
+		}
+	}
+	if err != nil {
+		n = i - held
+		if n < 0 {
+			n = 0
+		}
+		return n, err
+	}
+	return len(p), nil
+}
+
+// Flush deals with a trailing incomplete rune, if there is one: in Replace
+// mode it's written as U+FFFD, and in Reject mode it's an error.
+func (u *UTF8Writer) Flush() error {
+	if len(u.pending) == 0 {
+		return nil
+	}
+	u.pending = nil
+	if u.mode == Reject {
+		return ErrInvalidUTF8
+	}
+	_, err := u.w.Write(replacement)
+	return err
+}
+
+// Unwrap returns the underlying writer
+func (u *UTF8Writer) Unwrap() io.Writer {
+	return u.w
+}
@@ -0,0 +1,80 @@
+package utf8writer_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ndau/writers/pkg/utf8writer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUTF8WriterValidPassesThrough(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := utf8writer.New(buffer, utf8writer.Reject)
+	text := "plain, accentué, 日本語, and 🎉\n"
+	n, err := writer.Write([]byte(text))
+	require.NoError(t, err)
+	require.Equal(t, len(text), n)
+	require.NoError(t, writer.Flush())
+	require.Equal(t, text, buffer.String())
+}
+
+func TestUTF8WriterSplitRunes(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := utf8writer.New(buffer, utf8writer.Reject)
+	text := []byte("日本🎉")
+	// write a byte at a time, so every multi-byte rune is split
+	for i := range text {
+		n, err := writer.Write(text[i : i+1])
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+	}
+	require.NoError(t, writer.Flush())
+	require.Equal(t, string(text), buffer.String())
+}
+
+func TestUTF8WriterReplace(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := utf8writer.New(buffer, utf8writer.Replace)
+	n, err := writer.Write([]byte("bad \xff\xfe bytes"))
+	require.NoError(t, err)
+	require.Equal(t, 12, n)
+	// a truncated rune at the end is replaced by Flush
+	_, err = writer.Write([]byte(" and \xe6\x97"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Flush())
+	require.Equal(t, "bad �� bytes and �", buffer.String())
+}
+
+func TestUTF8WriterReplaceBrokenSequence(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := utf8writer.New(buffer, utf8writer.Replace)
+	// the start of a three-byte rune, interrupted by ASCII in the next write
+	writer.Write([]byte("a\xe6\x97"))
+	writer.Write([]byte("b"))
+	require.NoError(t, writer.Flush())
+	require.Equal(t, "a��b", buffer.String())
+}
+
+func TestUTF8WriterReject(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := utf8writer.New(buffer, utf8writer.Reject)
+	n, err := writer.Write([]byte("good\xffbad"))
+	require.Equal(t, utf8writer.ErrInvalidUTF8, err)
+	require.Equal(t, 4, n)
+	require.Equal(t, "good", buffer.String())
+
+	_, err = writer.Write([]byte("\xe6"))
+	require.NoError(t, err)
+	require.Equal(t, utf8writer.ErrInvalidUTF8, writer.Flush())
+}
@@ -0,0 +1,108 @@
+package writers
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"io"
+)
+
+// Middleware wraps an io.Writer in another, which typically transforms the
+// data before passing it on: most of the New functions in this repository
+// can be adapted to a Middleware with a one-line closure.
+type Middleware func(io.Writer) io.Writer
+
+// Pipeline is a chain of writers built by Chain
+type Pipeline struct {
+	// stages holds every writer in the chain, starting with the one
+	// written to and ending with the sink
+	stages []io.Writer
+}
+
+// static assert that Pipeline is an io.WriteCloser
+var _ io.WriteCloser = (*Pipeline)(nil)
+
+// Chain builds a pipeline of writers which ends at sink.
+//
+// Data written to the pipeline passes through the middleware in the order
+// given, and then to the sink. For example,
+//
+//	w := writers.Chain(file,
+//		func(w io.Writer) io.Writer { return linewriter.New(w) },
+//		func(w io.Writer) io.Writer { return compresswriter.NewGzip(w) },
+//	)
+//
+// buffers each line before compressing it. Instead of remembering to
+// flush each stage, call Flush or Close on the pipeline.
+func Chain(sink io.Writer, middleware ...Middleware) *Pipeline {
+	stages := make([]io.Writer, len(middleware)+1)
+	stages[len(middleware)] = sink
+	w := sink
+	for i := len(middleware) - 1; i >= 0; i-- {
+		w = middleware[i](w)
+		stages[i] = w
+	}
+	return &Pipeline{stages: stages}
+}
+
+// Write writes p to the first stage of the pipeline
+func (p *Pipeline) Write(b []byte) (int, error) {
+	return p.stages[0].Write(b)
+}
+
+// Flush flushes every stage which has a Flush method, starting with the
+// first, so that buffered data works its way down to the sink.
+//
+// Every stage is flushed even if some fail; the first error is returned.
+func (p *Pipeline) Flush() error {
+	var first error
+	for _, w := range p.stages {
+		if f, ok := w.(Flusher); ok {
+			if err := f.Flush(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// Close closes every middleware stage, starting with the first. Stages
+// which can't be closed, and the sink, are flushed instead: the sink
+// belongs to the caller, who may well want to keep using it (os.Stdout,
+// for example).
+//
+// Every stage is closed even if some fail; the first error is returned.
+func (p *Pipeline) Close() error {
+	var first error
+	last := len(p.stages) - 1
+	for i, w := range p.stages {
+		var err error
+		if c, ok := w.(io.Closer); ok && i < last {
+			err = c.Close()
+		} else if f, ok := w.(Flusher); ok {
+			err = f.Flush()
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Unwrap returns the sink
+func (p *Pipeline) Unwrap() io.Writer {
+	return p.stages[len(p.stages)-1]
+}
+
+// Stages returns the writers in the pipeline, starting with the one
+// written to and ending with the sink
+func (p *Pipeline) Stages() []io.Writer {
+	return append([]io.Writer(nil), p.stages...)
+}
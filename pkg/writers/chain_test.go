@@ -0,0 +1,101 @@
+package writers_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ndau/writers/pkg/writers"
+	"github.com/stretchr/testify/require"
+)
+
+// upper is a minimal middleware stage
+type upper struct {
+	w io.Writer
+}
+
+func (u upper) Write(p []byte) (int, error) {
+	return u.w.Write(bytes.ToUpper(p))
+}
+
+type failingCloser struct {
+	io.Writer
+	err    error
+	closed bool
+}
+
+func (f *failingCloser) Close() error {
+	f.closed = true
+	return f.err
+}
+
+func TestChainOrder(t *testing.T) {
+	var sink bytes.Buffer
+	var order []string
+	stage := func(name string) writers.Middleware {
+		return func(w io.Writer) io.Writer {
+			order = append(order, name)
+			return w
+		}
+	}
+	p := writers.Chain(&sink,
+		func(w io.Writer) io.Writer { return upper{w} },
+		stage("inner"),
+	)
+	require.Len(t, p.Stages(), 3)
+	require.Equal(t, []string{"inner"}, order)
+
+	_, err := p.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	require.Equal(t, "HELLO\n", sink.String())
+}
+
+func TestChainFlushAndClose(t *testing.T) {
+	var sink bytes.Buffer
+	var gz *gzip.Writer
+	p := writers.Chain(&sink,
+		func(w io.Writer) io.Writer { return bufio.NewWriter(w) },
+		func(w io.Writer) io.Writer { gz = gzip.NewWriter(w); return gz },
+	)
+	_, err := p.Write([]byte("compressed"))
+	require.NoError(t, err)
+	require.Zero(t, sink.Len())
+
+	require.NoError(t, p.Flush())
+	require.NotZero(t, sink.Len())
+
+	require.NoError(t, p.Close())
+	r, err := gzip.NewReader(&sink)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "compressed", string(data))
+}
+
+func TestChainCloseErrors(t *testing.T) {
+	boom := errors.New("boom")
+	sink := &failingCloser{Writer: ioutil.Discard}
+	var first, second *failingCloser
+	p := writers.Chain(sink,
+		func(w io.Writer) io.Writer { first = &failingCloser{Writer: w, err: boom}; return first },
+		func(w io.Writer) io.Writer { second = &failingCloser{Writer: w}; return second },
+	)
+	require.Equal(t, boom, p.Close())
+	require.True(t, first.closed)
+	require.True(t, second.closed)
+	require.False(t, sink.closed, "the sink belongs to the caller")
+}
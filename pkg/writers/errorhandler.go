@@ -0,0 +1,87 @@
+package writers
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+)
+
+// Errors given as the Err of a WriteError for lines which were dropped
+// before they reached the sink
+var (
+	// ErrQueueFull means the line was dropped because the writer's queue
+	// was full
+	ErrQueueFull = errors.New("queue full")
+	// ErrAbandoned means the line was still queued when Shutdown gave up
+	ErrAbandoned = errors.New("abandoned at shutdown")
+)
+
+// WriteError describes data which couldn't be written to an underlying
+// sink: either the sink failed, or the data was dropped on its way there.
+type WriteError struct {
+	// Sink names the sink which failed
+	Sink string
+	// BytesLost is the number of bytes which were given up on because of
+	// this error. It's 0 when the data is going to be tried again, on the
+	// same sink or another.
+	BytesLost int
+	// LineHash is the LineHash of the line being written, so that a lost
+	// line can be matched with copies of it elsewhere without its content
+	// turning up in the error
+	LineHash uint64
+	// Err is the error from the sink, or ErrQueueFull or ErrAbandoned
+	Err error
+}
+
+func (e *WriteError) Error() string {
+	if e.BytesLost > 0 {
+		return fmt.Sprintf("write to %s: %s (%d bytes lost)", e.Sink, e.Err, e.BytesLost)
+	}
+	return fmt.Sprintf("write to %s: %s", e.Sink, e.Err)
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHandler is called with every error from a write to an underlying
+// sink, and for every line dropped on its way there.
+//
+// Writers which send data somewhere it can fail to arrive, such as the
+// network, retry, fallback and async writers, accept an ErrorHandler
+// through their WithWriteErrorHandler option. Without one, those errors
+// are retried, failed over, or counted as drops, without anyone hearing
+// about them; with one, data is never lost silently.
+//
+// The handler is called synchronously, either from the goroutine calling
+// Write or from the writer's background goroutine, as each option says,
+// and possibly with the writer's lock held: it must not write to the
+// writer which called it.
+type ErrorHandler func(err *WriteError)
+
+// LineHash returns the 64-bit FNV-1a hash of line
+func LineHash(line []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(line)
+	return h.Sum64()
+}
+
+// SinkName returns a name for w to use in a WriteError: the result of its
+// Name method if it has one, as *os.File does, or else its type.
+func SinkName(w io.Writer) string {
+	if n, ok := w.(interface{ Name() string }); ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", w)
+}
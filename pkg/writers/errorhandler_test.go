@@ -0,0 +1,48 @@
+package writers_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ndau/writers/pkg/writers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteError(t *testing.T) {
+	var err error = &writers.WriteError{Sink: "collector", Err: io.ErrShortWrite}
+	require.Equal(t, "write to collector: short write", err.Error())
+	require.True(t, errors.Is(err, io.ErrShortWrite))
+
+	err = &writers.WriteError{Sink: "collector", BytesLost: 12, Err: io.ErrShortWrite}
+	require.Equal(t, "write to collector: short write (12 bytes lost)", err.Error())
+}
+
+func TestLineHash(t *testing.T) {
+	require.Equal(t, uint64(0xcbf29ce484222325), writers.LineHash(nil))
+	require.Equal(t, writers.LineHash([]byte("a\n")), writers.LineHash([]byte("a\n")))
+	require.NotEqual(t, writers.LineHash([]byte("a\n")), writers.LineHash([]byte("b\n")))
+}
+
+func TestSinkName(t *testing.T) {
+	require.Equal(t, "*bytes.Buffer", writers.SinkName(new(bytes.Buffer)))
+
+	name := filepath.Join(t.TempDir(), "out.log")
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	defer f.Close()
+	require.Equal(t, name, writers.SinkName(f))
+}
@@ -0,0 +1,112 @@
+package writers
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// IdleFlusher is implemented by buffering writers which can flush
+// themselves once nothing has been written to them for a while, so that a
+// partial line doesn't sit in a buffer indefinitely when its producer goes
+// quiet.
+type IdleFlusher interface {
+	// FlushOnIdle flushes the writer after d passes without a write. A d
+	// of 0 or less turns idle flushing off.
+	FlushOnIdle(d time.Duration)
+}
+
+// Shutdowner is implemented by writers which can be shut down gracefully.
+//
+// Shutdown stops the writer accepting writes, and then writes out
+// everything it has buffered or queued, giving up when ctx ends. If
+// everything was written, it returns the same as Close would; if ctx ended
+// first, it returns a *ShutdownError describing what was left behind.
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// ShutdownError is returned by Shutdown when its context ends before the
+// writer has drained.
+type ShutdownError struct {
+	// Lines is the number of lines which weren't written, for writers
+	// which queue whole lines; others leave it at 0
+	Lines int
+	// Bytes is the number of bytes which weren't written
+	Bytes int
+	// Err is the context's error
+	Err error
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("shutdown: %d lines (%d bytes) not written: %s", e.Lines, e.Bytes, e.Err)
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// IdleTimer calls a function once a writer has been idle for a while.
+// Writers implement IdleFlusher by calling Set from FlushOnIdle, Touch
+// after every write, and Stop when they shut down.
+//
+// The function is called from its own goroutine, so it needs to take
+// whatever lock the writer's Write takes. IdleTimer is safe for concurrent
+// use, and its zero value is ready to use, with idle flushing off.
+type IdleTimer struct {
+	mutex   sync.Mutex
+	d       time.Duration
+	f       func()
+	timer   *time.Timer
+	stopped bool
+}
+
+// Set makes the timer call f once d has passed since the last Touch. A d
+// of 0 or less turns the timer off.
+func (t *IdleTimer) Set(d time.Duration, f func()) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.d = d
+	t.f = f
+}
+
+// Touch records a write, starting the countdown again
+func (t *IdleTimer) Touch() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.d <= 0 || t.stopped {
+		return
+	}
+	if t.timer == nil {
+		t.timer = time.AfterFunc(t.d, t.f)
+		return
+	}
+	t.timer.Reset(t.d)
+}
+
+// Stop turns the timer off for good. It doesn't wait for a call which is
+// already in progress.
+func (t *IdleTimer) Stop() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.stopped = true
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+}
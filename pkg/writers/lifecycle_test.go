@@ -0,0 +1,48 @@
+package writers_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/writers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdleTimer(t *testing.T) {
+	var calls int32
+	var timer writers.IdleTimer
+	// the zero value is off
+	timer.Touch()
+
+	timer.Set(10*time.Millisecond, func() { atomic.AddInt32(&calls, 1) })
+	timer.Touch()
+	timer.Touch()
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) == 1
+	}, time.Second, time.Millisecond)
+
+	timer.Touch()
+	timer.Stop()
+	timer.Touch()
+	time.Sleep(30 * time.Millisecond)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestShutdownError(t *testing.T) {
+	var err error = &writers.ShutdownError{Lines: 2, Bytes: 10, Err: context.DeadlineExceeded}
+	require.Equal(t, "shutdown: 2 lines (10 bytes) not written: context deadline exceeded", err.Error())
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
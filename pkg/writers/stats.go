@@ -0,0 +1,99 @@
+package writers
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// FlushReason explains why a buffering writer flushed its buffer
+type FlushReason int
+
+const (
+	// FlushNewline is a flush caused by the end of a line
+	FlushNewline FlushReason = iota
+	// FlushBufferFull is a flush caused by the buffer running out of space
+	FlushBufferFull
+	// FlushTimer is a flush caused by a timer expiring
+	FlushTimer
+	// FlushExplicit is a flush requested by a call to Flush
+	FlushExplicit
+	// FlushClose is a flush caused by the writer being closed
+	FlushClose
+
+	numFlushReasons
+)
+
+var flushReasonNames = [numFlushReasons]string{
+	"newline",
+	"buffer-full",
+	"timer",
+	"explicit",
+	"close",
+}
+
+func (r FlushReason) String() string {
+	if r < 0 || r >= numFlushReasons {
+		return fmt.Sprintf("FlushReason(%d)", int(r))
+	}
+	return flushReasonNames[r]
+}
+
+// FlushStats counts flushes by their reason.
+type FlushStats map[FlushReason]uint64
+
+// Total returns the total number of flushes, whatever the reason.
+func (s FlushStats) Total() (total uint64) {
+	for _, n := range s {
+		total += n
+	}
+	return
+}
+
+// Stats is implemented by the buffering writers in this repository.
+//
+// Tuning buffer sizes is much easier when you can see why flushes actually
+// happen in production: a writer which mostly flushes because its buffer is
+// full behaves very differently from one which mostly flushes at newlines.
+type Stats interface {
+	FlushStats() FlushStats
+}
+
+// FlushCounter keeps a count of flushes by reason.
+//
+// It's safe for concurrent use, and its zero value is ready to use.
+// Writers implement Stats by recording each flush in a FlushCounter and
+// returning its FlushStats.
+type FlushCounter struct {
+	counts [numFlushReasons]uint64
+}
+
+// static assert that FlushCounter implements Stats
+var _ Stats = (*FlushCounter)(nil)
+
+// Record counts a single flush
+func (c *FlushCounter) Record(reason FlushReason) {
+	if reason >= 0 && reason < numFlushReasons {
+		atomic.AddUint64(&c.counts[reason], 1)
+	}
+}
+
+// FlushStats returns a snapshot of the counts so far.
+//
+// Every reason is present in the result, even if its count is zero.
+func (c *FlushCounter) FlushStats() FlushStats {
+	stats := make(FlushStats, numFlushReasons)
+	for reason := FlushReason(0); reason < numFlushReasons; reason++ {
+		stats[reason] = atomic.LoadUint64(&c.counts[reason])
+	}
+	return stats
+}
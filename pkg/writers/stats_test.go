@@ -0,0 +1,52 @@
+package writers_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ndau/writers/pkg/writers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlushReasonString(t *testing.T) {
+	require.Equal(t, "newline", writers.FlushNewline.String())
+	require.Equal(t, "buffer-full", writers.FlushBufferFull.String())
+	require.Equal(t, "close", writers.FlushClose.String())
+	require.Equal(t, "FlushReason(99)", writers.FlushReason(99).String())
+}
+
+func TestFlushCounter(t *testing.T) {
+	var counter writers.FlushCounter
+	stats := counter.FlushStats()
+	require.Len(t, stats, 5)
+	require.Zero(t, stats.Total())
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			counter.Record(writers.FlushNewline)
+			counter.Record(writers.FlushTimer)
+		}()
+	}
+	wg.Wait()
+	counter.Record(writers.FlushExplicit)
+
+	stats = counter.FlushStats()
+	require.Equal(t, uint64(10), stats[writers.FlushNewline])
+	require.Equal(t, uint64(10), stats[writers.FlushTimer])
+	require.Equal(t, uint64(1), stats[writers.FlushExplicit])
+	require.Zero(t, stats[writers.FlushBufferFull])
+	require.Equal(t, uint64(21), stats.Total())
+}
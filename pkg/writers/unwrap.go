@@ -0,0 +1,111 @@
+package writers
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"reflect"
+)
+
+// Flusher is implemented by writers which buffer data, and can be asked to
+// pass it on to the writer they wrap.
+//
+// By convention, a writer which wraps another also has an Unwrap method:
+// either Unwrap() io.Writer, or Unwrap() []io.Writer if it writes to
+// several others. Every wrapper in this repository follows the
+// convention, which lets FlushAll and CloseAll find the whole stack.
+type Flusher interface {
+	Flush() error
+}
+
+// Unwrap returns the writers which w writes to, according to the Unwrap
+// convention described at Flusher. It returns nil if w doesn't have an
+// Unwrap method.
+func Unwrap(w io.Writer) []io.Writer {
+	switch u := w.(type) {
+	case interface{ Unwrap() io.Writer }:
+		if inner := u.Unwrap(); inner != nil {
+			return []io.Writer{inner}
+		}
+	case interface{ Unwrap() []io.Writer }:
+		return u.Unwrap()
+	}
+	return nil
+}
+
+// FlushAll flushes w and then every writer it wraps, outermost first, so
+// that buffered data works its way down to the innermost writer.
+//
+// The walk stops at writers without an Unwrap method, such as the standard
+// library's: a gzip.Writer is flushed, but not the writer underneath it.
+// Every writer is flushed even if some fail; the first error is returned.
+func FlushAll(w io.Writer) error {
+	return walk(w, func(w io.Writer) error {
+		if f, ok := w.(Flusher); ok {
+			return f.Flush()
+		}
+		return nil
+	})
+}
+
+// CloseAll closes w and then every writer it wraps, outermost first.
+// Writers which can't be closed are flushed instead.
+//
+// Unlike Pipeline.Close, this includes the innermost writer, so don't use
+// it on a stack which ends at os.Stdout. Some wrappers close the writer
+// they wrap themselves; the error from closing it a second time is
+// ignored. Every writer is closed even if some fail; the first error is
+// returned.
+func CloseAll(w io.Writer) error {
+	return walk(w, func(w io.Writer) error {
+		switch c := w.(type) {
+		case io.Closer:
+			err := c.Close()
+			if errors.Is(err, fs.ErrClosed) || errors.Is(err, net.ErrClosed) {
+				err = nil
+			}
+			return err
+		case Flusher:
+			return c.Flush()
+		}
+		return nil
+	})
+}
+
+// walk calls f for w and everything it wraps, outermost first, visiting
+// each writer once even if several others write to it
+func walk(w io.Writer, f func(io.Writer) error) error {
+	var first error
+	seen := make(map[io.Writer]bool)
+	var visit func(w io.Writer)
+	visit = func(w io.Writer) {
+		if w == nil {
+			return
+		}
+		if reflect.TypeOf(w).Comparable() {
+			if seen[w] {
+				return
+			}
+			seen[w] = true
+		}
+		if err := f(w); err != nil && first == nil {
+			first = err
+		}
+		for _, inner := range Unwrap(w) {
+			visit(inner)
+		}
+	}
+	visit(w)
+	return first
+}
@@ -0,0 +1,130 @@
+package writers_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/ndau/writers/pkg/compresswriter"
+	"github.com/ndau/writers/pkg/demuxwriter"
+	"github.com/ndau/writers/pkg/linewriter"
+	"github.com/ndau/writers/pkg/syncwriter"
+	"github.com/ndau/writers/pkg/writers"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder notes each flush and close, in order
+type recorder struct {
+	name string
+	log  *[]string
+	err  error
+}
+
+func (r *recorder) Write(p []byte) (int, error) { return len(p), nil }
+
+func (r *recorder) Flush() error {
+	*r.log = append(*r.log, "flush "+r.name)
+	return r.err
+}
+
+type closingRecorder struct {
+	recorder
+}
+
+func (c *closingRecorder) Close() error {
+	*c.log = append(*c.log, "close "+c.name)
+	return c.err
+}
+
+type wrapper struct {
+	*recorder
+	inner io.Writer
+}
+
+func (w wrapper) Unwrap() io.Writer { return w.inner }
+
+func TestUnwrap(t *testing.T) {
+	var buf bytes.Buffer
+	lw := linewriter.New(&buf)
+	require.Equal(t, []io.Writer{&buf}, writers.Unwrap(lw))
+	require.Nil(t, writers.Unwrap(&buf))
+
+	p := writers.Chain(lw)
+	require.Equal(t, []io.Writer{lw}, writers.Unwrap(p))
+}
+
+func TestFlushAllOrder(t *testing.T) {
+	var log []string
+	inner := &recorder{name: "inner", log: &log}
+	other := &recorder{name: "other", log: &log}
+	d := demuxwriter.New(inner,
+		demuxwriter.Route{Pattern: regexp.MustCompile("x"), W: other},
+		demuxwriter.Route{Pattern: regexp.MustCompile("y"), W: inner},
+	)
+	outer := wrapper{recorder: &recorder{name: "outer", log: &log}, inner: d}
+
+	require.NoError(t, writers.FlushAll(outer))
+	// routes come before the default, and inner is only flushed once
+	require.Equal(t, []string{"flush outer", "flush other", "flush inner"}, log)
+}
+
+func TestFlushAllErrors(t *testing.T) {
+	var log []string
+	boom := errors.New("boom")
+	inner := &recorder{name: "inner", log: &log}
+	outer := wrapper{recorder: &recorder{name: "outer", log: &log, err: boom}, inner: inner}
+	require.Equal(t, boom, writers.FlushAll(outer))
+	require.Equal(t, []string{"flush outer", "flush inner"}, log)
+}
+
+func TestCloseAll(t *testing.T) {
+	var log []string
+	sink := &closingRecorder{recorder{name: "sink", log: &log}}
+	var gz bytes.Buffer
+	cw := compresswriter.NewGzip(&gz)
+	lw := linewriter.New(cw)
+	outer := wrapper{recorder: &recorder{name: "outer", log: &log}, inner: writers.Chain(sink)}
+
+	_, err := lw.Write([]byte("partial"))
+	require.NoError(t, err)
+	require.NoError(t, writers.CloseAll(lw))
+	r, err := gzip.NewReader(&gz)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "partial", string(data))
+
+	require.NoError(t, writers.CloseAll(outer))
+	// the pipeline leaves its sink open, but CloseAll doesn't
+	require.Equal(t, []string{"flush outer", "flush sink", "close sink"}, log)
+}
+
+func TestCloseAllClosedFile(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	require.NoError(t, err)
+	s := syncwriter.New(f)
+	lw := linewriter.New(s)
+	lw.Write([]byte("line"))
+
+	// syncwriter closes the file itself; closing it again isn't an error
+	require.NoError(t, writers.CloseAll(lw))
+	data, err := ioutil.ReadFile(f.Name())
+	require.NoError(t, err)
+	require.Equal(t, "line", string(data))
+}
@@ -0,0 +1,259 @@
+package wswriter
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ndau/writers/pkg/internal/sendqueue"
+	"github.com/ndau/writers/pkg/linebuffer"
+	"golang.org/x/net/websocket"
+)
+
+// Defaults for the options of a WSWriter
+const (
+	DefaultQueueSize  = 1024
+	DefaultBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff = 10 * time.Second
+)
+
+// ErrClosed is returned by writes to a WSWriter which has been closed.
+var ErrClosed = errors.New("wswriter: write to closed writer")
+
+// Conn is a WebSocket connection which can send text messages.
+//
+// Dial provides one based on golang.org/x/net/websocket; other WebSocket
+// libraries can be plugged in by implementing Conn and a DialFunc.
+type Conn interface {
+	WriteText(msg []byte) error
+	Close() error
+}
+
+// DialFunc opens a new connection
+type DialFunc func() (Conn, error)
+
+// Dial returns a DialFunc which connects to url with golang.org/x/net/websocket
+func Dial(url, origin string) DialFunc {
+	return func() (Conn, error) {
+		ws, err := websocket.Dial(url, "", origin)
+		if err != nil {
+			return nil, err
+		}
+		return xnetConn{ws}, nil
+	}
+}
+
+type xnetConn struct {
+	ws *websocket.Conn
+}
+
+func (c xnetConn) WriteText(msg []byte) error {
+	return websocket.Message.Send(c.ws, string(msg))
+}
+
+func (c xnetConn) Close() error {
+	return c.ws.Close()
+}
+
+// DropPolicy determines which lines a WSWriter discards when its queue is
+// full
+type DropPolicy int
+
+const (
+	// DropOldest discards the line which has been queued the longest
+	DropOldest DropPolicy = iota
+	// DropNewest discards the line being written
+	DropNewest
+)
+
+// WSWriter sends each completed line written to it as a WebSocket text
+// message, without its trailing newline.
+//
+// Lines are queued and sent by a background goroutine, which dials the
+// connection when needed and reconnects, with exponential backoff, when it
+// breaks. The backoff only resets once a line has been sent, so a server
+// which accepts connections but fails every send doesn't cause a busy
+// reconnect loop. Lines written while disconnected wait in the queue; once
+// it's full, the DropPolicy decides which are discarded. A line whose send
+// fails is retried on the next connection.
+//
+// After all data has been written, the client must call Close, which sends
+// whatever is queued if the connection is up, and stops the goroutine.
+//
+// WSWriter is safe for concurrent use.
+type WSWriter struct {
+	dial       DialFunc
+	queueSize  int
+	policy     DropPolicy
+	backoff    time.Duration
+	maxBackoff time.Duration
+	onState    func(connected bool, err error)
+	queue      *sendqueue.Queue
+
+	writeMutex sync.Mutex
+	lines      *linebuffer.LineBuffer
+}
+
+// static assert that WSWriter is an io.WriteCloser
+var _ io.WriteCloser = (*WSWriter)(nil)
+
+// Option configures a WSWriter
+type Option func(*WSWriter)
+
+// WithQueueSize sets the number of lines which can wait to be sent. A
+// size less than 1 uses DefaultQueueSize.
+func WithQueueSize(n int) Option {
+	return func(w *WSWriter) {
+		if n < 1 {
+			n = DefaultQueueSize
+		}
+		w.queueSize = n
+	}
+}
+
+// WithDropPolicy sets which lines are discarded when the queue is full.
+//
+// The default is DropOldest, which suits live streams: a viewer who
+// reconnects would rather see recent output.
+func WithDropPolicy(p DropPolicy) Option {
+	return func(w *WSWriter) {
+		w.policy = p
+	}
+}
+
+// WithBackoff sets the delay before the first reconnection attempt, which
+// doubles after each failed attempt up to max. Delays of 0 or less use
+// DefaultBackoff and DefaultMaxBackoff, and max is raised to initial if
+// it's smaller.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(w *WSWriter) {
+		if initial <= 0 {
+			initial = DefaultBackoff
+		}
+		if max <= 0 {
+			max = DefaultMaxBackoff
+		}
+		if max < initial {
+			max = initial
+		}
+		w.backoff = initial
+		w.maxBackoff = max
+	}
+}
+
+// WithStateHandler sets a function to be called from the background
+// goroutine whenever the connection goes up or down. When it goes down,
+// err explains why.
+func WithStateHandler(f func(connected bool, err error)) Option {
+	return func(w *WSWriter) {
+		w.onState = f
+	}
+}
+
+// New creates a new WSWriter and starts its goroutine.
+//
+// It doesn't connect until there is something to send.
+func New(dial DialFunc, opts ...Option) *WSWriter {
+	w := &WSWriter{
+		dial:       dial,
+		queueSize:  DefaultQueueSize,
+		backoff:    DefaultBackoff,
+		maxBackoff: DefaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.lines = linebuffer.New(w.enqueue)
+
+	w.queue = sendqueue.New(sendqueue.Config{
+		Dial:       w.connect,
+		Size:       w.queueSize,
+		DropNewest: w.policy == DropNewest,
+		Backoff:    w.backoff,
+		MaxBackoff: w.maxBackoff,
+		OnState:    w.onState,
+	})
+	return w
+}
+
+// Write queues every line completed by p.
+//
+// It returns len(p) unless the writer has been closed, even if lines
+// were dropped.
+func (w *WSWriter) Write(p []byte) (int, error) {
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+	if w.queue.Stopped() {
+		return 0, ErrClosed
+	}
+	return w.lines.Write(p)
+}
+
+// Flush queues any partial line. It doesn't wait for it to be sent.
+func (w *WSWriter) Flush() error {
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+	if w.queue.Stopped() {
+		return ErrClosed
+	}
+	return w.lines.Flush()
+}
+
+// Close queues any partial line, then stops the background goroutine.
+//
+// Queued lines are sent first if possible, but Close doesn't wait for a
+// broken connection to recover: if it can't connect, whatever is left in
+// the queue is dropped.
+func (w *WSWriter) Close() error {
+	w.writeMutex.Lock()
+	if w.queue.Stopped() {
+		w.writeMutex.Unlock()
+		return nil
+	}
+	w.lines.Flush()
+	w.queue.Stop()
+	w.writeMutex.Unlock()
+
+	w.queue.Wait()
+	return nil
+}
+
+// Dropped returns the number of lines discarded so far
+func (w *WSWriter) Dropped() uint64 {
+	return w.queue.Dropped()
+}
+
+// enqueue is the LineBuffer handler
+func (w *WSWriter) enqueue(line []byte) error {
+	w.queue.Put(append([]byte(nil), bytes.TrimSuffix(line, []byte{'\n'})...))
+	return nil
+}
+
+func (w *WSWriter) connect() (sendqueue.Conn, error) {
+	conn, err := w.dial()
+	if err != nil {
+		return nil, err
+	}
+	return queueConn{conn}, nil
+}
+
+// queueConn adapts a Conn to the send queue
+type queueConn struct {
+	Conn
+}
+
+func (c queueConn) Send(msg []byte) error {
+	return c.WriteText(msg)
+}
@@ -0,0 +1,248 @@
+package wswriter_test
+
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/wswriter"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+// fakeNet records messages sent over fake connections
+type fakeNet struct {
+	lock     sync.Mutex
+	up       bool
+	failNext int
+	dials    int
+	msgs     []string
+}
+
+func (f *fakeNet) dial() (wswriter.Conn, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.dials++
+	if !f.up {
+		return nil, errors.New("connection refused")
+	}
+	return &fakeConn{f}, nil
+}
+
+func (f *fakeNet) setUp(up bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.up = up
+}
+
+func (f *fakeNet) dialCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.dials
+}
+
+func (f *fakeNet) messages() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string(nil), f.msgs...)
+}
+
+type fakeConn struct {
+	net *fakeNet
+}
+
+func (c *fakeConn) WriteText(msg []byte) error {
+	c.net.lock.Lock()
+	defer c.net.lock.Unlock()
+	if c.net.failNext > 0 {
+		c.net.failNext--
+		return errors.New("connection reset")
+	}
+	if !c.net.up {
+		return errors.New("broken pipe")
+	}
+	c.net.msgs = append(c.net.msgs, string(msg))
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func TestWSWriterSendsLines(t *testing.T) {
+	net := &fakeNet{up: true}
+	w := wswriter.New(net.dial)
+	_, err := w.Write([]byte("one\ntw"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("o\nthree"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, []string{"one", "two", "three"}, net.messages())
+
+	_, err = w.Write([]byte("late\n"))
+	require.Equal(t, wswriter.ErrClosed, err)
+}
+
+func TestWSWriterReconnects(t *testing.T) {
+	net := &fakeNet{up: true, failNext: 1}
+	var lock sync.Mutex
+	var states []bool
+	w := wswriter.New(net.dial,
+		wswriter.WithBackoff(time.Millisecond, 2*time.Millisecond),
+		wswriter.WithStateHandler(func(connected bool, err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			states = append(states, connected)
+		}),
+	)
+	w.Write([]byte("a\nb\n"))
+	require.NoError(t, w.Close())
+	require.Equal(t, []string{"a", "b"}, net.messages())
+	require.Equal(t, 2, net.dials)
+	require.Equal(t, []bool{true, false, true}, states)
+}
+
+func TestWSWriterBuffersWhileDown(t *testing.T) {
+	net := &fakeNet{}
+	w := wswriter.New(net.dial, wswriter.WithBackoff(time.Millisecond, time.Millisecond))
+	w.Write([]byte("a\nb\nc\n"))
+	time.Sleep(10 * time.Millisecond)
+	require.Empty(t, net.messages())
+
+	net.setUp(true)
+	require.Eventually(t, func() bool {
+		return len(net.messages()) == 3
+	}, time.Second, time.Millisecond)
+	require.NoError(t, w.Close())
+	require.Equal(t, []string{"a", "b", "c"}, net.messages())
+	require.Zero(t, w.Dropped())
+}
+
+func TestWSWriterDropPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		policy wswriter.DropPolicy
+		want   []string
+	}{
+		{"oldest", wswriter.DropOldest, []string{"c", "d"}},
+		{"newest", wswriter.DropNewest, []string{"a", "b"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			net := &fakeNet{}
+			w := wswriter.New(net.dial,
+				wswriter.WithQueueSize(2),
+				wswriter.WithDropPolicy(tt.policy),
+				wswriter.WithBackoff(time.Millisecond, time.Millisecond),
+			)
+			// the first line is taken off the queue and held for the next connection
+			w.Write([]byte("x\n"))
+			require.Eventually(t, func() bool {
+				net.lock.Lock()
+				defer net.lock.Unlock()
+				return net.dials > 0
+			}, time.Second, time.Millisecond)
+
+			w.Write([]byte("a\nb\nc\nd\n"))
+			require.Equal(t, uint64(2), w.Dropped())
+
+			net.setUp(true)
+			require.NoError(t, w.Close())
+			require.Equal(t, append([]string{"x"}, tt.want...), net.messages())
+		})
+	}
+}
+
+func TestWSWriterCloseWhileDown(t *testing.T) {
+	net := &fakeNet{}
+	w := wswriter.New(net.dial, wswriter.WithBackoff(time.Hour, time.Hour))
+	w.Write([]byte("a\nb\n"))
+	require.NoError(t, w.Close())
+	require.Empty(t, net.messages())
+	require.Equal(t, uint64(2), w.Dropped())
+}
+
+func TestWSWriterDial(t *testing.T) {
+	var lock sync.Mutex
+	var got []string
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		for {
+			var msg string
+			if err := websocket.Message.Receive(ws, &msg); err != nil {
+				return
+			}
+			lock.Lock()
+			got = append(got, msg)
+			lock.Unlock()
+		}
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	w := wswriter.New(wswriter.Dial(url, server.URL))
+	w.Write([]byte("hello\nworld\n"))
+	require.NoError(t, w.Close())
+
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(got) == 2
+	}, time.Second, time.Millisecond)
+	require.Equal(t, []string{"hello", "world"}, got)
+}
+
+func TestWSWriterBacksOffOnFailedSends(t *testing.T) {
+	// the server accepts connections, but every send fails
+	net := &fakeNet{up: true, failNext: 1000}
+	w := wswriter.New(net.dial, wswriter.WithBackoff(time.Hour, time.Hour))
+	w.Write([]byte("a\nb\n"))
+	require.Eventually(t, func() bool {
+		return net.dialCount() == 1
+	}, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, 1, net.dialCount())
+
+	closed := make(chan error)
+	go func() { closed <- w.Close() }()
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close hung")
+	}
+	require.Empty(t, net.messages())
+	require.Equal(t, uint64(2), w.Dropped())
+}
+
+func TestWSWriterBadOptions(t *testing.T) {
+	net := &fakeNet{}
+	w := wswriter.New(net.dial,
+		wswriter.WithBackoff(0, 0),
+		wswriter.WithQueueSize(0),
+	)
+	w.Write([]byte("a\nb\n"))
+	require.Eventually(t, func() bool {
+		return net.dialCount() == 1
+	}, time.Second, time.Millisecond)
+	// a zero backoff would redial without pausing
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, 1, net.dialCount())
+	// a zero queue size would drop every line
+	require.Equal(t, uint64(0), w.Dropped())
+
+	net.setUp(true)
+	require.NoError(t, w.Close())
+	require.Equal(t, []string{"a", "b"}, net.messages())
+}